@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"os"
 
 	"github.com/gainforest/heartbeads-cli/internal/account"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
 	"github.com/gainforest/heartbeads-cli/internal/comments"
+	"github.com/gainforest/heartbeads-cli/internal/completion"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/hooks"
 	"github.com/gainforest/heartbeads-cli/internal/proxy"
+	"github.com/gainforest/heartbeads-cli/internal/verify"
 	"github.com/urfave/cli/v3"
 )
 
@@ -17,18 +22,32 @@ var Version = "dev"
 
 func main() {
 	if err := run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		hberr.Report(os.Stderr, err, wantsJSON(os.Args[1:]))
+		os.Exit(hberr.ExitCode(err))
 	}
 }
 
+// wantsJSON reports whether the invocation asked for JSON output, in which
+// case errors are reported as a JSON envelope
+func wantsJSON(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if arg == "--json" || arg == "--json=true" {
+			return true
+		}
+	}
+	return false
+}
+
 func run(args []string) error {
 	return runWithOutput(args, os.Stdout)
 }
 
 func runWithOutput(args []string, w io.Writer) error {
 	app := buildApp(w)
-	return app.Run(context.Background(), args)
+	return app.Run(completion.WithArgs(context.Background(), args), args)
 }
 
 func buildApp(w io.Writer) *cli.Command {
@@ -40,20 +59,80 @@ func buildApp(w io.Writer) *cli.Command {
 		ExitErrHandler: func(ctx context.Context, cmd *cli.Command, err error) {
 			// Don't call os.Exit, just let the error propagate
 		},
+		Before: configureAuth,
 		Action: catchallAction,
+
+		// `hb completion` prints the scripts; see the completion package
+		EnableShellCompletion:           true,
+		ConfigureShellCompletionCommand: completion.Configure,
+		ShellComplete:                   completion.Native,
+
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "as",
+				Usage:   "Act as the given account profile or handle",
+				Sources: cli.EnvVars("HB_ACCOUNT"),
+			},
+			&cli.BoolFlag{
+				Name:    "explain",
+				Aliases: []string{"dry-run"},
+				Usage:   "Show the bd command, environment and rules hb would apply, without running bd (must come before the command)",
+			},
 			&cli.StringFlag{
 				Name:    "plc-host",
 				Usage:   "PLC directory URL",
 				Value:   "https://plc.directory",
 				Sources: cli.EnvVars("ATP_PLC_HOST"),
 			},
+			&cli.StringFlag{
+				Name:    "handle-dns-server",
+				Usage:   "DNS server (host:port) for handle resolution",
+				Sources: cli.EnvVars("ATP_HANDLE_DNS_SERVER"),
+			},
+			&cli.StringFlag{
+				Name:    "handle-http-host",
+				Usage:   "Base URL that answers all /.well-known/atproto-did handle lookups",
+				Sources: cli.EnvVars("ATP_HANDLE_HTTP_HOST"),
+			},
 		},
-		Commands: append([]*cli.Command{
-			account.CmdAccount,
-			comments.CmdComment,
-		}, proxy.BuildProxyCommands()...),
+		Commands: commands(),
+	}
+}
+
+// commands returns hb's native commands followed by a proxy command for
+// each command of the installed bd that hb does not handle itself
+func commands() []*cli.Command {
+	native := []*cli.Command{
+		account.CmdAccount,
+		audit.CmdAudit,
+		comments.CmdComment,
+		hooks.CmdTrust,
+		verify.CmdVerify,
+	}
+	names := make([]string, 0, len(native))
+	for _, cmd := range native {
+		names = append(names, cmd.Name)
+		names = append(names, cmd.Aliases...)
+	}
+	completion.Install(native)
+	return append(native, proxy.Commands(names...)...)
+}
+
+// configureAuth applies the global identity flags before any command runs:
+// the identity directory settings, the session source and the --as account selection
+func configureAuth(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	auth.SetDirectoryConfig(auth.DirectoryConfig{
+		PLCHost:         cmd.String("plc-host"),
+		HandleDNSServer: cmd.String("handle-dns-server"),
+		HandleHTTPHost:  cmd.String("handle-http-host"),
+	})
+	// Selected once so an ephemeral env login is shared by the whole invocation
+	src, err := auth.DefaultSessionSource()
+	if err != nil {
+		return ctx, err
 	}
+	auth.SetSessionSource(src)
+	return ctx, auth.SelectAccount(cmd.String("as"))
 }
 
 // catchallAction handles the root command invocation.
@@ -73,5 +152,5 @@ func catchallAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	// Looks like an unknown subcommand — proxy to bd with auth
-	return proxy.ExecBd(ctx, cmd.Root().Writer, args)
+	return proxy.Run(ctx, cmd, args)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/adrg/xdg"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 )
 
 // setupTestXDG configures xdg to use a temporary directory for tests
@@ -81,6 +82,38 @@ func TestCatchallNoAuth(t *testing.T) {
 	if !strings.Contains(err.Error(), "Not logged in") {
 		t.Errorf("expected 'Not logged in' error, got: %v", err)
 	}
+	if code := hberr.ExitCode(err); code != 80 {
+		t.Errorf("expected auth exit code 80, got %d", code)
+	}
+}
+
+func TestValidationExitCode(t *testing.T) {
+	setupTestXDG(t)
+
+	err := runWithOutput([]string{"hb", "close", "bd-1"}, &bytes.Buffer{})
+	if hberr.KindOf(err) != hberr.Usage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+	if code := hberr.ExitCode(err); code != 64 {
+		t.Errorf("expected exit code 64, got %d", code)
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"list", "--json"}, true},
+		{[]string{"--as", "work", "show", "bd-1", "--json=true"}, true},
+		{[]string{"list"}, false},
+		{[]string{"comment", "add", "bd-1", "--", "--json"}, false},
+	}
+	for _, tt := range tests {
+		if got := wantsJSON(tt.args); got != tt.want {
+			t.Errorf("wantsJSON(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
 }
 
 // TestCatchallHelp tests that help works without auth
@@ -112,6 +145,26 @@ func TestProxyAction_NotLoggedIn(t *testing.T) {
 	}
 }
 
+func TestDryRunRunsChecks(t *testing.T) {
+	setupTestXDG(t)
+
+	// Both spellings reach the proxy pipeline, for known and catchall commands
+	for _, args := range [][]string{
+		{"hb", "--explain", "close", "bd-1"},
+		{"hb", "--dry-run", "close", "bd-1"},
+	} {
+		err := runWithOutput(args, &bytes.Buffer{})
+		if hberr.KindOf(err) != hberr.Usage {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+
+	err := runWithOutput([]string{"hb", "--explain", "unknown-cmd"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "Not logged in") {
+		t.Errorf("expected 'Not logged in' error, got: %v", err)
+	}
+}
+
 // TestProxyHelp_NoAuthRequired tests that help works without auth
 func TestProxyHelp_NoAuthRequired(t *testing.T) {
 	// Help should always work without auth
@@ -179,6 +232,50 @@ func TestAccountLogout(t *testing.T) {
 	})
 }
 
+// TestAccountListAndSwitch tests named account profiles and --as
+func TestAccountListAndSwitch(t *testing.T) {
+	setupTestXDG(t)
+
+	for name, handle := range map[string]string{"default": "main.test", "agent": "agent.test"} {
+		sess := &auth.Session{DID: syntax.DID("did:plc:" + name), Handle: handle}
+		if err := auth.PersistAccountSession(name, sess); err != nil {
+			t.Fatalf("failed to persist %s: %v", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := runWithOutput([]string{"hb", "account", "list"}, &buf); err != nil {
+		t.Fatalf("account list failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "* default") || !strings.Contains(buf.String(), "agent.test") {
+		t.Errorf("unexpected account list output: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := runWithOutput([]string{"hb", "--as", "agent.test", "account", "list"}, &buf); err != nil {
+		t.Fatalf("account list --as failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "* agent") {
+		t.Errorf("--as should mark agent active, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := runWithOutput([]string{"hb", "account", "switch", "agent"}, &buf); err != nil {
+		t.Fatalf("account switch failed: %v", err)
+	}
+	handle, err := auth.GetLoggedInHandle()
+	if err != nil {
+		t.Fatalf("GetLoggedInHandle failed: %v", err)
+	}
+	if handle != "agent.test" {
+		t.Errorf("expected switched handle agent.test, got %s", handle)
+	}
+
+	if err := runWithOutput([]string{"hb", "--as", "nobody", "account", "list"}, &buf); err == nil {
+		t.Error("expected error for unknown --as account")
+	}
+}
+
 // TestAccountStatus_NotLoggedIn tests that status requires auth
 func TestAccountStatus_NotLoggedIn(t *testing.T) {
 	setupTestXDG(t)
@@ -256,3 +353,48 @@ func TestCommentInHelp(t *testing.T) {
 		t.Errorf("help should mention 'comment' command, got: %s", output)
 	}
 }
+
+func TestCompletionScripts(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{"bash", "complete -o bashdefault -o default -o nospace -F __hb_bash_autocomplete hb"},
+		{"zsh", "compdef _hb hb"},
+		{"fish", "complete -c hb -f -a '(__hb_complete)'"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := runWithOutput([]string{"hb", "completion", tt.shell}, &buf); err != nil {
+			t.Fatalf("completion %s failed: %v", tt.shell, err)
+		}
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("completion %s missing %q:\n%s", tt.shell, tt.want, buf.String())
+		}
+	}
+}
+
+func TestNativeCompletion(t *testing.T) {
+	setupTestXDG(t)
+	t.Setenv("SHELL", "/bin/bash")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"hb", "comment"}, "get\nadd\nflush\n"},
+		{[]string{"hb", "comment", "get", "--fi"}, "--filter\n"},
+		{[]string{"hb", "comment", "add", "--re"}, "--reply-to\n"},
+		{[]string{"hb", "completion"}, "bash\nzsh\nfish\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		args := append(tt.args, "--generate-shell-completion")
+		if err := runWithOutput(args, &buf); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.args, buf.String(), tt.want)
+		}
+	}
+}
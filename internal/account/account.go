@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/atclient"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
 	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/config"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 	"github.com/urfave/cli/v3"
 )
 
@@ -23,18 +26,33 @@ var CmdAccount = &cli.Command{
 			Usage: "Login with ATProto credentials",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "username",
-					Aliases:  []string{"u"},
-					Usage:    "Handle or DID",
-					Required: true,
-					Sources:  cli.EnvVars("ATP_USERNAME"),
+					Name:    "username",
+					Aliases: []string{"u"},
+					Usage:   "Handle or DID (required, except with --oauth and --pds-host)",
+					Sources: cli.EnvVars("ATP_USERNAME"),
 				},
 				&cli.StringFlag{
-					Name:     "password",
-					Aliases:  []string{"p"},
-					Usage:    "App password",
-					Required: true,
-					Sources:  cli.EnvVars("ATP_PASSWORD"),
+					Name:    "password",
+					Aliases: []string{"p"},
+					Usage:   "App password (prompted for if omitted; not needed with --oauth)",
+					Sources: cli.EnvVars("ATP_PASSWORD"),
+				},
+				&cli.StringFlag{
+					Name:  "auth-factor-token",
+					Usage: "Sign-in code emailed by the PDS for two-factor accounts (prompted for if required)",
+				},
+				&cli.StringFlag{
+					Name:  "name",
+					Usage: "Account profile to store the session under (default: active account)",
+				},
+				&cli.BoolFlag{
+					Name:    "token-only",
+					Usage:   "Store only tokens, never the app password (re-login needed when they expire)",
+					Sources: cli.EnvVars("HB_TOKEN_ONLY"),
+				},
+				&cli.BoolFlag{
+					Name:  "oauth",
+					Usage: "Login via ATProto OAuth in the browser instead of an app password",
 				},
 				&cli.StringFlag{
 					Name:    "pds-host",
@@ -45,8 +63,14 @@ var CmdAccount = &cli.Command{
 			Action: runAccountLogin,
 		},
 		{
-			Name:   "logout",
-			Usage:  "Delete current session",
+			Name:  "logout",
+			Usage: "Delete current session",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "revoke",
+					Usage: "Also invalidate the session on the server",
+				},
+			},
 			Action: runAccountLogout,
 		},
 		{
@@ -54,26 +78,74 @@ var CmdAccount = &cli.Command{
 			Usage:  "Check login status",
 			Action: runAccountStatus,
 		},
+		{
+			Name:   "list",
+			Usage:  "List stored account profiles",
+			Action: runAccountList,
+		},
+		{
+			Name:  "migrate",
+			Usage: "Re-encrypt stored sessions with the configured secret store",
+			Description: `Rewrite every stored session through the configured secret store.
+
+Set HB_PASSPHRASE or HB_KEY_FILE to encrypt plaintext session files.
+Use --token-only to also remove stored app passwords.`,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "token-only",
+					Usage: "Remove stored app passwords",
+				},
+			},
+			Action: runAccountMigrate,
+		},
+		{
+			Name:      "switch",
+			Usage:     "Set the default account profile",
+			ArgsUsage: "<profile|handle>",
+			Action:    runAccountSwitch,
+		},
+		cmdAppPassword,
 	},
 }
 
 func runAccountLogin(ctx context.Context, cmd *cli.Command) error {
-	var client *atclient.APIClient
-	var err error
+	if name := cmd.String("name"); name != "" {
+		if err := auth.ValidateAccountName(name); err != nil {
+			return err
+		}
+		auth.SelectAccountName(name)
+	}
 
-	pdsHost := cmd.String("pds-host")
+	if cmd.Bool("oauth") {
+		return runAccountLoginOAuth(ctx, cmd)
+	}
+
+	root := cmd.Root()
 	username := cmd.String("username")
+	if username == "" {
+		return hberr.New(hberr.Usage, "--username is required (or use --oauth)")
+	}
 	password := cmd.String("password")
+	if password == "" {
+		var err error
+		password, err = promptSecret(root.ErrWriter, root.Reader, "App password: ")
+		if err != nil {
+			return fmt.Errorf("reading app password: %w", err)
+		}
+		if password == "" {
+			return fmt.Errorf("--password is required (or use --oauth)")
+		}
+	}
 
-	if pdsHost != "" {
-		client, err = atclient.LoginWithPasswordHost(ctx, pdsHost, username, password, "", auth.AuthRefreshCallback)
-	} else {
-		atid, parseErr := syntax.ParseAtIdentifier(username)
-		if parseErr != nil {
-			return fmt.Errorf("invalid username: %w", parseErr)
+	pdsHost := cmd.String("pds-host")
+	authFactorToken := cmd.String("auth-factor-token")
+	client, err := passwordLogin(ctx, pdsHost, username, password, authFactorToken)
+	if auth.IsAuthFactorRequired(err) && authFactorToken == "" {
+		authFactorToken, err = promptLine(root.ErrWriter, root.Reader, "Enter the sign-in code sent to your email: ")
+		if err != nil {
+			return fmt.Errorf("sign-in code required (use --auth-factor-token): %w", err)
 		}
-		dir := auth.ConfigDirectory()
-		client, err = atclient.LoginWithPassword(ctx, dir, atid, password, "", auth.AuthRefreshCallback)
+		client, err = passwordLogin(ctx, pdsHost, username, password, authFactorToken)
 	}
 	if err != nil {
 		return fmt.Errorf("login failed: %w", err)
@@ -98,20 +170,120 @@ func runAccountLogin(ctx context.Context, cmd *cli.Command) error {
 		AccessToken:  passAuth.Session.AccessToken,
 		RefreshToken: passAuth.Session.RefreshToken,
 	}
+	if cmd.Bool("token-only") {
+		sess.Password = ""
+	}
 	if err := auth.PersistSession(&sess); err != nil {
 		return fmt.Errorf("failed to persist session: %w", err)
 	}
 
 	fmt.Fprintf(cmd.Root().Writer, "Logged in as %s (%s)\n", sessResp.Handle, sessResp.Did)
+	printAccountHint(cmd)
+	return nil
+}
+
+// passwordLogin creates a password session, on pdsHost if set or else on
+// the PDS the username resolves to
+func passwordLogin(ctx context.Context, pdsHost, username, password, authFactorToken string) (*atclient.APIClient, error) {
+	if pdsHost != "" {
+		return atclient.LoginWithPasswordHost(ctx, pdsHost, username, password, authFactorToken, auth.AuthRefreshCallback)
+	}
+	atid, err := syntax.ParseAtIdentifier(username)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username: %w", err)
+	}
+	return atclient.LoginWithPassword(ctx, auth.ConfigDirectory(), atid, password, authFactorToken, auth.AuthRefreshCallback)
+}
+
+// printAccountHint tells the user how to use a newly stored non-default profile
+func printAccountHint(cmd *cli.Command) {
+	name, _ := auth.ActiveAccount()
+	if name == auth.DefaultAccount {
+		return
+	}
+	fmt.Fprintf(cmd.Root().Writer, "Stored as account %q (use: hb --as %s ... or hb account switch %s)\n", name, name, name)
+}
+
+// runAccountLoginOAuth logs in through the browser-based OAuth flow.
+// With --pds-host, the flow starts at that auth server instead of resolving the username.
+func runAccountLoginOAuth(ctx context.Context, cmd *cli.Command) error {
+	w := cmd.Root().Writer
+
+	identifier := cmd.String("username")
+	if pdsHost := cmd.String("pds-host"); pdsHost != "" {
+		identifier = pdsHost
+	}
+	if identifier == "" {
+		return hberr.New(hberr.Usage, "--oauth needs --username or --pds-host (an auth server URL)")
+	}
+
+	data, err := auth.LoginOAuth(ctx, identifier, func(authURL string) {
+		fmt.Fprintf(w, "Open this URL in your browser to authorize hb:\n\n  %s\n\nWaiting for authorization...\n", authURL)
+		_ = auth.OpenBrowser(authURL)
+	})
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	// Get handle for display and persist it alongside the OAuth session
+	sessResp, err := comatproto.ServerGetSession(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to get session info: %w", err)
+	}
+
+	sess, err := auth.LoadSessionFile()
+	if err != nil {
+		return fmt.Errorf("failed to load session: %w", err)
+	}
+	sess.Handle = sessResp.Handle
+	if err := auth.PersistSession(sess); err != nil {
+		return fmt.Errorf("failed to persist session: %w", err)
+	}
+
+	fmt.Fprintf(w, "Logged in as %s (%s) via OAuth\n", sessResp.Handle, data.AccountDID)
+	printAccountHint(cmd)
 	return nil
 }
 
 func runAccountLogout(ctx context.Context, cmd *cli.Command) error {
+	w := cmd.Root().Writer
+
+	// An env session is never stored: only the server-side session can end
+	src := auth.CurrentSessionSource()
+	if !src.Persistent() {
+		if !cmd.Bool("revoke") {
+			return hberr.Errorf(hberr.Usage,
+				"the active session comes from the environment (%s=%s) and is not stored; unset it to log out of a stored account, or use --revoke to end the env session",
+				auth.EnvSessionSource, src.Name())
+		}
+		if err := auth.RevokeSession(ctx); err != nil {
+			return fmt.Errorf("failed to revoke %s session: %w", src.Name(), err)
+		}
+		fmt.Fprintf(w, "Revoked %s session (no stored session was changed)\n", src.Name())
+		return nil
+	}
+
+	if cmd.Bool("revoke") {
+		// Keep the local session on failure so the revoke can be retried
+		err := auth.RevokeSession(ctx)
+		if errors.Is(err, auth.ErrNoAuthSession) {
+			return fmt.Errorf("not logged in (run: hb account login)")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revoke session (local session kept; run without --revoke to remove it): %w", err)
+		}
+	}
+
 	err := auth.WipeSession()
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(cmd.Root().Writer, "Logged out")
+	fmt.Fprintf(w, "Logged out of account %s\n", src.Name())
 	return nil
 }
 
@@ -135,15 +307,85 @@ func runAccountStatus(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	w := cmd.Root().Writer
-	fmt.Fprintf(w, "DID:    %s\n", sessResp.Did)
-	fmt.Fprintf(w, "Handle: %s\n", sessResp.Handle)
-	fmt.Fprintf(w, "PDS:    %s\n", client.Host)
+	if src := auth.CurrentSessionSource(); src.Persistent() {
+		fmt.Fprintf(w, "Account: %s\n", src.Name())
+		fmt.Fprintln(w, "Source:  stored session")
+	} else {
+		fmt.Fprintf(w, "Source:  %s (%s, not stored)\n", src.Name(), auth.EnvSessionSource)
+	}
+	fmt.Fprintf(w, "DID:     %s\n", sessResp.Did)
+	fmt.Fprintf(w, "Handle:  %s\n", sessResp.Handle)
+	fmt.Fprintf(w, "PDS:     %s\n", client.Host)
 
 	if status.Activated {
-		fmt.Fprintln(w, "Status: active")
+		fmt.Fprintln(w, "Status:  active")
 	} else {
-		fmt.Fprintln(w, "Status: deactivated")
+		fmt.Fprintln(w, "Status:  deactivated")
+	}
+
+	// The agent runtime hb would record for commands run from here
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring repo agents: %v\n", err)
+		cfg = &config.Config{}
+	}
+	fmt.Fprintf(w, "Agent:   %s\n", cfg.Agent())
+
+	return nil
+}
+
+func runAccountList(ctx context.Context, cmd *cli.Command) error {
+	accounts, err := auth.ListAccounts()
+	if err != nil {
+		return fmt.Errorf("failed to list accounts: %w", err)
+	}
+
+	w := cmd.Root().Writer
+	if len(accounts) == 0 {
+		fmt.Fprintln(w, "No accounts (run: hb account login)")
+		return nil
+	}
+
+	active, err := auth.ActiveAccount()
+	if err != nil {
+		fmt.Fprintf(cmd.Root().ErrWriter, "warning: %v\n", err)
+	}
+	for _, acct := range accounts {
+		marker := " "
+		if acct.Name == active {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %-16s %-32s %s\n", marker, acct.Name, acct.Handle, acct.DID)
+	}
+	return nil
+}
+
+func runAccountSwitch(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("usage: hb account switch <profile|handle>")
+	}
+
+	name, err := auth.SwitchAccount(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.Root().Writer, "Switched to account %s\n", name)
+	return nil
+}
+
+func runAccountMigrate(ctx context.Context, cmd *cli.Command) error {
+	migrated, err := auth.MigrateSessions(cmd.Bool("token-only"))
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
 	}
 
+	w := cmd.Root().Writer
+	if len(migrated) == 0 {
+		fmt.Fprintln(w, "All sessions are already migrated")
+		return nil
+	}
+	for _, name := range migrated {
+		fmt.Fprintf(w, "Migrated account %s\n", name)
+	}
 	return nil
 }
@@ -0,0 +1,117 @@
+package account
+
+import (
+	"context"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/urfave/cli/v3"
+)
+
+// cmdAppPassword manages app passwords of the logged-in account
+var cmdAppPassword = &cli.Command{
+	Name:  "app-password",
+	Usage: "Create, list and revoke app passwords",
+	Description: `Manage app passwords on the PDS, e.g. to mint a dedicated password per agent.
+
+Creating app passwords needs a full-access session: log in with the
+account password or --oauth, not with an app password.`,
+	Commands: []*cli.Command{
+		{
+			Name:      "create",
+			Usage:     "Create a new app password",
+			ArgsUsage: "<name>",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "privileged",
+					Usage: "Allow access to direct messages",
+				},
+			},
+			Action: runAppPasswordCreate,
+		},
+		{
+			Name:   "list",
+			Usage:  "List app passwords",
+			Action: runAppPasswordList,
+		},
+		{
+			Name:      "revoke",
+			Usage:     "Revoke an app password",
+			ArgsUsage: "<name>",
+			Action:    runAppPasswordRevoke,
+		},
+	},
+}
+
+func runAppPasswordCreate(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("usage: hb account app-password create <name>")
+	}
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		return fmt.Errorf("auth failed: %w", err)
+	}
+
+	input := &comatproto.ServerCreateAppPassword_Input{Name: cmd.Args().First()}
+	if cmd.Bool("privileged") {
+		privileged := true
+		input.Privileged = &privileged
+	}
+	created, err := comatproto.ServerCreateAppPassword(ctx, client, input)
+	if err != nil {
+		return fmt.Errorf("failed to create app password: %w", err)
+	}
+
+	w := cmd.Root().Writer
+	fmt.Fprintf(w, "Created app password %q\n", created.Name)
+	fmt.Fprintf(w, "Password: %s\n", created.Password)
+	fmt.Fprintln(w, "Store it now; it cannot be shown again.")
+	return nil
+}
+
+func runAppPasswordList(ctx context.Context, cmd *cli.Command) error {
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		return fmt.Errorf("auth failed: %w", err)
+	}
+
+	out, err := comatproto.ServerListAppPasswords(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to list app passwords: %w", err)
+	}
+
+	w := cmd.Root().Writer
+	if len(out.Passwords) == 0 {
+		fmt.Fprintln(w, "No app passwords")
+		return nil
+	}
+	for _, p := range out.Passwords {
+		kind := ""
+		if p.Privileged != nil && *p.Privileged {
+			kind = "privileged"
+		}
+		fmt.Fprintf(w, "%-32s %-26s %s\n", p.Name, p.CreatedAt, kind)
+	}
+	return nil
+}
+
+func runAppPasswordRevoke(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("usage: hb account app-password revoke <name>")
+	}
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		return fmt.Errorf("auth failed: %w", err)
+	}
+
+	name := cmd.Args().First()
+	if err := comatproto.ServerRevokeAppPassword(ctx, client, &comatproto.ServerRevokeAppPassword_Input{Name: name}); err != nil {
+		return fmt.Errorf("failed to revoke app password: %w", err)
+	}
+	fmt.Fprintf(cmd.Root().Writer, "Revoked app password %q\n", name)
+	return nil
+}
@@ -0,0 +1,127 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/urfave/cli/v3"
+)
+
+// mockAppPasswordPDS keeps app passwords in memory
+func mockAppPasswordPDS(t *testing.T) *httptest.Server {
+	t.Helper()
+	passwords := map[string]bool{"existing": false}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "AuthenticationRequired"})
+			return
+		}
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.getSession":
+			json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:owner", "handle": "owner.test"})
+		case "/xrpc/com.atproto.server.createAppPassword":
+			var in struct {
+				Name       string `json:"name"`
+				Privileged bool   `json:"privileged"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			passwords[in.Name] = in.Privileged
+			json.NewEncoder(w).Encode(map[string]any{
+				"name":       in.Name,
+				"password":   "abcd-efgh-ijkl-mnop",
+				"createdAt":  "2026-01-01T00:00:00Z",
+				"privileged": in.Privileged,
+			})
+		case "/xrpc/com.atproto.server.listAppPasswords":
+			var list []map[string]any
+			for name, privileged := range passwords {
+				list = append(list, map[string]any{"name": name, "createdAt": "2026-01-01T00:00:00Z", "privileged": privileged})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"passwords": list})
+		case "/xrpc/com.atproto.server.revokeAppPassword":
+			var in struct {
+				Name string `json:"name"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			delete(passwords, in.Name)
+			json.NewEncoder(w).Encode(map[string]any{})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func runAccount(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := &cli.Command{Name: "hb", Writer: &out, ErrWriter: &out, Commands: []*cli.Command{CmdAccount}}
+	err := root.Run(context.Background(), append([]string{"hb", "account"}, args...))
+	return out.String(), err
+}
+
+func TestAppPasswordLifecycle(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	srv := mockAppPasswordPDS(t)
+	defer srv.Close()
+
+	if err := auth.PersistSession(&auth.Session{
+		DID:          syntax.DID("did:plc:owner"),
+		PDS:          srv.URL,
+		Handle:       "owner.test",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+	}); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	out, err := runAccount(t, "app-password", "create", "--privileged", "agent-1")
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !strings.Contains(out, "abcd-efgh-ijkl-mnop") {
+		t.Errorf("expected new password in output, got: %s", out)
+	}
+
+	out, err = runAccount(t, "app-password", "list")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out, "agent-1") || !strings.Contains(out, "privileged") || !strings.Contains(out, "existing") {
+		t.Errorf("unexpected list output: %s", out)
+	}
+
+	if _, err := runAccount(t, "app-password", "revoke", "agent-1"); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	out, _ = runAccount(t, "app-password", "list")
+	if strings.Contains(out, "agent-1") {
+		t.Errorf("revoked password still listed: %s", out)
+	}
+}
+
+func TestAppPasswordCreateRequiresName(t *testing.T) {
+	if _, err := runAccount(t, "app-password", "create"); err == nil {
+		t.Error("expected usage error without a name")
+	}
+}
+
+func TestLogoutRevokeNotLoggedIn(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	_, err := runAccount(t, "logout", "--revoke")
+	if err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Errorf("expected not logged in error, got %v", err)
+	}
+}
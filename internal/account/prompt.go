@@ -0,0 +1,59 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// promptSecret writes prompt to w and reads a secret from r. When r is a
+// terminal the input is not echoed; otherwise a single line is read, so
+// secrets can also be piped in.
+func promptSecret(w io.Writer, r io.Reader, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	if f, ok := r.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		secret, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(w)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+	return readLine(r)
+}
+
+// promptLine writes prompt to w and reads a line of input from r
+func promptLine(w io.Writer, r io.Reader, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	return readLine(r)
+}
+
+// readLine reads up to the next newline. It reads one byte at a time so
+// later prompts on the same reader see the remaining input.
+func readLine(r io.Reader) (string, error) {
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			sb.WriteByte(buf[0])
+		}
+		if errors.Is(err, io.EOF) {
+			if sb.Len() == 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
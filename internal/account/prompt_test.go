@@ -0,0 +1,45 @@
+package account
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPromptSecretFromPipe(t *testing.T) {
+	var out bytes.Buffer
+	in := strings.NewReader("s3cret\n123456\n")
+
+	secret, err := promptSecret(&out, in, "App password: ")
+	if err != nil {
+		t.Fatalf("promptSecret failed: %v", err)
+	}
+	if secret != "s3cret" {
+		t.Errorf("expected s3cret, got %q", secret)
+	}
+
+	// The second prompt must see the remaining input
+	code, err := promptLine(&out, in, "Code: ")
+	if err != nil {
+		t.Fatalf("promptLine failed: %v", err)
+	}
+	if code != "123456" {
+		t.Errorf("expected 123456, got %q", code)
+	}
+
+	if out.String() != "App password: Code: " {
+		t.Errorf("unexpected prompt output: %q", out.String())
+	}
+}
+
+func TestPromptLineEOF(t *testing.T) {
+	if _, err := promptLine(&bytes.Buffer{}, strings.NewReader(""), "Code: "); err == nil {
+		t.Error("expected error on empty input")
+	}
+
+	// A final line without newline is still read
+	got, err := promptLine(&bytes.Buffer{}, strings.NewReader("abc"), "Code: ")
+	if err != nil || got != "abc" {
+		t.Errorf("expected abc, got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package agent detects the agent runtime (the coding agent harness) hb
+// runs under from the environment it is given: the runtime's name, its
+// session ID and a hint of the model. Runtimes are recognised through a
+// built-in registry, which repos extend in .beads/hb.yaml.
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Variables hb sets for bd, so bd, its hooks and any nested hb see the
+// detected runtime. A harness may also set them itself; they take
+// precedence over the registry.
+const (
+	RuntimeEnv = "HB_AGENT_RUNTIME"
+	SessionEnv = "HB_AGENT_SESSION"
+	ModelEnv   = "HB_AGENT_MODEL"
+)
+
+// Runtime tells how to recognise an agent runtime from its environment
+type Runtime struct {
+	Name string `yaml:"name"`
+	// Detect are variables the runtime sets in the commands it runs
+	Detect []string `yaml:"detect,omitempty"`
+	// Session are variables holding the session ID; the first set wins.
+	// A set session variable also detects the runtime.
+	Session []string `yaml:"session,omitempty"`
+	// Model are variables naming the model; the first set wins
+	Model []string `yaml:"model,omitempty"`
+}
+
+// Info is a detected runtime. Runtime is empty if none was detected.
+type Info struct {
+	Runtime string `json:"runtime"`
+	Session string `json:"session,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
+
+// Builtin are the runtimes hb recognises without configuration
+var Builtin = []Runtime{
+	{Name: "claude-code", Detect: []string{"CLAUDECODE"}, Session: []string{"CLAUDE_SESSION_ID"}, Model: []string{"ANTHROPIC_MODEL"}},
+	{Name: "opencode", Detect: []string{"OPENCODE"}, Session: []string{"OPENCODE_SESSION"}},
+	{Name: "codex", Detect: []string{"CODEX_SANDBOX", "CODEX_SANDBOX_NETWORK_DISABLED"}},
+	{Name: "gemini-cli", Detect: []string{"GEMINI_CLI"}, Model: []string{"GEMINI_MODEL"}},
+}
+
+// Registry returns the runtimes to detect, in order: extra (from config)
+// first, then the built-in runtimes not redefined by extra
+func Registry(extra []Runtime) []Runtime {
+	names := make(map[string]bool, len(extra))
+	runtimes := make([]Runtime, 0, len(extra)+len(Builtin))
+	for _, r := range extra {
+		names[r.Name] = true
+		runtimes = append(runtimes, r)
+	}
+	for _, r := range Builtin {
+		if !names[r.Name] {
+			runtimes = append(runtimes, r)
+		}
+	}
+	return runtimes
+}
+
+// Check validates runtimes read from config
+func Check(runtimes []Runtime) error {
+	seen := make(map[string]bool, len(runtimes))
+	for i, r := range runtimes {
+		if r.Name == "" {
+			return fmt.Errorf("agents[%d]: name is required", i)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("agents: %s is defined twice", r.Name)
+		}
+		seen[r.Name] = true
+		if len(r.Detect) == 0 && len(r.Session) == 0 {
+			return fmt.Errorf("agents: %s needs detect or session variables", r.Name)
+		}
+	}
+	return nil
+}
+
+// Detect returns the runtime hb runs under. HB_AGENT_RUNTIME wins;
+// otherwise the first detected runtime with a session ID, or else the
+// first detected runtime, so a marker variable inherited from an outer
+// harness does not hide the session of an inner one.
+func Detect(runtimes []Runtime) Info {
+	if name := os.Getenv(RuntimeEnv); name != "" {
+		return Info{Runtime: name, Session: os.Getenv(SessionEnv), Model: os.Getenv(ModelEnv)}
+	}
+	var found Info
+	for _, r := range runtimes {
+		if firstEnv(r.Detect) == "" && firstEnv(r.Session) == "" {
+			continue
+		}
+		info := Info{Runtime: r.Name, Session: firstEnv(r.Session), Model: firstEnv(r.Model)}
+		if info.Session != "" {
+			return info
+		}
+		if found.Runtime == "" {
+			found = info
+		}
+	}
+	return found
+}
+
+// firstEnv returns the first non-empty of the named variables
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(strings.TrimSpace(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Env returns the variables that pass info on to child processes
+func (i Info) Env() []string {
+	if i.Runtime == "" {
+		return nil
+	}
+	env := []string{RuntimeEnv + "=" + i.Runtime}
+	if i.Session != "" {
+		env = append(env, SessionEnv+"="+i.Session)
+	}
+	if i.Model != "" {
+		env = append(env, ModelEnv+"="+i.Model)
+	}
+	return env
+}
+
+// String describes info for humans, e.g. "claude-code (session abc, model x)"
+func (i Info) String() string {
+	if i.Runtime == "" {
+		return "none detected"
+	}
+	var details []string
+	if i.Session != "" {
+		details = append(details, "session "+i.Session)
+	}
+	if i.Model != "" {
+		details = append(details, "model "+i.Model)
+	}
+	if len(details) == 0 {
+		return i.Runtime
+	}
+	return i.Runtime + " (" + strings.Join(details, ", ") + ")"
+}
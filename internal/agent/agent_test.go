@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+)
+
+// clearEnv unsets every variable the registry and hb read, so the tests
+// do not see the harness running them
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{RuntimeEnv, SessionEnv, ModelEnv} {
+		t.Setenv(name, "")
+	}
+	for _, r := range Builtin {
+		for _, name := range slices.Concat(r.Detect, r.Session, r.Model) {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Info
+	}{
+		{
+			name: "nothing set",
+			want: Info{},
+		},
+		{
+			name: "CLAUDE_SESSION_ID set",
+			env:  map[string]string{"CLAUDE_SESSION_ID": "claude-123"},
+			want: Info{Runtime: "claude-code", Session: "claude-123"},
+		},
+		{
+			name: "OPENCODE_SESSION set",
+			env:  map[string]string{"OPENCODE_SESSION": "oc-456"},
+			want: Info{Runtime: "opencode", Session: "oc-456"},
+		},
+		{
+			name: "both sessions set, claude-code wins",
+			env:  map[string]string{"CLAUDE_SESSION_ID": "claude-123", "OPENCODE_SESSION": "oc-456"},
+			want: Info{Runtime: "claude-code", Session: "claude-123"},
+		},
+		{
+			name: "marker only, with model",
+			env:  map[string]string{"GEMINI_CLI": "1", "GEMINI_MODEL": "gemini-2.5-pro"},
+			want: Info{Runtime: "gemini-cli", Model: "gemini-2.5-pro"},
+		},
+		{
+			name: "a session beats an outer runtime's marker",
+			env:  map[string]string{"CLAUDECODE": "1", "OPENCODE_SESSION": "oc-456"},
+			want: Info{Runtime: "opencode", Session: "oc-456"},
+		},
+		{
+			name: "explicit runtime wins",
+			env:  map[string]string{"CLAUDE_SESSION_ID": "claude-123", RuntimeEnv: "my-harness", SessionEnv: "s-1", ModelEnv: "m"},
+			want: Info{Runtime: "my-harness", Session: "s-1", Model: "m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if got := Detect(Builtin); got != tt.want {
+				t.Errorf("Detect = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	clearEnv(t)
+	extra := []Runtime{
+		{Name: "aider", Detect: []string{"AIDER_SESSION"}, Model: []string{"AIDER_MODEL"}},
+		{Name: "opencode", Session: []string{"OPENCODE_SESSION_ID"}},
+	}
+	runtimes := Registry(extra)
+
+	var names []string
+	for _, r := range runtimes {
+		names = append(names, r.Name)
+	}
+	if want := []string{"aider", "opencode", "claude-code", "codex", "gemini-cli"}; !slices.Equal(names, want) {
+		t.Errorf("Registry names = %v, want %v", names, want)
+	}
+
+	t.Setenv("AIDER_SESSION", "1")
+	t.Setenv("AIDER_MODEL", "sonnet")
+	if got := Detect(runtimes); got != (Info{Runtime: "aider", Model: "sonnet"}) {
+		t.Errorf("Detect = %+v, want the configured aider runtime", got)
+	}
+
+	// A redefined runtime replaces the built-in one
+	t.Setenv("AIDER_SESSION", "")
+	t.Setenv("OPENCODE_SESSION", "old")
+	t.Setenv("OPENCODE_SESSION_ID", "new")
+	if got := Detect(runtimes); got.Session != "new" {
+		t.Errorf("Detect = %+v, want the configured opencode session", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check([]Runtime{{Name: "aider", Detect: []string{"AIDER_SESSION"}}}); err != nil {
+		t.Errorf("valid runtime rejected: %v", err)
+	}
+	for _, runtimes := range [][]Runtime{
+		{{Detect: []string{"X"}}},
+		{{Name: "x"}},
+		{{Name: "x", Detect: []string{"X"}}, {Name: "x", Session: []string{"Y"}}},
+	} {
+		if err := Check(runtimes); err == nil {
+			t.Errorf("Check(%+v) should fail", runtimes)
+		}
+	}
+}
+
+func TestInfoEnvAndString(t *testing.T) {
+	info := Info{Runtime: "claude-code", Session: "abc", Model: "opus"}
+	if got, want := info.Env(), []string{"HB_AGENT_RUNTIME=claude-code", "HB_AGENT_SESSION=abc", "HB_AGENT_MODEL=opus"}; !slices.Equal(got, want) {
+		t.Errorf("Env = %v, want %v", got, want)
+	}
+	if got := info.String(); got != "claude-code (session abc, model opus)" {
+		t.Errorf("String = %q", got)
+	}
+	if (Info{}).Env() != nil || (Info{}).String() != "none detected" {
+		t.Error("an undetected runtime should add no env and read as none detected")
+	}
+}
@@ -0,0 +1,220 @@
+// Package alias keeps a local map between ATProto DIDs and their handles.
+// It lets hb record stable DIDs as bd actors while still showing and
+// accepting the current handles.
+package alias
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/adrg/xdg"
+)
+
+// aliasFile is the XDG-relative state path of the alias map
+const aliasFile = "heartbeads/aliases.json"
+
+// DefaultTTL is how long an alias is trusted before the handle is resolved again
+const DefaultTTL = 24 * time.Hour
+
+// lookupTimeout bounds a single directory lookup during output rewriting
+const lookupTimeout = 5 * time.Second
+
+// Entry is the last known handle of a DID
+type Entry struct {
+	Handle    string    `json:"handle"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Map maps DIDs to their last known handles
+type Map struct {
+	DIDs map[string]Entry `json:"dids"`
+
+	dirty bool
+}
+
+// Load reads the alias map from the XDG state directory. A missing file
+// yields an empty map.
+func Load() (*Map, error) {
+	m := &Map{DIDs: make(map[string]Entry)}
+
+	path, err := xdg.SearchStateFile(aliasFile)
+	if err != nil {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.DIDs == nil {
+		m.DIDs = make(map[string]Entry)
+	}
+	return m, nil
+}
+
+// Save writes the map if it changed since Load. The file is replaced
+// atomically so concurrent hb processes never see a partial map.
+func (m *Map) Save() error {
+	if !m.dirty {
+		return nil
+	}
+	path, err := xdg.StateFile(aliasFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+// Set records handle as the current handle of did
+func (m *Map) Set(did, handle string) {
+	if did == "" || handle == "" {
+		return
+	}
+	if e, ok := m.DIDs[did]; ok && e.Handle == handle && time.Since(e.UpdatedAt) < DefaultTTL {
+		return
+	}
+	// A handle belongs to one DID at a time
+	for other, e := range m.DIDs {
+		if other != did && strings.EqualFold(e.Handle, handle) {
+			delete(m.DIDs, other)
+		}
+	}
+	m.DIDs[did] = Entry{Handle: handle, UpdatedAt: time.Now()}
+	m.dirty = true
+}
+
+// Handle returns the last known handle of did, or "" if unknown
+func (m *Map) Handle(did string) string {
+	return m.DIDs[did].Handle
+}
+
+// DID returns the DID whose last known handle is handle, or "" if unknown
+func (m *Map) DID(handle string) string {
+	for did, e := range m.DIDs {
+		if strings.EqualFold(e.Handle, handle) {
+			return did
+		}
+	}
+	return ""
+}
+
+// Resolve returns the current handle of did. Fresh aliases are used as-is;
+// otherwise did is looked up in dir and the alias updated. If the lookup
+// fails, a stale alias is still better than nothing. Returns "" if the
+// handle is unknown.
+func (m *Map) Resolve(ctx context.Context, dir identity.Directory, did string) string {
+	if !m.stale(did) {
+		return m.Handle(did)
+	}
+	if handle := lookupHandle(ctx, dir, did); handle != "" {
+		m.Set(did, handle)
+		return handle
+	}
+	return m.Handle(did)
+}
+
+// stale reports whether did has no alias, or one older than DefaultTTL
+func (m *Map) stale(did string) bool {
+	e, ok := m.DIDs[did]
+	return !ok || time.Since(e.UpdatedAt) >= DefaultTTL
+}
+
+// lookupHandle resolves the handle of did in dir, or returns "" on failure
+func lookupHandle(ctx context.Context, dir identity.Directory, did string) string {
+	parsed, err := syntax.ParseDID(did)
+	if err != nil || dir == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	ident, err := dir.LookupDID(ctx, parsed)
+	if err != nil || ident.Handle.IsInvalidHandle() {
+		return ""
+	}
+	return ident.Handle.String()
+}
+
+// Resolver answers handle lookups from the local map only, so it never
+// blocks on the network, and refreshes unknown or stale DIDs in the
+// background for later lookups and runs. It is safe for concurrent use.
+type Resolver struct {
+	ctx context.Context
+	m   *Map
+	dir identity.Directory
+
+	mu      sync.Mutex
+	pending map[string]bool
+	wg      sync.WaitGroup
+}
+
+// NewResolver returns a Resolver over m that refreshes aliases from dir
+func NewResolver(ctx context.Context, m *Map, dir identity.Directory) *Resolver {
+	return &Resolver{ctx: ctx, m: m, dir: dir, pending: make(map[string]bool)}
+}
+
+// Handle returns the known handle of did, or "" if unknown, and starts a
+// background lookup if the alias is missing or stale
+func (r *Resolver) Handle(did string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.m.stale(did) && !r.pending[did] {
+		r.pending[did] = true
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			handle := lookupHandle(r.ctx, r.dir, did)
+			if handle == "" {
+				return
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.m.Set(did, handle)
+		}()
+	}
+	return r.m.Handle(did)
+}
+
+// Wait blocks until background lookups finish, after which the map holds
+// their results and can be saved
+func (r *Resolver) Wait() {
+	r.wg.Wait()
+}
@@ -0,0 +1,139 @@
+package alias
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+const testDID = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+func setupTestXDG(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+}
+
+func TestSetAndLookup(t *testing.T) {
+	m := &Map{DIDs: make(map[string]Entry)}
+	m.Set(testDID, "alice.bsky.social")
+
+	if got := m.Handle(testDID); got != "alice.bsky.social" {
+		t.Errorf("Handle = %q", got)
+	}
+	if got := m.DID("Alice.bsky.social"); got != testDID {
+		t.Errorf("DID = %q (handles are case-insensitive)", got)
+	}
+
+	// A handle moved to another DID no longer maps to the old one
+	m.Set("did:plc:other", "alice.bsky.social")
+	if got := m.Handle(testDID); got != "" {
+		t.Errorf("expected old alias to be dropped, got %q", got)
+	}
+	if got := m.DID("alice.bsky.social"); got != "did:plc:other" {
+		t.Errorf("DID = %q", got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	setupTestXDG(t)
+
+	m, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(m.DIDs) != 0 {
+		t.Fatalf("expected empty map, got %v", m.DIDs)
+	}
+
+	m.Set(testDID, "alice.bsky.social")
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := loaded.Handle(testDID); got != "alice.bsky.social" {
+		t.Errorf("Handle after reload = %q", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID(testDID), Handle: syntax.Handle("alice-new.bsky.social")})
+	ctx := context.Background()
+
+	t.Run("fresh alias skips lookup", func(t *testing.T) {
+		m := &Map{DIDs: map[string]Entry{testDID: {Handle: "alice.bsky.social", UpdatedAt: time.Now()}}}
+		if got := m.Resolve(ctx, dir, testDID); got != "alice.bsky.social" {
+			t.Errorf("Resolve = %q", got)
+		}
+	})
+
+	t.Run("stale alias is refreshed", func(t *testing.T) {
+		m := &Map{DIDs: map[string]Entry{testDID: {Handle: "alice.bsky.social", UpdatedAt: time.Now().Add(-2 * DefaultTTL)}}}
+		if got := m.Resolve(ctx, dir, testDID); got != "alice-new.bsky.social" {
+			t.Errorf("Resolve = %q", got)
+		}
+		if got := m.DID("alice-new.bsky.social"); got != testDID {
+			t.Errorf("alias not updated, DID = %q", got)
+		}
+	})
+
+	t.Run("lookup failure keeps stale alias", func(t *testing.T) {
+		m := &Map{DIDs: map[string]Entry{"did:plc:gone": {Handle: "gone.test", UpdatedAt: time.Now().Add(-2 * DefaultTTL)}}}
+		if got := m.Resolve(ctx, dir, "did:plc:gone"); got != "gone.test" {
+			t.Errorf("Resolve = %q", got)
+		}
+	})
+
+	t.Run("unknown DID", func(t *testing.T) {
+		m := &Map{DIDs: make(map[string]Entry)}
+		if got := m.Resolve(ctx, dir, "did:plc:unknown"); got != "" {
+			t.Errorf("Resolve = %q", got)
+		}
+	})
+}
+
+// blockingDirectory holds every lookup until release is closed
+type blockingDirectory struct {
+	identity.Directory
+	release chan struct{}
+}
+
+func (b *blockingDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	<-b.release
+	return b.Directory.LookupDID(ctx, did)
+}
+
+func TestResolverDoesNotBlock(t *testing.T) {
+	mock := identity.NewMockDirectory()
+	mock.Insert(identity.Identity{DID: syntax.DID(testDID), Handle: syntax.Handle("alice-new.bsky.social")})
+	dir := &blockingDirectory{Directory: mock, release: make(chan struct{})}
+
+	m := &Map{DIDs: map[string]Entry{"did:plc:known": {Handle: "known.test", UpdatedAt: time.Now()}}}
+	r := NewResolver(context.Background(), m, dir)
+
+	// Answers come from the local map while the lookup is still pending
+	if got := r.Handle(testDID); got != "" {
+		t.Errorf("Handle of unknown DID = %q, want empty", got)
+	}
+	if got := r.Handle(testDID); got != "" {
+		t.Errorf("Handle of pending DID = %q, want empty", got)
+	}
+	if got := r.Handle("did:plc:known"); got != "known.test" {
+		t.Errorf("Handle of known DID = %q", got)
+	}
+
+	close(dir.release)
+	r.Wait()
+	if got := m.Handle(testDID); got != "alice-new.bsky.social" {
+		t.Errorf("background lookup not recorded, Handle = %q", got)
+	}
+}
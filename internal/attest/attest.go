@@ -0,0 +1,253 @@
+// Package attest records signed attestations of mutating bd commands in
+// the actor's ATProto repo. Records are signed by the PDS as part of the
+// repo commit, so an action cannot be forged by editing the beads JSONL.
+package attest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// ActionCollection is the ATProto lexicon for beads action attestations
+const ActionCollection = "org.impactindexer.beads.action"
+
+// BeadsURIPrefix is the prefix of subject URIs targeting beads issues.
+// It matches the one used by comments, so indexers can join the two.
+const BeadsURIPrefix = "beads:"
+
+// attestedCommands are the bd subcommands that produce an attestation
+var attestedCommands = map[string]bool{
+	"create": true,
+	"update": true,
+	"close":  true,
+	"delete": true,
+	"reopen": true,
+}
+
+// ShouldAttest reports whether the bd subcommand in args[0] is attested
+func ShouldAttest(args []string) bool {
+	return len(args) > 0 && attestedCommands[args[0]]
+}
+
+// valueFlags are the bd flags known to take a value, on the commands whose
+// positional arguments are issue IDs. Any other flag is treated as taking
+// no value, so a flag missing from this list can at worst make its value
+// look like an issue ID, never hide the ID that follows it.
+var valueFlags = map[string]bool{
+	// global flags
+	"--actor":        true,
+	"--db":           true,
+	"--lock-timeout": true,
+	"--session":      true,
+	// update
+	"--status":       true,
+	"-s":             true,
+	"--priority":     true,
+	"-p":             true,
+	"--title":        true,
+	"--assignee":     true,
+	"-a":             true,
+	"--description":  true,
+	"-d":             true,
+	"--design":       true,
+	"--notes":        true,
+	"--append-notes": true,
+	"--acceptance":   true,
+	"--external-ref": true,
+	"--estimate":     true,
+	"-e":             true,
+	"--type":         true,
+	"-t":             true,
+	"--add-label":    true,
+	"--remove-label": true,
+	"--set-labels":   true,
+	"--parent":       true,
+	"--due":          true,
+	"--defer":        true,
+	"--spec-id":      true,
+	"--body-file":    true,
+	// close, reopen
+	"--reason": true,
+	"-r":       true,
+	// delete
+	"--from-file": true,
+}
+
+// issueIDPattern matches bd issue IDs like bd-a1b2 or bd-a1b2.1
+var issueIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*-[A-Za-z0-9]+(\.[0-9]+)*$`)
+
+// createdPattern finds the new issue ID in human-readable `bd create` output
+var createdPattern = regexp.MustCompile(`Created issue:?\s+([A-Za-z][A-Za-z0-9_]*-[A-Za-z0-9]+(?:\.[0-9]+)*)`)
+
+// IssueIDs returns the issues affected by a bd command: the positional
+// issue IDs for update/close/delete/reopen, or the new issue parsed from
+// stdout for create and q. For `label add|remove`, the label after the
+// IDs is left out.
+func IssueIDs(args []string, stdout []byte) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	if args[0] == "create" || args[0] == "q" {
+		if id := createdID(stdout); id != "" {
+			return []string{id}
+		}
+		return nil
+	}
+
+	var positionals []string
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if !strings.Contains(arg, "=") && valueFlags[arg] {
+				i++ // skip the flag value
+			}
+			continue
+		}
+		positionals = append(positionals, arg)
+	}
+	if args[0] == "label" && len(positionals) > 0 && (positionals[0] == "add" || positionals[0] == "remove") {
+		// bd label add|remove <issue-id...> <label>
+		positionals = positionals[1:max(len(positionals)-1, 1)]
+	}
+
+	var ids []string
+	for _, arg := range positionals {
+		if issueIDPattern.MatchString(arg) {
+			ids = append(ids, arg)
+		}
+	}
+	return ids
+}
+
+// createdID extracts the ID of a new issue from `bd create` output,
+// which is either JSON (with --json) or human-readable text, or from
+// `bd q` output, which is the bare ID
+func createdID(stdout []byte) string {
+	trimmed := bytes.TrimSpace(stdout)
+	if issueIDPattern.Match(trimmed) {
+		return string(trimmed)
+	}
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var issue struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(trimmed, &issue); err == nil {
+			return issue.ID
+		}
+	}
+	if m := createdPattern.FindSubmatch(stdout); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// NormalizeArgs returns args in a canonical form for attestation:
+// "--flag=value" is split into "--flag", "value", so equivalent
+// invocations produce identical records.
+func NormalizeArgs(args []string) []string {
+	normalized := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			if flag, value, ok := strings.Cut(arg, "="); ok {
+				normalized = append(normalized, flag, value)
+				continue
+			}
+		}
+		normalized = append(normalized, arg)
+	}
+	return normalized
+}
+
+// IssueHash returns the SHA-256 of the canonical JSON encoding of an issue
+// as printed by `bd show --json`. Object keys are sorted, so the hash does
+// not depend on bd's field order or formatting.
+func IssueHash(issueJSON []byte) (string, error) {
+	var v any
+	if err := json.Unmarshal(issueJSON, &v); err != nil {
+		return "", err
+	}
+	// bd show --json prints a list, even for a single issue
+	if list, ok := v.([]any); ok && len(list) == 1 {
+		v = list[0]
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Action describes one attested change to an issue
+type Action struct {
+	IssueID   string
+	Operation string
+	Args      []string
+	// IssueHash is the hash of the issue after the change ("" if deleted)
+	IssueHash string
+}
+
+// actionRecord is the record structure for a beads action attestation
+type actionRecord struct {
+	Type      string        `json:"$type"`
+	Subject   actionSubject `json:"subject"`
+	IssueID   string        `json:"issueId"`
+	Operation string        `json:"operation"`
+	Args      []string      `json:"args"`
+	IssueHash string        `json:"issueHash,omitempty"`
+	CreatedAt string        `json:"createdAt"`
+}
+
+// actionSubject identifies the issue the action changed
+type actionSubject struct {
+	URI  string `json:"uri"`
+	Type string `json:"type"`
+}
+
+// createRecordRequest is the request body for com.atproto.repo.createRecord
+type createRecordRequest struct {
+	Repo       string       `json:"repo"`
+	Collection string       `json:"collection"`
+	Record     actionRecord `json:"record"`
+}
+
+// Output is the result of writing an attestation
+type Output struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// Create writes an attestation for action to the repo of did
+func Create(ctx context.Context, client *atclient.APIClient, did string, action Action) (*Output, error) {
+	reqBody := createRecordRequest{
+		Repo:       did,
+		Collection: ActionCollection,
+		Record: actionRecord{
+			Type: ActionCollection,
+			Subject: actionSubject{
+				URI:  BeadsURIPrefix + action.IssueID,
+				Type: "record",
+			},
+			IssueID:   action.IssueID,
+			Operation: action.Operation,
+			Args:      action.Args,
+			IssueHash: action.IssueHash,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	var output Output
+	if err := client.Post(ctx, syntax.NSID("com.atproto.repo.createRecord"), reqBody, &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
@@ -0,0 +1,178 @@
+package attest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+)
+
+func TestShouldAttest(t *testing.T) {
+	for _, cmd := range []string{"create", "update", "close", "delete", "reopen"} {
+		if !ShouldAttest([]string{cmd}) {
+			t.Errorf("%s should be attested", cmd)
+		}
+	}
+	for _, args := range [][]string{{"list"}, {"show", "bd-1"}, {"dep", "add"}, {}} {
+		if ShouldAttest(args) {
+			t.Errorf("%v should not be attested", args)
+		}
+	}
+}
+
+func TestIssueIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stdout string
+		want   []string
+	}{
+		{
+			name: "close with reason",
+			args: []string{"close", "bd-a1b2", "--reason", "abc1234 fix-it", "--actor", "alice-b.test"},
+			want: []string{"bd-a1b2"},
+		},
+		{
+			name: "several issues and boolean flags",
+			args: []string{"update", "--json", "bd-a1b2", "bd-c3d4.1", "--status=in_progress", "--claim"},
+			want: []string{"bd-a1b2", "bd-c3d4.1"},
+		},
+		{
+			name: "unknown boolean flag before the ID",
+			args: []string{"delete", "--hard", "bd-a1b2"},
+			want: []string{"bd-a1b2"},
+		},
+		{
+			name: "short value flags",
+			args: []string{"update", "-s", "open", "-p", "1", "-a", "bob-smith", "bd-a1b2"},
+			want: []string{"bd-a1b2"},
+		},
+		{
+			name: "label add leaves out the label",
+			args: []string{"label", "add", "bd-a1b2", "bd-c3d4", "my-label"},
+			want: []string{"bd-a1b2", "bd-c3d4"},
+		},
+		{
+			name: "label remove without a label",
+			args: []string{"label", "remove", "bd-a1b2"},
+			want: nil,
+		},
+		{
+			name: "label list",
+			args: []string{"label", "list", "bd-a1b2"},
+			want: []string{"bd-a1b2"},
+		},
+		{
+			name:   "quick capture prints the bare ID",
+			args:   []string{"q", "Fix login"},
+			stdout: "bd-x9y8\n",
+			want:   []string{"bd-x9y8"},
+		},
+		{
+			name:   "create with text output",
+			args:   []string{"create", "Fix login", "--type", "bug"},
+			stdout: "✓ Created issue: bd-x9y8\n  Title: Fix login\n",
+			want:   []string{"bd-x9y8"},
+		},
+		{
+			name:   "create with JSON output",
+			args:   []string{"create", "Fix login", "--json"},
+			stdout: `{"id":"bd-x9y8","title":"Fix login"}`,
+			want:   []string{"bd-x9y8"},
+		},
+		{
+			name:   "create without recognizable output",
+			args:   []string{"create", "Fix login"},
+			stdout: "done\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IssueIDs(tt.args, []byte(tt.stdout))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	a := NormalizeArgs([]string{"bd-1", "--reason=abc1234 fix", "-r", "x"})
+	b := NormalizeArgs([]string{"bd-1", "--reason", "abc1234 fix", "-r", "x"})
+	if !slices.Equal(a, b) {
+		t.Errorf("equivalent args normalized differently: %v vs %v", a, b)
+	}
+}
+
+func TestIssueHash(t *testing.T) {
+	h1, err := IssueHash([]byte(`[{"id":"bd-1","title":"A","status":"open"}]`))
+	if err != nil {
+		t.Fatalf("IssueHash failed: %v", err)
+	}
+	h2, err := IssueHash([]byte("{\n  \"status\": \"open\",\n  \"title\": \"A\",\n  \"id\": \"bd-1\"\n}"))
+	if err != nil {
+		t.Fatalf("IssueHash failed: %v", err)
+	}
+	if h1 != h2 {
+		t.Errorf("hash depends on formatting: %s vs %s", h1, h2)
+	}
+	if !strings.HasPrefix(h1, "sha256:") {
+		t.Errorf("unexpected hash format: %s", h1)
+	}
+
+	h3, _ := IssueHash([]byte(`{"id":"bd-1","title":"A","status":"closed"}`))
+	if h3 == h1 {
+		t.Error("different issues should hash differently")
+	}
+
+	if _, err := IssueHash([]byte("not json")); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestCreate(t *testing.T) {
+	var got createRecordRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.createRecord" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"uri": "at://did:plc:alice/" + ActionCollection + "/3abc",
+			"cid": "bafyrei",
+		})
+	}))
+	defer srv.Close()
+
+	client := atclient.NewAPIClient(srv.URL)
+	out, err := Create(context.Background(), client, "did:plc:alice", Action{
+		IssueID:   "bd-1",
+		Operation: "close",
+		Args:      []string{"bd-1", "--reason", "abc1234 fix"},
+		IssueHash: "sha256:00",
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.Contains(out.URI, ActionCollection) {
+		t.Errorf("unexpected URI: %s", out.URI)
+	}
+
+	if got.Collection != ActionCollection || got.Record.Type != ActionCollection {
+		t.Errorf("wrong collection: %s / %s", got.Collection, got.Record.Type)
+	}
+	if got.Repo != "did:plc:alice" {
+		t.Errorf("wrong repo: %s", got.Repo)
+	}
+	if got.Record.Subject.URI != "beads:bd-1" || got.Record.Operation != "close" || got.Record.IssueHash != "sha256:00" {
+		t.Errorf("unexpected record: %+v", got.Record)
+	}
+}
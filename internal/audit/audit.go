@@ -0,0 +1,167 @@
+// Package audit keeps a local append-only log of hb actions as JSONL in the
+// XDG state directory: every proxied bd command, native writes like
+// `comment add`, and commands refused by policy.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// auditFile is the XDG-relative state path of the audit log
+const auditFile = "heartbeads/audit.jsonl"
+
+// Decisions recorded for commands that never ran to completion: refused by
+// the repo policy, aborted by a pre hook, or bd failed to start
+const (
+	DecisionDenied  = "denied"
+	DecisionAborted = "aborted"
+	DecisionFailed  = "failed"
+)
+
+// Entry is one audit log line
+type Entry struct {
+	Time    time.Time `json:"time"`
+	DID     string    `json:"did,omitempty"`
+	Handle  string    `json:"handle,omitempty"`
+	Session string    `json:"session,omitempty"`
+	// Agent and Model describe the agent runtime hb ran under, if any
+	Agent   string `json:"agent,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Command string `json:"command"`
+	// Args are the final arguments, after flag injection
+	Args     []string `json:"args,omitempty"`
+	ExitCode int      `json:"exit_code"`
+	// DurationMS is the wall time of the command in milliseconds
+	DurationMS int64    `json:"duration_ms,omitempty"`
+	Issues     []string `json:"issues,omitempty"`
+
+	// Decision is set when the command did not run to completion, see
+	// DecisionDenied
+	Decision string `json:"decision,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Path returns the audit log path, creating its directory
+func Path() (string, error) {
+	return xdg.StateFile(auditFile)
+}
+
+// Append writes e to the audit log. Time defaults to now.
+func Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// One write per entry: O_APPEND keeps concurrent hb processes from
+	// interleaving lines
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Record appends e to the audit log. The logged action has already run,
+// so a write failure is only reported as a warning on stderr.
+func Record(e Entry) {
+	if err := Append(e); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+}
+
+// Filter selects audit entries. Zero fields match everything.
+type Filter struct {
+	Issue string
+	// Actor matches the DID or the handle (case-insensitive)
+	Actor   string
+	Session string
+	Agent   string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	if f.Issue != "" && !contains(e.Issues, f.Issue) {
+		return false
+	}
+	if f.Actor != "" {
+		actor := strings.TrimPrefix(f.Actor, "@")
+		if e.DID != actor && !strings.EqualFold(e.Handle, actor) {
+			return false
+		}
+	}
+	if f.Session != "" && e.Session != f.Session {
+		return false
+	}
+	if f.Agent != "" && e.Agent != f.Agent {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Read returns the entries matching filter, oldest first. A missing log
+// yields no entries; malformed lines are skipped.
+func Read(filter Filter) ([]Entry, error) {
+	path, err := xdg.SearchStateFile(auditFile)
+	if err != nil {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if filter.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+func TestAppend(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	for _, cmd := range []string{"delete", "config"} {
+		if err := Append(Entry{Handle: "bot.test", Command: cmd, Decision: DecisionDenied}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	path, err := Path()
+	if err != nil {
+		t.Fatalf("Path failed: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Command != "delete" || entries[1].Command != "config" {
+		t.Errorf("entries out of order: %+v", entries)
+	}
+	if entries[0].Time.IsZero() {
+		t.Error("Time should default to now")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %o, want 600", info.Mode().Perm())
+	}
+}
+
+func TestRecordWarnsOnFailure(t *testing.T) {
+	// A state "directory" that is a file makes the log unwritable
+	state := t.TempDir() + "/state"
+	if err := os.WriteFile(state, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_STATE_HOME", state)
+	xdg.Reload()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	Record(Entry{Command: "close"})
+	os.Stderr = stderr
+	w.Close()
+
+	out, _ := io.ReadAll(r)
+	if !strings.Contains(string(out), "warning: failed to write audit log") {
+		t.Errorf("expected a warning, got %q", out)
+	}
+}
+
+func TestReadFilter(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: base, DID: "did:plc:alice", Handle: "alice.test", Session: "s1", Command: "create", Issues: []string{"bd-1"}},
+		{Time: base.Add(time.Hour), DID: "did:plc:bot", Handle: "bot.test", Session: "s2", Agent: "codex", Command: "update", Issues: []string{"bd-1"}},
+		{Time: base.Add(2 * time.Hour), DID: "did:plc:alice", Handle: "alice.test", Session: "s1", Command: "close", Issues: []string{"bd-2"}},
+	}
+	for _, e := range entries {
+		if err := Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "all", filter: Filter{}, want: []string{"create", "update", "close"}},
+		{name: "issue", filter: Filter{Issue: "bd-1"}, want: []string{"create", "update"}},
+		{name: "actor handle", filter: Filter{Actor: "@Alice.test"}, want: []string{"create", "close"}},
+		{name: "actor DID", filter: Filter{Actor: "did:plc:bot"}, want: []string{"update"}},
+		{name: "session", filter: Filter{Session: "s2"}, want: []string{"update"}},
+		{name: "agent", filter: Filter{Agent: "codex"}, want: []string{"update"}},
+		{name: "time range", filter: Filter{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)}, want: []string{"update"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(tt.filter)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			var commands []string
+			for _, e := range got {
+				commands = append(commands, e.Command)
+			}
+			if strings.Join(commands, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", commands, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMissingLog(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	entries, err := Read(Filter{})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Read = %v, %v; want no entries", entries, err)
+	}
+}
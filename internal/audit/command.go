@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/urfave/cli/v3"
+)
+
+// CmdAudit is the "audit" command
+var CmdAudit = &cli.Command{
+	Name:  "audit",
+	Usage: "Query the local audit log of hb commands",
+	Description: `Show who ran what through hb on this machine.
+
+Every proxied bd command, every comment add, and every command refused by
+the repo policy is appended to ~/.local/state/heartbeads/audit.jsonl with
+the actor's DID and handle, the agent runtime, model and session, the
+final arguments after flag injection, the exit code, the duration and the
+affected issues.
+
+--since and --until take an RFC 3339 time, a date (2006-01-02), or a
+duration back from now (e.g. 24h).
+
+Examples:
+  hb audit                              Last 20 entries
+  hb audit --issue bd-a1b2              Everything that touched bd-a1b2
+  hb audit --actor alice.bsky.social    Commands run as alice
+  hb audit --session $CLAUDE_SESSION_ID One agent session
+  hb audit --agent codex                Commands run under one agent runtime
+  hb audit --since 24h --json           Last day, as JSON lines`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "issue",
+			Usage: "Only entries affecting this issue",
+		},
+		&cli.StringFlag{
+			Name:  "actor",
+			Usage: "Only entries by this handle or DID",
+		},
+		&cli.StringFlag{
+			Name:  "session",
+			Usage: "Only entries from this agent session",
+		},
+		&cli.StringFlag{
+			Name:  "agent",
+			Usage: "Only entries from this agent runtime (e.g. claude-code)",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "Only entries at or after this time",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "Only entries before this time",
+		},
+		&cli.IntFlag{
+			Name:    "n",
+			Aliases: []string{"limit"},
+			Usage:   "Show at most the last N entries (0 for all)",
+			Value:   20,
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output entries as JSON lines",
+		},
+	},
+	Action: runAudit,
+}
+
+func runAudit(ctx context.Context, cmd *cli.Command) error {
+	now := time.Now()
+	filter := Filter{
+		Issue:   cmd.String("issue"),
+		Actor:   cmd.String("actor"),
+		Session: cmd.String("session"),
+		Agent:   cmd.String("agent"),
+	}
+	var err error
+	if filter.Since, err = ParseTime(cmd.String("since"), now); err != nil {
+		return hberr.Errorf(hberr.Usage, "invalid --since: %w", err)
+	}
+	if filter.Until, err = ParseTime(cmd.String("until"), now); err != nil {
+		return hberr.Errorf(hberr.Usage, "invalid --until: %w", err)
+	}
+
+	entries, err := Read(filter)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if n := int(cmd.Int("n")); n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	w := cmd.Root().Writer
+	if cmd.Bool("json") {
+		return FormatJSON(w, entries)
+	}
+	FormatText(w, entries)
+	return nil
+}
+
+// ParseTime parses an RFC 3339 time, a date, or a duration before now.
+// The empty string yields the zero time.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, date or duration", value)
+}
+
+// FormatJSON writes entries as JSON lines, like the log itself
+func FormatJSON(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatText writes one line per entry
+func FormatText(w io.Writer, entries []Entry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No audit entries")
+		return
+	}
+	for _, e := range entries {
+		actor := e.Handle
+		if actor == "" {
+			actor = e.DID
+		}
+		status := fmt.Sprintf("exit %d", e.ExitCode)
+		if e.Decision != "" {
+			status = e.Decision
+		}
+		line := strings.TrimSpace(e.Command + " " + strings.Join(e.Args, " "))
+		fmt.Fprintf(w, "%s  %-24s %-8s %6s  %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), actor, status, formatDuration(e.DurationMS), line)
+	}
+}
+
+func formatDuration(ms int64) string {
+	if ms <= 0 {
+		return "-"
+	}
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.1fs", float64(ms)/1000)
+}
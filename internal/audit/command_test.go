@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v3"
+)
+
+func runAuditCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := &cli.Command{
+		Name:     "hb",
+		Writer:   &out,
+		Commands: []*cli.Command{CmdAudit},
+	}
+	err := root.Run(context.Background(), append([]string{"hb", "audit"}, args...))
+	return out.String(), err
+}
+
+func TestCmdAudit(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	now := time.Now().UTC()
+	_ = Append(Entry{Time: now.Add(-48 * time.Hour), Handle: "alice.test", Command: "create", Args: []string{"Old"}, Issues: []string{"bd-1"}})
+	_ = Append(Entry{Time: now.Add(-time.Hour), Handle: "bot.test", Command: "close", Args: []string{"bd-1", "--reason", "abc1234 fix"}, ExitCode: 1, DurationMS: 1500, Issues: []string{"bd-1"}})
+	_ = Append(Entry{Time: now, Handle: "bot.test", Command: "delete", Args: []string{"bd-2"}, Decision: DecisionDenied, ExitCode: 77})
+
+	out, err := runAuditCommand(t, "--since", "24h")
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if strings.Contains(out, "Old") {
+		t.Errorf("--since 24h should skip old entries:\n%s", out)
+	}
+	for _, want := range []string{"close bd-1 --reason abc1234 fix", "exit 1", "1.5s", "denied"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	out, err = runAuditCommand(t, "--issue", "bd-1", "--json", "-n", "1")
+	if err != nil {
+		t.Fatalf("audit --json failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"command":"close"`) {
+		t.Errorf("expected only the latest bd-1 entry, got:\n%s", out)
+	}
+
+	if _, err := runAuditCommand(t, "--since", "yesterday-ish"); err == nil {
+		t.Error("expected error for invalid --since")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"2026-10-01T08:30:00Z", time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC)},
+		{"2026-10-01", time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+		{"90m", now.Add(-90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.value, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	if _, err := ParseTime("-5m", now); err == nil {
+		t.Error("negative durations should be rejected")
+	}
+}
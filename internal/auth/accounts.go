@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/adrg/xdg"
+
+	"github.com/gainforest/heartbeads-cli/internal/config"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// DefaultAccount is the profile name used when no account is selected.
+// It is stored at the original single-session path for compatibility.
+const DefaultAccount = "default"
+
+const (
+	defaultSessionFile = "heartbeads/auth-session.json"
+	accountsDir        = "heartbeads/accounts"
+	currentAccountFile = "heartbeads/current-account"
+)
+
+// accountNamePattern restricts profile names to safe file names
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// selectedAccount is the profile chosen for this invocation (via --as).
+// Empty means: repo default, then the switched-to account, then DefaultAccount.
+var selectedAccount string
+
+// Account describes a stored session profile
+type Account struct {
+	Name    string
+	Handle  string
+	DID     string
+	Current bool
+}
+
+// ValidateAccountName returns an error if name cannot be used as a profile name
+func ValidateAccountName(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid account name %q: use letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+// sessionFile returns the XDG-relative session path for a profile
+func sessionFile(name string) string {
+	if name == DefaultAccount {
+		return defaultSessionFile
+	}
+	return accountsDir + "/" + name + ".json"
+}
+
+// SelectAccount selects the profile used for the rest of this invocation.
+// nameOrHandle may be a profile name, or the handle or DID of a stored profile.
+// An empty value clears the selection.
+func SelectAccount(nameOrHandle string) error {
+	if nameOrHandle == "" {
+		selectedAccount = ""
+		return nil
+	}
+	name, err := resolveAccount(nameOrHandle)
+	if err != nil {
+		return err
+	}
+	selectedAccount = name
+	return nil
+}
+
+// SelectAccountName selects a profile by name without requiring it to exist,
+// e.g. for storing a new login.
+func SelectAccountName(name string) {
+	selectedAccount = name
+}
+
+// resolveAccount maps a profile name, handle or DID to a stored profile name
+func resolveAccount(nameOrHandle string) (string, error) {
+	accounts, err := ListAccounts()
+	if err != nil {
+		return "", err
+	}
+	for _, acct := range accounts {
+		if acct.Name == nameOrHandle {
+			return acct.Name, nil
+		}
+	}
+	target := strings.TrimPrefix(nameOrHandle, "@")
+	for _, acct := range accounts {
+		if strings.EqualFold(acct.Handle, target) || acct.DID == target {
+			return acct.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no account %q (run: hb account list)", nameOrHandle)
+}
+
+// ActiveAccount returns the profile name in effect for this invocation:
+// the --as selection, then the repo default from .beads/hb.yaml, then the
+// account chosen with `hb account switch`, then DefaultAccount.
+// A repo default that matches no stored profile is an error rather than a
+// fall-through, so commands never run as an identity the repo didn't pin;
+// the returned name is then the unresolved repo value, for display.
+func ActiveAccount() (string, error) {
+	if selectedAccount != "" {
+		return selectedAccount, nil
+	}
+	if cfg, err := config.Load(); err == nil && cfg.Account != "" {
+		name, err := resolveAccount(cfg.Account)
+		if err != nil {
+			return cfg.Account, hberr.Errorf(hberr.Auth,
+				"account %q pinned in .beads/hb.yaml is not logged in (run: hb account login --name <profile>, or hb --as <account>): %w", cfg.Account, err)
+		}
+		return name, nil
+	}
+	if name := currentAccount(); name != "" {
+		return name, nil
+	}
+	return DefaultAccount, nil
+}
+
+// currentAccount reads the profile chosen with `hb account switch`
+func currentAccount() string {
+	fPath, err := xdg.SearchStateFile(currentAccountFile)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(string(data))
+	if ValidateAccountName(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// SwitchAccount makes nameOrHandle the default profile for future invocations
+func SwitchAccount(nameOrHandle string) (string, error) {
+	name, err := resolveAccount(nameOrHandle)
+	if err != nil {
+		return "", err
+	}
+	fPath, err := xdg.StateFile(currentAccountFile)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(fPath, []byte(name+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// clearCurrentAccount removes the switch pointer if it refers to name
+func clearCurrentAccount(name string) error {
+	if currentAccount() != name {
+		return nil
+	}
+	fPath, err := xdg.SearchStateFile(currentAccountFile)
+	if err != nil {
+		return nil
+	}
+	return os.Remove(fPath)
+}
+
+// ListAccounts returns all stored profiles, sorted by name
+func ListAccounts() ([]Account, error) {
+	store, err := currentStore()
+	if err != nil {
+		return nil, err
+	}
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	current := currentAccount()
+	if current == "" {
+		current = DefaultAccount
+	}
+
+	accounts := make([]Account, 0, len(names))
+	for _, name := range names {
+		acct := Account{Name: name, Current: name == current}
+		if sess, err := loadSession(name); err == nil {
+			acct.Handle = sess.Handle
+			acct.DID = sess.DID.String()
+		}
+		accounts = append(accounts, acct)
+	}
+	return accounts, nil
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// writeAccount stores a session under the named profile
+func writeAccount(t *testing.T, name, did, handle string) {
+	t.Helper()
+	err := PersistAccountSession(name, &Session{DID: syntax.DID(did), Handle: handle})
+	if err != nil {
+		t.Fatalf("PersistAccountSession(%s) failed: %v", name, err)
+	}
+}
+
+func TestValidateAccountName(t *testing.T) {
+	for _, name := range []string{"default", "work", "agent-1", "a.b_c"} {
+		if err := ValidateAccountName(name); err != nil {
+			t.Errorf("ValidateAccountName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", "../x", "a/b", "-x", ".hidden"} {
+		if err := ValidateAccountName(name); err == nil {
+			t.Errorf("ValidateAccountName(%q) should fail", name)
+		}
+	}
+}
+
+func TestNamedAccountPaths(t *testing.T) {
+	tmpDir := setupTestXDG(t)
+	t.Cleanup(func() { SelectAccountName("") })
+
+	writeAccount(t, DefaultAccount, "did:plc:default", "default.test")
+	writeAccount(t, "work", "did:plc:work", "work.test")
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "heartbeads", "auth-session.json")); err != nil {
+		t.Errorf("default account should use auth-session.json: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "heartbeads", "accounts", "work.json")); err != nil {
+		t.Errorf("named account should use accounts/work.json: %v", err)
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.Handle != "default.test" {
+		t.Errorf("expected default account, got %s", sess.Handle)
+	}
+}
+
+func TestSelectAccount(t *testing.T) {
+	setupTestXDG(t)
+	t.Cleanup(func() { SelectAccountName("") })
+
+	writeAccount(t, DefaultAccount, "did:plc:default", "default.test")
+	writeAccount(t, "work", "did:plc:work", "work.test")
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"work", "work"},
+		{"work.test", "work"},
+		{"@work.test", "work"},
+		{"did:plc:work", "work"},
+		{"default.test", DefaultAccount},
+	}
+	for _, tt := range tests {
+		if err := SelectAccount(tt.selector); err != nil {
+			t.Fatalf("SelectAccount(%q) failed: %v", tt.selector, err)
+		}
+		if got, _ := ActiveAccount(); got != tt.want {
+			t.Errorf("SelectAccount(%q): active = %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+
+	if err := SelectAccount("nobody.test"); err == nil {
+		t.Error("expected error for unknown account")
+	}
+}
+
+func TestSwitchAccount(t *testing.T) {
+	setupTestXDG(t)
+
+	writeAccount(t, DefaultAccount, "did:plc:default", "default.test")
+	writeAccount(t, "work", "did:plc:work", "work.test")
+
+	name, err := SwitchAccount("work.test")
+	if err != nil {
+		t.Fatalf("SwitchAccount failed: %v", err)
+	}
+	if name != "work" {
+		t.Errorf("SwitchAccount returned %q, want work", name)
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.Handle != "work.test" {
+		t.Errorf("expected switched account, got %s", sess.Handle)
+	}
+
+	accounts, err := ListAccounts()
+	if err != nil {
+		t.Fatalf("ListAccounts failed: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(accounts))
+	}
+	if accounts[0].Name != DefaultAccount || accounts[1].Name != "work" {
+		t.Errorf("unexpected account order: %+v", accounts)
+	}
+	if !accounts[1].Current || accounts[0].Current {
+		t.Errorf("work should be current: %+v", accounts)
+	}
+
+	// Logging out of the switched account falls back to the default
+	if err := WipeSession(); err != nil {
+		t.Fatalf("WipeSession failed: %v", err)
+	}
+	if got, _ := ActiveAccount(); got != DefaultAccount {
+		t.Errorf("after logout active = %q, want %q", got, DefaultAccount)
+	}
+}
+
+func TestRepoDefaultAccount(t *testing.T) {
+	setupTestXDG(t)
+
+	writeAccount(t, DefaultAccount, "did:plc:default", "default.test")
+	writeAccount(t, "repo", "did:plc:repo", "repo.test")
+
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatalf("failed to create .beads: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".beads", "hb.yaml"), []byte("account: repo.test\n"), 0644); err != nil {
+		t.Fatalf("failed to write hb.yaml: %v", err)
+	}
+	t.Chdir(repo)
+
+	if got, err := ActiveAccount(); err != nil || got != "repo" {
+		t.Errorf("ActiveAccount() = %q, %v; want repo", got, err)
+	}
+}
+
+func TestRepoDefaultAccountUnresolved(t *testing.T) {
+	setupTestXDG(t)
+
+	writeAccount(t, DefaultAccount, "did:plc:default", "default.test")
+
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatalf("failed to create .beads: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".beads", "hb.yaml"), []byte("account: typo.test\n"), 0644); err != nil {
+		t.Fatalf("failed to write hb.yaml: %v", err)
+	}
+	t.Chdir(repo)
+
+	// A pinned account that isn't stored must not fall back to the default
+	if _, err := ActiveAccount(); err == nil {
+		t.Fatal("expected error for an unresolved repo account")
+	}
+	if _, err := LoadSessionFile(); err == nil {
+		t.Error("LoadSessionFile should fail rather than load the default account")
+	}
+
+	// An explicit --as still wins
+	t.Cleanup(func() { SelectAccountName("") })
+	if err := SelectAccount("default.test"); err != nil {
+		t.Fatalf("SelectAccount failed: %v", err)
+	}
+	if got, err := ActiveAccount(); err != nil || got != DefaultAccount {
+		t.Errorf("ActiveAccount() = %q, %v; want %q", got, err, DefaultAccount)
+	}
+}
@@ -6,18 +6,40 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"net"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/atclient"
-	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/auth/oauth"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
-	"github.com/adrg/xdg"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 )
 
 // ErrNoAuthSession is returned when no auth session file is found
-var ErrNoAuthSession = errors.New("no auth session found")
+var ErrNoAuthSession = hberr.New(hberr.Auth, "no auth session found")
+
+// IsAuthFactorRequired reports whether err is the PDS asking for the sign-in
+// code it emailed to an account with two-factor authentication enabled
+func IsAuthFactorRequired(err error) bool {
+	var apiErr *atclient.APIError
+	return errors.As(err, &apiErr) && apiErr.Name == "AuthFactorTokenRequired"
+}
+
+// pdsUnavailable reports whether err means the PDS could not be reached or
+// failed, rather than rejected the session: network errors, timeouts and
+// 5xx responses
+func pdsUnavailable(err error) bool {
+	var apiErr *atclient.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
 
 // Session represents a persisted authentication session
 type Session struct {
@@ -27,40 +49,63 @@ type Session struct {
 	Password     string     `json:"password"`
 	AccessToken  string     `json:"access_token"`
 	RefreshToken string     `json:"refresh_token"`
+
+	// OAuth is set for sessions created with `hb account login --oauth`.
+	// Password is empty for these sessions.
+	OAuth            *oauth.ClientSessionData `json:"oauth,omitempty"`
+	OAuthCallbackURL string                   `json:"oauth_callback_url,omitempty"`
 }
 
-// PersistSession saves the auth session to XDG state directory
+// PersistSession saves the auth session of the active account to XDG state directory
 func PersistSession(sess *Session) error {
-	fPath, err := xdg.StateFile("heartbeads/auth-session.json")
+	name, err := ActiveAccount()
 	if err != nil {
 		return err
 	}
+	return PersistAccountSession(name, sess)
+}
 
-	f, err := os.OpenFile(fPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+// PersistAccountSession saves the auth session for the named account profile
+// through the configured SecretStore
+func PersistAccountSession(name string, sess *Session) error {
+	if err := ValidateAccountName(name); err != nil {
+		return err
+	}
+	store, err := currentStore()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
 	authBytes, err := json.MarshalIndent(sess, "", "  ")
 	if err != nil {
 		return err
 	}
-	_, err = f.Write(authBytes)
-	return err
+	return store.Save(name, authBytes)
 }
 
-// LoadSessionFile loads the auth session from XDG state directory
+// LoadSessionFile loads the auth session of the active account from XDG state directory
 func LoadSessionFile() (*Session, error) {
-	fPath, err := xdg.SearchStateFile("heartbeads/auth-session.json")
+	name, err := ActiveAccount()
+	if err != nil {
+		return nil, err
+	}
+	return loadSession(name)
+}
+
+// loadSession loads the auth session for the named account profile
+func loadSession(name string) (*Session, error) {
+	store, err := currentStore()
 	if err != nil {
-		return nil, ErrNoAuthSession
+		return nil, err
 	}
 
-	fBytes, err := os.ReadFile(fPath)
+	fBytes, err := store.Load(name)
 	if err != nil {
 		return nil, err
 	}
+	if IsEncrypted(fBytes) {
+		return nil, ErrSessionEncrypted
+	}
 
 	var sess Session
 	err = json.Unmarshal(fBytes, &sess)
@@ -70,82 +115,205 @@ func LoadSessionFile() (*Session, error) {
 	return &sess, nil
 }
 
-// WipeSession deletes the auth session file
+// WipeSession deletes the auth session of the active account
 func WipeSession() error {
-	fPath, err := xdg.SearchStateFile("heartbeads/auth-session.json")
+	name, err := ActiveAccount()
+	if err != nil {
+		return err
+	}
+	store, err := currentStore()
 	if err != nil {
-		// File doesn't exist, nothing to wipe
-		return nil
+		return err
 	}
-	return os.Remove(fPath)
+	if err := store.Delete(name); err != nil {
+		return err
+	}
+	clearVerified(name)
+	return clearCurrentAccount(name)
 }
 
-// AuthRefreshCallback is called when tokens are refreshed
+// AuthRefreshCallback is called when tokens are refreshed. It takes the
+// session lock so concurrent hb processes never interleave their writes.
 func AuthRefreshCallback(ctx context.Context, data atclient.PasswordSessionData) {
-	sess, _ := LoadSessionFile()
-	if sess == nil {
-		sess = &Session{}
+	account, err := ActiveAccount()
+	if err != nil {
+		slog.Warn("failed to save refreshed auth session data", "err", err)
+		return
 	}
+	unlock, err := LockSession(account)
+	if err != nil {
+		slog.Warn("failed to lock auth session", "err", err)
+		return
+	}
+	defer unlock()
 
-	sess.DID = data.AccountDID
-	sess.AccessToken = data.AccessToken
-	sess.RefreshToken = data.RefreshToken
-	sess.PDS = data.Host
-
-	if err := PersistSession(sess); err != nil {
+	if err := updateSession(account, data); err != nil {
 		slog.Warn("failed to save refreshed auth session data", "err", err)
 	}
 }
 
-// ConfigDirectory returns an identity directory
-func ConfigDirectory() identity.Directory {
-	return identity.DefaultDirectory()
+// LoadClient loads an auth client from the current SessionSource
+func LoadClient(ctx context.Context) (*atclient.APIClient, error) {
+	client, _, err := loadClient(ctx)
+	return client, err
 }
 
-// LoadClient loads an auth client from the saved session
-func LoadClient(ctx context.Context) (*atclient.APIClient, error) {
-	sess, err := LoadSessionFile()
+// loadClient loads an auth client like LoadClient, and returns the
+// com.atproto.server.getSession response that confirmed the session. The
+// response is nil when the client had to log in again.
+func loadClient(ctx context.Context) (*atclient.APIClient, *comatproto.ServerGetSession_Output, error) {
+	src := CurrentSessionSource()
+	sess, err := src.Load(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if !src.Persistent() {
+		return loadEphemeralClient(ctx, src, sess)
+	}
+
+	if sess.OAuth != nil {
+		return loadOAuthClient(ctx, sess)
 	}
 
-	// First try to resume session
+	// First try to resume session. Refreshes are coordinated with other
+	// hb processes through the session lock.
+	account, err := ActiveAccount()
+	if err != nil {
+		return nil, nil, err
+	}
 	client := atclient.ResumePasswordSession(atclient.PasswordSessionData{
 		AccessToken:  sess.AccessToken,
 		RefreshToken: sess.RefreshToken,
 		AccountDID:   sess.DID,
 		Host:         sess.PDS,
-	}, AuthRefreshCallback)
+	}, nil)
+	lockRefreshes(account, client)
 
 	// Check that auth is working
-	_, err = comatproto.ServerGetSession(ctx, client)
+	resp, err := comatproto.ServerGetSession(ctx, client)
 	if err == nil {
-		return client, nil
+		return client, resp, nil
+	}
+	if pdsUnavailable(err) {
+		return nil, nil, hberr.Errorf(hberr.Unavailable, "PDS %s unavailable: %w", sess.PDS, err)
 	}
 
 	// Otherwise try new auth session using saved password
+	if sess.Password == "" {
+		return nil, nil, hberr.Errorf(hberr.Auth, "session expired and no password is stored (run: hb account login): %w", err)
+	}
 	dir := ConfigDirectory()
-	return atclient.LoginWithPassword(ctx, dir, sess.DID.AtIdentifier(), sess.Password, "", AuthRefreshCallback)
+	client, err = atclient.LoginWithPassword(ctx, dir, sess.DID.AtIdentifier(), sess.Password, "", nil)
+	if err != nil {
+		return nil, nil, loginError(err)
+	}
+	lockRefreshes(account, client)
+
+	// Persist the new tokens so later invocations resume instead of logging in again
+	unlock, err := LockSession(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	if err := updateSession(account, client.Auth.(*atclient.PasswordAuth).Session.Clone()); err != nil {
+		slog.Warn("failed to save auth session data", "err", err)
+	}
+	return client, nil, nil
+}
+
+// loadEphemeralClient resumes a password session held by a non-persistent
+// source. Refreshed tokens are saved back to the source, never to disk.
+func loadEphemeralClient(ctx context.Context, src SessionSource, sess *Session) (*atclient.APIClient, *comatproto.ServerGetSession_Output, error) {
+	if sess.OAuth != nil {
+		return nil, nil, fmt.Errorf("OAuth sessions can only be loaded from disk (run: hb account login --oauth)")
+	}
+
+	save := func(ctx context.Context, data atclient.PasswordSessionData) {
+		sess.AccessToken = data.AccessToken
+		sess.RefreshToken = data.RefreshToken
+		if err := src.Save(sess); err != nil {
+			slog.Warn("failed to save refreshed auth session data", "err", err)
+		}
+	}
+
+	client := atclient.ResumePasswordSession(atclient.PasswordSessionData{
+		AccessToken:  sess.AccessToken,
+		RefreshToken: sess.RefreshToken,
+		AccountDID:   sess.DID,
+		Host:         sess.PDS,
+	}, save)
+
+	resp, err := comatproto.ServerGetSession(ctx, client)
+	if err == nil {
+		return client, resp, nil
+	}
+	if pdsUnavailable(err) {
+		return nil, nil, hberr.Errorf(hberr.Unavailable, "PDS %s unavailable: %w", sess.PDS, err)
+	}
+	if sess.Password == "" {
+		return nil, nil, hberr.Errorf(hberr.Auth, "session expired and no password is available: %w", err)
+	}
+
+	client, err = atclient.LoginWithPasswordHost(ctx, sess.PDS, sess.DID.String(), sess.Password, "", save)
+	if err != nil {
+		return nil, nil, loginError(err)
+	}
+	save(ctx, client.Auth.(*atclient.PasswordAuth).Session)
+	return client, nil, nil
+}
+
+// loadOAuthClient resumes an OAuth session. Token refreshes are handled by
+// the OAuth session itself and persisted through fileAuthStore.
+func loadOAuthClient(ctx context.Context, sess *Session) (*atclient.APIClient, *comatproto.ServerGetSession_Output, error) {
+	app := newOAuthApp(sess.OAuthCallbackURL)
+	oauthSess, err := app.ResumeSession(ctx, sess.OAuth.AccountDID, sess.OAuth.SessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resume OAuth session: %w", err)
+	}
+
+	client := oauthSess.APIClient()
+	resp, err := comatproto.ServerGetSession(ctx, client)
+	if err != nil {
+		if pdsUnavailable(err) {
+			return nil, nil, hberr.Errorf(hberr.Unavailable, "PDS unavailable: %w", err)
+		}
+		return nil, nil, hberr.Errorf(hberr.Auth, "OAuth session expired (run: hb account login --oauth): %w", err)
+	}
+	return client, resp, nil
+}
+
+// loginError classifies a failed login with a stored password
+func loginError(err error) error {
+	if pdsUnavailable(err) {
+		return hberr.Errorf(hberr.Unavailable, "login failed, PDS unavailable: %w", err)
+	}
+	var apiErr *atclient.APIError
+	if errors.As(err, &apiErr) {
+		return hberr.Errorf(hberr.Auth, "login with the stored password failed (run: hb account login): %w", err)
+	}
+	return err
 }
 
 // GetLoggedInHandle returns the ATProto handle of the logged-in user.
 // Returns ErrNoAuthSession if not logged in.
 func GetLoggedInHandle() (string, error) {
-	sess, err := LoadSessionFile()
+	sess, err := CurrentSessionSource().Load(context.Background())
 	if err != nil {
 		return "", err
 	}
 	return sess.Handle, nil
 }
 
-// RequireAuth loads the auth session and returns a descriptive error if not logged in.
-func RequireAuth() (*Session, error) {
-	sess, err := LoadSessionFile()
+// RequireAuth loads the auth session from the current SessionSource and
+// returns a descriptive error if not logged in.
+func RequireAuth(ctx context.Context) (*Session, error) {
+	sess, err := CurrentSessionSource().Load(ctx)
 	if err != nil {
 		if errors.Is(err, ErrNoAuthSession) {
-			return nil, fmt.Errorf("Not logged in. Run: hb account login --username <handle> --password <app-password>")
+			return nil, hberr.Errorf(hberr.Auth, "Not logged in. Run: hb account login --username <handle> --password <app-password> (or set ATP_USERNAME and ATP_PASSWORD)")
 		}
-		return nil, fmt.Errorf("failed to load auth session: %w", err)
+		return nil, hberr.Errorf(hberr.Auth, "failed to load auth session: %w", err)
 	}
 	return sess, nil
 }
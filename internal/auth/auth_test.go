@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -201,7 +202,7 @@ func TestGetLoggedInHandle(t *testing.T) {
 func TestRequireAuth_NotLoggedIn(t *testing.T) {
 	setupTestXDG(t)
 
-	_, err := RequireAuth()
+	_, err := RequireAuth(context.Background())
 	if err == nil {
 		t.Fatal("expected error when not logged in")
 	}
@@ -233,7 +234,7 @@ func TestRequireAuth_LoggedIn(t *testing.T) {
 		t.Fatalf("failed to write session: %v", err)
 	}
 
-	loaded, err := RequireAuth()
+	loaded, err := RequireAuth(context.Background())
 	if err != nil {
 		t.Fatalf("RequireAuth should succeed: %v", err)
 	}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// ErrSessionEncrypted is returned when an encrypted session is read without a key
+var ErrSessionEncrypted = hberr.New(hberr.Auth, "session is encrypted (set HB_PASSPHRASE or HB_KEY_FILE)")
+
+const (
+	cipherAES256GCM  = "aes-256-gcm"
+	kdfPBKDF2SHA256  = "pbkdf2-sha256"
+	kdfKeyFileSHA256 = "hkdf-sha256"
+	pbkdf2Iterations = 600000
+	// maxPBKDF2Iterations bounds the iteration count read from a session
+	// file, so a tampered file cannot make hb hang
+	maxPBKDF2Iterations = 10 * pbkdf2Iterations
+	saltSize            = 16
+	keySize             = 32
+)
+
+// encryptedEnvelope is the on-disk format of an encrypted session
+type encryptedEnvelope struct {
+	Cipher     string `json:"cipher"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsEncrypted reports whether data is an encrypted session envelope
+func IsEncrypted(data []byte) bool {
+	var env encryptedEnvelope
+	return json.Unmarshal(data, &env) == nil && env.Cipher != ""
+}
+
+// EncryptedStore wraps another SecretStore and encrypts session data with
+// AES-256-GCM. The key is derived from a passphrase (PBKDF2) or from the
+// contents of a key file (HKDF). Plaintext sessions are still readable so
+// that existing files keep working until they are migrated.
+//
+// Derived keys are cached for the life of the store, and Save reuses the
+// salt of the first derived key, so reading and rewriting sessions costs
+// one PBKDF2 derivation rather than one per operation.
+type EncryptedStore struct {
+	Inner  SecretStore
+	secret []byte
+	kdf    string
+
+	mu   sync.Mutex
+	keys map[derivation][]byte
+	// salt is reused by Save; nil until a key is derived
+	salt []byte
+}
+
+// derivation identifies a derived key
+type derivation struct {
+	kdf        string
+	iterations int
+	salt       string
+}
+
+var _ SecretStore = &EncryptedStore{}
+
+// NewPassphraseStore returns an EncryptedStore keyed by a passphrase
+func NewPassphraseStore(inner SecretStore, passphrase string) *EncryptedStore {
+	return &EncryptedStore{Inner: inner, secret: []byte(passphrase), kdf: kdfPBKDF2SHA256}
+}
+
+// NewKeyFileStore returns an EncryptedStore keyed by the contents of keyPath
+func NewKeyFileStore(inner SecretStore, keyPath string) (*EncryptedStore, error) {
+	secret, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(secret) < keySize {
+		return nil, fmt.Errorf("key file %s is too short (need at least %d bytes)", keyPath, keySize)
+	}
+	return &EncryptedStore{Inner: inner, secret: secret, kdf: kdfKeyFileSHA256}, nil
+}
+
+// deriveKey derives the AES key for the given KDF and salt, or returns
+// the cached one
+func (s *EncryptedStore) deriveKey(kdf string, salt []byte, iterations int) ([]byte, error) {
+	if kdf != s.kdf {
+		return nil, fmt.Errorf("session was encrypted with %s, but a %s secret is configured", kdf, s.kdf)
+	}
+	if kdf == kdfPBKDF2SHA256 && (iterations < pbkdf2Iterations || iterations > maxPBKDF2Iterations) {
+		return nil, fmt.Errorf("invalid PBKDF2 iteration count %d in session file (want %d to %d)", iterations, pbkdf2Iterations, maxPBKDF2Iterations)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := derivation{kdf: kdf, iterations: iterations, salt: string(salt)}
+	if key, ok := s.keys[d]; ok {
+		return key, nil
+	}
+
+	var key []byte
+	var err error
+	switch kdf {
+	case kdfPBKDF2SHA256:
+		key, err = pbkdf2.Key(sha256.New, string(s.secret), salt, iterations, keySize)
+	case kdfKeyFileSHA256:
+		key, err = hkdf.Key(sha256.New, s.secret, salt, "heartbeads session", keySize)
+	default:
+		return nil, fmt.Errorf("unsupported key derivation: %s", kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.keys == nil {
+		s.keys = make(map[derivation][]byte)
+	}
+	s.keys[d] = key
+	if s.salt == nil {
+		s.salt = salt
+	}
+	return key, nil
+}
+
+// saveSalt returns the salt Save encrypts with: the salt of the first
+// derived key, or a fresh one
+func (s *EncryptedStore) saveSalt() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.salt != nil {
+		return s.salt, nil
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Load reads and decrypts a session. Plaintext sessions are returned unchanged.
+func (s *EncryptedStore) Load(name string) ([]byte, error) {
+	data, err := s.Inner.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var env encryptedEnvelope
+	if json.Unmarshal(data, &env) != nil || env.Cipher == "" {
+		return data, nil
+	}
+	if env.Cipher != cipherAES256GCM {
+		return nil, fmt.Errorf("unsupported session cipher: %s", env.Cipher)
+	}
+
+	key, err := s.deriveKey(env.KDF, env.Salt, env.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, env.Nonce, env.Ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session (wrong passphrase or key file?)")
+	}
+	return plaintext, nil
+}
+
+// Save encrypts data with a fresh nonce and writes it to the inner store
+func (s *EncryptedStore) Save(name string, data []byte) error {
+	salt, err := s.saveSalt()
+	if err != nil {
+		return err
+	}
+	env := encryptedEnvelope{
+		Cipher: cipherAES256GCM,
+		KDF:    s.kdf,
+		Salt:   salt,
+	}
+	if s.kdf == kdfPBKDF2SHA256 {
+		env.Iterations = pbkdf2Iterations
+	}
+
+	key, err := s.deriveKey(env.KDF, env.Salt, env.Iterations)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	// The profile name is authenticated so files cannot be swapped between profiles
+	env.Ciphertext = gcm.Seal(nil, env.Nonce, data, []byte(name))
+
+	envBytes, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.Inner.Save(name, envBytes)
+}
+
+// Delete removes a session from the inner store
+func (s *EncryptedStore) Delete(name string) error {
+	return s.Inner.Delete(name)
+}
+
+// List returns the profiles in the inner store
+func (s *EncryptedStore) List() ([]string, error) {
+	return s.Inner.List()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
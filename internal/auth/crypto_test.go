@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseStoreRoundTrip(t *testing.T) {
+	setupTestXDG(t)
+	store := NewPassphraseStore(FileStore{}, "correct horse")
+
+	plaintext := []byte(`{"handle":"alice.test","password":"secret"}`)
+	if err := store.Save("work", plaintext); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	raw, err := FileStore{}.Load("work")
+	if err != nil {
+		t.Fatalf("raw Load failed: %v", err)
+	}
+	if !IsEncrypted(raw) {
+		t.Fatal("stored data should be encrypted")
+	}
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Error("stored data should not contain the plaintext password")
+	}
+
+	got, err := store.Load("work")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Load = %s, want %s", got, plaintext)
+	}
+
+	wrong := NewPassphraseStore(FileStore{}, "wrong")
+	if _, err := wrong.Load("work"); err == nil {
+		t.Error("expected error with wrong passphrase")
+	}
+}
+
+func TestKeyFileStore(t *testing.T) {
+	setupTestXDG(t)
+	keyPath := filepath.Join(t.TempDir(), "hb.key")
+	if err := os.WriteFile(keyPath, bytes.Repeat([]byte("k"), 32), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	store, err := NewKeyFileStore(FileStore{}, keyPath)
+	if err != nil {
+		t.Fatalf("NewKeyFileStore failed: %v", err)
+	}
+	if err := store.Save(DefaultAccount, []byte(`{}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err := store.Load(DefaultAccount)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != `{}` {
+		t.Errorf("Load = %s, want {}", got)
+	}
+
+	// A passphrase store cannot open a key-file session
+	if _, err := NewPassphraseStore(FileStore{}, "x").Load(DefaultAccount); err == nil {
+		t.Error("expected error when KDF does not match")
+	}
+}
+
+func TestKeyFileTooShort(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "hb.key")
+	if err := os.WriteFile(keyPath, []byte("short"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	if _, err := NewKeyFileStore(FileStore{}, keyPath); err == nil {
+		t.Error("expected error for short key file")
+	}
+}
+
+func TestEncryptedStoreBindsProfileName(t *testing.T) {
+	setupTestXDG(t)
+	store := NewPassphraseStore(FileStore{}, "pass")
+
+	if err := store.Save("a", []byte(`{}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	raw, _ := FileStore{}.Load("a")
+	if err := (FileStore{}).Save("b", raw); err != nil {
+		t.Fatalf("raw Save failed: %v", err)
+	}
+	if _, err := store.Load("b"); err == nil {
+		t.Error("a session copied to another profile should not decrypt")
+	}
+}
+
+func TestEncryptedStoreCachesKey(t *testing.T) {
+	setupTestXDG(t)
+	store := NewPassphraseStore(FileStore{}, "pass")
+
+	for _, name := range []string{"a", "b"} {
+		if err := store.Save(name, []byte(`{}`)); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if _, err := store.Load(name); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	if len(store.keys) != 1 {
+		t.Errorf("saves and loads should share one derived key, got %d", len(store.keys))
+	}
+
+	// Another store reading the files derives the key once
+	other := NewPassphraseStore(FileStore{}, "pass")
+	for _, name := range []string{"a", "b", "a"} {
+		if _, err := other.Load(name); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	if len(other.keys) != 1 {
+		t.Errorf("loads should reuse the derived key, got %d", len(other.keys))
+	}
+}
+
+func TestEncryptedStoreRejectsIterations(t *testing.T) {
+	setupTestXDG(t)
+	store := NewPassphraseStore(FileStore{}, "pass")
+	if err := store.Save("a", []byte(`{}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	raw, _ := FileStore{}.Load("a")
+
+	for _, iterations := range []int{1, pbkdf2Iterations - 1, maxPBKDF2Iterations + 1} {
+		var env encryptedEnvelope
+		if err := json.Unmarshal(raw, &env); err != nil {
+			t.Fatal(err)
+		}
+		env.Iterations = iterations
+		tampered, _ := json.Marshal(env)
+		if err := (FileStore{}).Save("a", tampered); err != nil {
+			t.Fatalf("raw Save failed: %v", err)
+		}
+		_, err := NewPassphraseStore(FileStore{}, "pass").Load("a")
+		if err == nil || !strings.Contains(err.Error(), "iteration count") {
+			t.Errorf("iterations %d: expected an iteration count error, got %v", iterations, err)
+		}
+	}
+}
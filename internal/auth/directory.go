@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// DefaultIdentityCacheTTL is how long resolved identities are kept on disk
+const DefaultIdentityCacheTTL = time.Hour
+
+// DirectoryConfig configures identity resolution (DIDs and handles).
+// The zero value resolves against the public PLC directory.
+type DirectoryConfig struct {
+	// PLCHost is the PLC directory URL (default: https://plc.directory)
+	PLCHost string
+
+	// HandleDNSServer, if set, is the "host:port" of the DNS server used for
+	// handle TXT lookups
+	HandleDNSServer string
+
+	// HandleHTTPHost, if set, receives all HTTP well-known handle lookups
+	// (/.well-known/atproto-did) instead of the handle's own domain
+	HandleHTTPHost string
+
+	// CacheTTL is how long resolved identities are cached on disk under
+	// XDG cache. Zero uses DefaultIdentityCacheTTL; negative disables the cache.
+	CacheTTL time.Duration
+}
+
+var (
+	directoryConfig DirectoryConfig
+	directoryOnce   sync.Once
+	directory       identity.Directory
+)
+
+// SetDirectoryConfig sets the identity resolution config for this process.
+// It must be called before the first ConfigDirectory call to take effect.
+func SetDirectoryConfig(cfg DirectoryConfig) {
+	directoryConfig = cfg
+	directoryOnce = sync.Once{}
+}
+
+// ConfigDirectory returns the identity directory built from the configured
+// PLC host, handle resolution overrides, and on-disk cache
+func ConfigDirectory() identity.Directory {
+	directoryOnce.Do(func() {
+		directory = NewDirectory(directoryConfig)
+	})
+	return directory
+}
+
+// NewDirectory builds an identity directory from cfg
+func NewDirectory(cfg DirectoryConfig) identity.Directory {
+	plcHost := strings.TrimSuffix(cfg.PLCHost, "/")
+	if plcHost == "" {
+		plcHost = identity.DefaultPLCURL
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		IdleConnTimeout: time.Second,
+		MaxIdleConns:    100,
+	}
+	var rt http.RoundTripper = transport
+	if cfg.HandleHTTPHost != "" {
+		rt = &wellKnownRewriter{host: cfg.HandleHTTPHost, inner: transport}
+	}
+
+	base := &identity.BaseDirectory{
+		PLCURL: plcHost,
+		HTTPClient: http.Client{
+			Timeout:   10 * time.Second,
+			Transport: rt,
+		},
+		Resolver: net.Resolver{
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 3 * time.Second}
+				return d.DialContext(ctx, network, address)
+			},
+		},
+		TryAuthoritativeDNS: true,
+		// primary Bluesky PDS instance only supports HTTP resolution method
+		SkipDNSDomainSuffixes: []string{".bsky.social"},
+		UserAgent:             "hb",
+	}
+	if cfg.HandleDNSServer != "" {
+		server := cfg.HandleDNSServer
+		base.Resolver = net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 3 * time.Second}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+		base.TryAuthoritativeDNS = false
+		base.SkipDNSDomainSuffixes = nil
+	}
+
+	var dir identity.Directory = identity.NewCacheDirectory(base, 1000, time.Hour, time.Minute, time.Minute)
+
+	ttl := cfg.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultIdentityCacheTTL
+	}
+	if ttl > 0 {
+		// Partition the cache by resolution settings so a private PLC never
+		// serves identities cached from the public one
+		key := sha256.Sum256([]byte(plcHost + "|" + cfg.HandleDNSServer + "|" + cfg.HandleHTTPHost))
+		cacheDir := filepath.Join(xdg.CacheHome, "heartbeads", "identity", hex.EncodeToString(key[:6]))
+		dir = &DiskCacheDirectory{Inner: dir, Dir: cacheDir, TTL: ttl}
+	}
+	return dir
+}
+
+// wellKnownRewriter sends handle well-known requests to a fixed host,
+// keeping the original handle in the Host header
+type wellKnownRewriter struct {
+	host  string
+	inner http.RoundTripper
+}
+
+func (w *wellKnownRewriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/.well-known/atproto-did" {
+		return w.inner.RoundTrip(req)
+	}
+	target, err := url.Parse(w.host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid handle HTTP host %q: %w", w.host, err)
+	}
+	out := req.Clone(req.Context())
+	out.Host = req.URL.Host
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	return w.inner.RoundTrip(out)
+}
+
+// DiskCacheDirectory caches successful identity lookups as JSON files so
+// that separate hb invocations do not repeat network resolution
+type DiskCacheDirectory struct {
+	Inner identity.Directory
+	Dir   string
+	TTL   time.Duration
+}
+
+var _ identity.Directory = (*DiskCacheDirectory)(nil)
+
+type identityCacheEntry struct {
+	Updated  time.Time          `json:"updated"`
+	Identity *identity.Identity `json:"identity,omitempty"`
+	DID      syntax.DID         `json:"did,omitempty"`
+}
+
+// cachePath maps a DID or handle to a file name safe on all platforms
+func (d *DiskCacheDirectory) cachePath(kind, key string) string {
+	return filepath.Join(d.Dir, kind, strings.ReplaceAll(key, ":", "_")+".json")
+}
+
+func (d *DiskCacheDirectory) read(path string) *identityCacheEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entry identityCacheEntry
+	if json.Unmarshal(data, &entry) != nil || time.Since(entry.Updated) > d.TTL {
+		return nil
+	}
+	return &entry
+}
+
+func (d *DiskCacheDirectory) write(path string, entry identityCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0600)
+}
+
+// LookupDID returns the identity for did, from disk when fresh
+func (d *DiskCacheDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	path := d.cachePath("did", did.String())
+	if entry := d.read(path); entry != nil && entry.Identity != nil {
+		return entry.Identity, nil
+	}
+
+	ident, err := d.Inner.LookupDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	d.write(path, identityCacheEntry{Updated: time.Now(), Identity: ident})
+	return ident, nil
+}
+
+// LookupHandle returns the identity for handle, from disk when fresh
+func (d *DiskCacheDirectory) LookupHandle(ctx context.Context, handle syntax.Handle) (*identity.Identity, error) {
+	handle = handle.Normalize()
+	path := d.cachePath("handle", handle.String())
+	if entry := d.read(path); entry != nil && entry.DID != "" {
+		ident, err := d.LookupDID(ctx, entry.DID)
+		if err == nil && ident.Handle == handle {
+			return ident, nil
+		}
+	}
+
+	ident, err := d.Inner.LookupHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	d.write(path, identityCacheEntry{Updated: time.Now(), DID: ident.DID})
+	d.write(d.cachePath("did", ident.DID.String()), identityCacheEntry{Updated: time.Now(), Identity: ident})
+	return ident, nil
+}
+
+// Lookup dispatches to LookupHandle or LookupDID
+func (d *DiskCacheDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if handle, err := atid.AsHandle(); err == nil {
+		return d.LookupHandle(ctx, handle)
+	}
+	if did, err := atid.AsDID(); err == nil {
+		return d.LookupDID(ctx, did)
+	}
+	return nil, errors.New("at-identifier neither a Handle nor a DID")
+}
+
+// Purge removes cached entries for atid, on disk and in the inner directory.
+// Purging a handle also drops the cached document of the DID it mapped to,
+// which would otherwise still claim the handle. Security-sensitive callers
+// purge before looking up, so they always resolve over the network.
+func (d *DiskCacheDirectory) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	if handle, err := atid.AsHandle(); err == nil {
+		path := d.cachePath("handle", handle.Normalize().String())
+		if data, err := os.ReadFile(path); err == nil {
+			var entry identityCacheEntry
+			if json.Unmarshal(data, &entry) == nil && entry.DID != "" {
+				if err := d.Purge(ctx, entry.DID.AtIdentifier()); err != nil {
+					return err
+				}
+			}
+		}
+		if err := removeCacheFile(path); err != nil {
+			return err
+		}
+	}
+	if did, err := atid.AsDID(); err == nil {
+		if err := removeCacheFile(d.cachePath("did", did.String())); err != nil {
+			return err
+		}
+	}
+	return d.Inner.Purge(ctx, atid)
+}
+
+// removeCacheFile deletes a cache entry; a missing entry is not an error
+func removeCacheFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to purge identity cache: %w", err)
+	}
+	return nil
+}
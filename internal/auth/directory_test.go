@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// countingDirectory counts lookups that reach the inner directory
+type countingDirectory struct {
+	identity.Directory
+	lookups atomic.Int32
+}
+
+func (c *countingDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	c.lookups.Add(1)
+	return c.Directory.LookupDID(ctx, did)
+}
+
+func (c *countingDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*identity.Identity, error) {
+	c.lookups.Add(1)
+	return c.Directory.LookupHandle(ctx, h)
+}
+
+func TestDiskCacheDirectory(t *testing.T) {
+	inner := &countingDirectory{Directory: mockDirectory("did:plc:cache", "cache.example.com")}
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	dir := &DiskCacheDirectory{Inner: inner, Dir: cacheDir, TTL: time.Hour}
+	if _, err := dir.LookupHandle(ctx, syntax.Handle("cache.example.com")); err != nil {
+		t.Fatalf("LookupHandle failed: %v", err)
+	}
+
+	// A fresh directory over the same cache dir (a new hb process) hits disk
+	dir2 := &DiskCacheDirectory{Inner: inner, Dir: cacheDir, TTL: time.Hour}
+	ident, err := dir2.LookupHandle(ctx, syntax.Handle("cache.example.com"))
+	if err != nil {
+		t.Fatalf("cached LookupHandle failed: %v", err)
+	}
+	if ident.DID != "did:plc:cache" {
+		t.Errorf("DID mismatch: got %s", ident.DID)
+	}
+	if _, err := dir2.LookupDID(ctx, syntax.DID("did:plc:cache")); err != nil {
+		t.Fatalf("cached LookupDID failed: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 1 {
+		t.Errorf("expected 1 inner lookup, got %d", n)
+	}
+
+	// Expired entries go back to the inner directory
+	expired := &DiskCacheDirectory{Inner: inner, Dir: cacheDir, TTL: time.Nanosecond}
+	if _, err := expired.LookupDID(ctx, syntax.DID("did:plc:cache")); err != nil {
+		t.Fatalf("LookupDID failed: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 2 {
+		t.Errorf("expected 2 inner lookups after expiry, got %d", n)
+	}
+}
+
+func TestDiskCacheDirectoryPurge(t *testing.T) {
+	inner := &countingDirectory{Directory: mockDirectory("did:plc:cache", "cache.example.com")}
+	ctx := context.Background()
+
+	dir := &DiskCacheDirectory{Inner: inner, Dir: t.TempDir(), TTL: time.Hour}
+	if _, err := dir.LookupHandle(ctx, syntax.Handle("cache.example.com")); err != nil {
+		t.Fatalf("LookupHandle failed: %v", err)
+	}
+
+	// Purging the handle drops both the handle and the DID it mapped to
+	if err := dir.Purge(ctx, syntax.Handle("cache.example.com").AtIdentifier()); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if _, err := dir.LookupDID(ctx, syntax.DID("did:plc:cache")); err != nil {
+		t.Fatalf("LookupDID failed: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 2 {
+		t.Errorf("expected purged DID to be resolved again, got %d inner lookups", n)
+	}
+
+	if err := dir.Purge(ctx, syntax.DID("did:plc:cache").AtIdentifier()); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if _, err := dir.LookupDID(ctx, syntax.DID("did:plc:cache")); err != nil {
+		t.Fatalf("LookupDID failed: %v", err)
+	}
+	if n := inner.lookups.Load(); n != 3 {
+		t.Errorf("expected purged DID to be resolved again, got %d inner lookups", n)
+	}
+
+	// Purging an uncached identifier is a no-op
+	if err := dir.Purge(ctx, syntax.Handle("other.example.com").AtIdentifier()); err != nil {
+		t.Errorf("Purge of uncached handle failed: %v", err)
+	}
+}
+
+func TestNewDirectoryPrivatePLC(t *testing.T) {
+	const did = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+	const handle = "private.example.com"
+
+	var plcHits, wellKnownHits atomic.Int32
+	plc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plcHits.Add(1)
+		if r.URL.Path != "/"+did {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":          did,
+			"alsoKnownAs": []string{"at://" + handle},
+			"service": []map[string]string{{
+				"id":              "#atproto_pds",
+				"type":            "AtprotoPersonalDataServer",
+				"serviceEndpoint": "https://pds.example.com",
+			}},
+		})
+	}))
+	defer plc.Close()
+
+	wellKnown := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wellKnownHits.Add(1)
+		if r.URL.Path != "/.well-known/atproto-did" || !strings.HasPrefix(r.Host, handle) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, did)
+	}))
+	defer wellKnown.Close()
+
+	dir := NewDirectory(DirectoryConfig{
+		PLCHost:         plc.URL,
+		HandleDNSServer: "127.0.0.1:1", // unreachable: forces HTTP resolution
+		HandleHTTPHost:  wellKnown.URL,
+		CacheTTL:        -1,
+	})
+
+	ident, err := dir.LookupHandle(context.Background(), syntax.Handle(handle))
+	if err != nil {
+		t.Fatalf("LookupHandle failed: %v", err)
+	}
+	if ident.DID != did {
+		t.Errorf("DID mismatch: got %s, want %s", ident.DID, did)
+	}
+	if ident.PDSEndpoint() != "https://pds.example.com" {
+		t.Errorf("PDS mismatch: got %s", ident.PDSEndpoint())
+	}
+	if plcHits.Load() == 0 || wellKnownHits.Load() == 0 {
+		t.Errorf("expected private PLC and well-known hosts to be used (plc=%d, well-known=%d)", plcHits.Load(), wellKnownHits.Load())
+	}
+}
+
+func TestConfigDirectoryUsesConfig(t *testing.T) {
+	t.Cleanup(func() { SetDirectoryConfig(DirectoryConfig{}) })
+
+	SetDirectoryConfig(DirectoryConfig{PLCHost: "http://127.0.0.1:1", CacheTTL: -1})
+	_, err := ConfigDirectory().LookupDID(context.Background(), syntax.DID("did:plc:ewvi7nxzyoun6zhxrhs64oiz"))
+	if err == nil {
+		t.Error("expected lookup against the unreachable PLC host to fail")
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// lockTimeout bounds how long a process waits for another process's refresh
+const lockTimeout = 30 * time.Second
+
+// lockRetryInterval is the polling interval while waiting for a session lock
+const lockRetryInterval = 50 * time.Millisecond
+
+// errLockBusy is returned by tryLockFile when another process holds the lock
+var errLockBusy = errors.New("lock busy")
+
+// LockSession takes an exclusive, cross-process lock on the named profile's
+// session. Callers must call the returned unlock function. The lock is
+// advisory: it serializes hb processes that refresh or rewrite the session.
+func LockSession(name string) (unlock func(), err error) {
+	fPath, err := xdg.StateFile(sessionFile(name) + ".lock")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(fPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockBusy) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock session: %w", err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out waiting for session lock %s", fPath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
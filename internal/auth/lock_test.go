@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockSessionExclusive(t *testing.T) {
+	setupTestXDG(t)
+
+	unlock, err := LockSession(DefaultAccount)
+	if err != nil {
+		t.Fatalf("LockSession failed: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock2, err := LockSession(DefaultAccount)
+		if err != nil {
+			t.Errorf("second LockSession failed: %v", err)
+			close(acquired)
+			return
+		}
+		close(acquired)
+		unlock2()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second lock acquired while the first is held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock not acquired after unlock")
+	}
+}
+
+func TestLockSessionPerAccount(t *testing.T) {
+	setupTestXDG(t)
+
+	unlock, err := LockSession("one")
+	if err != nil {
+		t.Fatalf("LockSession failed: %v", err)
+	}
+	defer unlock()
+
+	// A different profile has its own lock
+	unlock2, err := LockSession("two")
+	if err != nil {
+		t.Fatalf("LockSession for another account failed: %v", err)
+	}
+	unlock2()
+}
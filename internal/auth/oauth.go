@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/auth/oauth"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// OAuthScopes are the scopes requested for hb OAuth sessions.
+// transition:generic grants the same repo write access as an app password.
+var OAuthScopes = []string{"atproto", "transition:generic"}
+
+// oauthCallbackPath is the path of the loopback redirect listener
+const oauthCallbackPath = "/callback"
+
+// fileAuthStore implements oauth.ClientAuthStore on top of the persisted
+// Session. Auth request info only lives for the duration of a login flow,
+// so it is kept in memory.
+type fileAuthStore struct {
+	callbackURL string
+
+	mu       sync.Mutex
+	requests map[string]oauth.AuthRequestData
+}
+
+var _ oauth.ClientAuthStore = &fileAuthStore{}
+
+func newFileAuthStore(callbackURL string) *fileAuthStore {
+	return &fileAuthStore{
+		callbackURL: callbackURL,
+		requests:    make(map[string]oauth.AuthRequestData),
+	}
+}
+
+// GetSession returns the OAuth data of the persisted session if it matches did
+func (s *fileAuthStore) GetSession(ctx context.Context, did syntax.DID, sessionID string) (*oauth.ClientSessionData, error) {
+	sess, err := LoadSessionFile()
+	if err != nil {
+		return nil, err
+	}
+	if sess.OAuth == nil || sess.OAuth.AccountDID != did {
+		return nil, fmt.Errorf("no OAuth session found for %s", did)
+	}
+	return sess.OAuth, nil
+}
+
+// SaveSession persists OAuth session data, keeping the handle of an
+// existing session for the same account
+func (s *fileAuthStore) SaveSession(ctx context.Context, data oauth.ClientSessionData) error {
+	account, err := ActiveAccount()
+	if err != nil {
+		return err
+	}
+	unlock, err := LockSession(account)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sess, _ := loadSession(account)
+	if sess == nil || sess.DID != data.AccountDID {
+		sess = &Session{}
+	}
+
+	sess.DID = data.AccountDID
+	sess.PDS = data.HostURL
+	sess.Password = ""
+	sess.AccessToken = data.AccessToken
+	sess.RefreshToken = data.RefreshToken
+	sess.OAuth = &data
+	sess.OAuthCallbackURL = s.callbackURL
+
+	return PersistAccountSession(account, sess)
+}
+
+// DeleteSession wipes the persisted session if it belongs to did
+func (s *fileAuthStore) DeleteSession(ctx context.Context, did syntax.DID, sessionID string) error {
+	sess, err := LoadSessionFile()
+	if err != nil || sess.DID != did {
+		return nil
+	}
+	return WipeSession()
+}
+
+func (s *fileAuthStore) GetAuthRequestInfo(ctx context.Context, state string) (*oauth.AuthRequestData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, ok := s.requests[state]
+	if !ok {
+		return nil, fmt.Errorf("auth request not found: %s", state)
+	}
+	return &info, nil
+}
+
+func (s *fileAuthStore) SaveAuthRequestInfo(ctx context.Context, info oauth.AuthRequestData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[info.State] = info
+	return nil
+}
+
+func (s *fileAuthStore) DeleteAuthRequestInfo(ctx context.Context, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.requests, state)
+	return nil
+}
+
+// newOAuthApp builds a localhost (public) OAuth client for the given loopback callback URL.
+// The callback URL is part of the client ID, so resumed sessions must reuse the one from login.
+func newOAuthApp(callbackURL string) *oauth.ClientApp {
+	config := oauth.NewLocalhostConfig(callbackURL, OAuthScopes)
+	config.UserAgent = "hb"
+	app := oauth.NewClientApp(&config, newFileAuthStore(callbackURL))
+	app.Dir = ConfigDirectory()
+	return app
+}
+
+// callbackResult is the outcome of the OAuth redirect to the loopback listener
+type callbackResult struct {
+	data *oauth.ClientSessionData
+	err  error
+}
+
+// callbackHandler completes the auth flow from the redirect query (state,
+// code, iss or error) and reports the first outcome on results. Requests
+// that are not this login's redirect (a prefetch, or an unknown state) are
+// rejected without reporting, so the login keeps waiting.
+func callbackHandler(app *oauth.ClientApp, results chan<- callbackResult) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		state := query.Get("state")
+		if state == "" || (query.Get("code") == "" && query.Get("error") == "") {
+			http.Error(w, "hb login: not an OAuth redirect", http.StatusBadRequest)
+			return
+		}
+		if _, err := app.Store.GetAuthRequestInfo(r.Context(), state); err != nil {
+			http.Error(w, "hb login: unknown state", http.StatusBadRequest)
+			return
+		}
+
+		data, err := app.ProcessCallback(r.Context(), query)
+		if err != nil {
+			http.Error(w, "hb login failed: "+err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "hb login complete. You can close this window.")
+		}
+		select {
+		case results <- callbackResult{data: data, err: err}:
+		default:
+		}
+	}
+}
+
+// LoginOAuth runs the ATProto OAuth flow (PAR, PKCE, DPoP) for identifier,
+// which may be a handle, DID, or auth server URL. A loopback listener on
+// 127.0.0.1 receives the redirect; prompt is called with the authorization
+// URL the user must visit. The resulting session is persisted.
+func LoginOAuth(ctx context.Context, identifier string, prompt func(authURL string)) (*oauth.ClientSessionData, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start callback listener: %w", err)
+	}
+	defer listener.Close()
+
+	callbackURL := fmt.Sprintf("http://%s%s", listener.Addr().String(), oauthCallbackPath)
+	app := newOAuthApp(callbackURL)
+
+	authURL, err := app.StartAuthFlow(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan callbackResult, 1)
+
+	mux := http.NewServeMux()
+	mux.Handle(oauthCallbackPath, callbackHandler(app, results))
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			results <- callbackResult{err: err}
+		}
+	}()
+	defer srv.Close()
+
+	prompt(authURL)
+
+	select {
+	case res := <-results:
+		return res.data, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// OpenBrowser tries to open url in the user's default browser.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
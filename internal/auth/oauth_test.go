@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/atcrypto"
+	"github.com/bluesky-social/indigo/atproto/auth/oauth"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+func TestFileAuthStoreSession(t *testing.T) {
+	setupTestXDG(t)
+	ctx := context.Background()
+	store := newFileAuthStore("http://127.0.0.1:4321/callback")
+
+	data := oauth.ClientSessionData{
+		AccountDID:   syntax.DID("did:plc:oauthtest"),
+		SessionID:    "state-123",
+		HostURL:      "https://pds.example.com",
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+	}
+	if err := store.SaveSession(ctx, data); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.DID != data.AccountDID {
+		t.Errorf("DID mismatch: got %s, want %s", sess.DID, data.AccountDID)
+	}
+	if sess.PDS != data.HostURL {
+		t.Errorf("PDS mismatch: got %s, want %s", sess.PDS, data.HostURL)
+	}
+	if sess.Password != "" {
+		t.Error("OAuth session should not store a password")
+	}
+	if sess.OAuthCallbackURL != "http://127.0.0.1:4321/callback" {
+		t.Errorf("callback URL mismatch: got %s", sess.OAuthCallbackURL)
+	}
+
+	got, err := store.GetSession(ctx, data.AccountDID, data.SessionID)
+	if err != nil {
+		t.Fatalf("GetSession failed: %v", err)
+	}
+	if got.RefreshToken != "refresh-1" {
+		t.Errorf("refresh token mismatch: got %s", got.RefreshToken)
+	}
+
+	if _, err := store.GetSession(ctx, syntax.DID("did:plc:other"), data.SessionID); err == nil {
+		t.Error("expected error for a different DID")
+	}
+}
+
+func TestFileAuthStoreKeepsHandle(t *testing.T) {
+	setupTestXDG(t)
+	ctx := context.Background()
+	store := newFileAuthStore("http://127.0.0.1:4321/callback")
+
+	if err := PersistSession(&Session{DID: syntax.DID("did:plc:oauthtest"), Handle: "alice.test"}); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	// A token refresh must not drop the handle
+	err := store.SaveSession(ctx, oauth.ClientSessionData{
+		AccountDID:  syntax.DID("did:plc:oauthtest"),
+		AccessToken: "access-2",
+	})
+	if err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.Handle != "alice.test" {
+		t.Errorf("handle mismatch: got %q, want alice.test", sess.Handle)
+	}
+	if sess.AccessToken != "access-2" {
+		t.Errorf("access token mismatch: got %q", sess.AccessToken)
+	}
+}
+
+func TestFileAuthStoreAuthRequests(t *testing.T) {
+	ctx := context.Background()
+	store := newFileAuthStore("")
+
+	if err := store.SaveAuthRequestInfo(ctx, oauth.AuthRequestData{State: "abc"}); err != nil {
+		t.Fatalf("SaveAuthRequestInfo failed: %v", err)
+	}
+	if _, err := store.GetAuthRequestInfo(ctx, "abc"); err != nil {
+		t.Fatalf("GetAuthRequestInfo failed: %v", err)
+	}
+	if err := store.DeleteAuthRequestInfo(ctx, "abc"); err != nil {
+		t.Fatalf("DeleteAuthRequestInfo failed: %v", err)
+	}
+	if _, err := store.GetAuthRequestInfo(ctx, "abc"); err == nil {
+		t.Error("expected error after delete")
+	}
+}
+
+// newCallbackTestApp returns an OAuth app with a pending auth request for
+// state "state-ok", backed by a fake token endpoint and a mock directory
+func newCallbackTestApp(t *testing.T) (*oauth.ClientApp, string) {
+	t.Helper()
+	did := syntax.DID("did:plc:oauthtest")
+
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DPoP") == "" {
+			http.Error(w, `{"error":"invalid_dpop_proof"}`, http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.Form.Get("code") != "code-1" || r.Form.Get("code_verifier") != "verifier-1" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(oauth.TokenResponse{
+			Subject:      did.String(),
+			Scope:        "atproto transition:generic",
+			AccessToken:  "access-1",
+			RefreshToken: "refresh-1",
+		})
+	}))
+	t.Cleanup(tokenSrv.Close)
+
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    did,
+		Handle: syntax.Handle("alice.test"),
+		Services: map[string]identity.ServiceEndpoint{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: "https://pds.example.com"},
+		},
+	})
+
+	app := newOAuthApp("http://127.0.0.1:4321/callback")
+	app.Dir = dir
+
+	key, err := atcrypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKeyP256 failed: %v", err)
+	}
+	err = app.Store.SaveAuthRequestInfo(context.Background(), oauth.AuthRequestData{
+		State:                   "state-ok",
+		AuthServerURL:           tokenSrv.URL,
+		AccountDID:              &did,
+		AuthServerTokenEndpoint: tokenSrv.URL + "/token",
+		PKCEVerifier:            "verifier-1",
+		DPoPPrivateKeyMultibase: key.Multibase(),
+	})
+	if err != nil {
+		t.Fatalf("SaveAuthRequestInfo failed: %v", err)
+	}
+	return app, tokenSrv.URL
+}
+
+// runCallback sends a redirect with query to the callback handler. ok is
+// false if the handler reported no outcome.
+func runCallback(app *oauth.ClientApp, query string) (rec *httptest.ResponseRecorder, res callbackResult, ok bool) {
+	results := make(chan callbackResult, 1)
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, oauthCallbackPath+"?"+query, nil)
+	callbackHandler(app, results).ServeHTTP(rec, req)
+	select {
+	case res = <-results:
+		return rec, res, true
+	default:
+		return rec, res, false
+	}
+}
+
+func TestCallbackHandlerSuccess(t *testing.T) {
+	setupTestXDG(t)
+	app, iss := newCallbackTestApp(t)
+
+	rec, res, _ := runCallback(app, "state=state-ok&code=code-1&iss="+iss)
+	if res.err != nil {
+		t.Fatalf("callback failed: %v", res.err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if res.data.AccessToken != "access-1" {
+		t.Errorf("access token mismatch: got %q", res.data.AccessToken)
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.DID != "did:plc:oauthtest" || sess.PDS != "https://pds.example.com" {
+		t.Errorf("unexpected persisted session: DID=%s PDS=%s", sess.DID, sess.PDS)
+	}
+	if sess.OAuth == nil || sess.OAuth.RefreshToken != "refresh-1" {
+		t.Error("persisted session should carry the OAuth refresh token")
+	}
+	if sess.OAuthCallbackURL != "http://127.0.0.1:4321/callback" {
+		t.Errorf("callback URL mismatch: got %s", sess.OAuthCallbackURL)
+	}
+
+	// The auth request is single-use
+	if _, err := app.Store.GetAuthRequestInfo(context.Background(), "state-ok"); err == nil {
+		t.Error("auth request should be deleted after the callback")
+	}
+}
+
+func TestCallbackHandlerWrongState(t *testing.T) {
+	setupTestXDG(t)
+	app, iss := newCallbackTestApp(t)
+
+	rec, _, reported := runCallback(app, "state=state-forged&code=code-1&iss="+iss)
+	if reported {
+		t.Fatal("an unknown state should not end the login")
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if _, err := LoadSessionFile(); err == nil {
+		t.Error("no session should be persisted for a mismatched state")
+	}
+
+	// The real redirect still completes the login
+	if _, res, _ := runCallback(app, "state=state-ok&code=code-1&iss="+iss); res.err != nil || res.data == nil {
+		t.Errorf("login should complete after a stray request, got %v", res.err)
+	}
+}
+
+func TestCallbackHandlerIgnoresStrayRequests(t *testing.T) {
+	setupTestXDG(t)
+	app, _ := newCallbackTestApp(t)
+
+	for _, query := range []string{"", "foo=bar", "state=state-ok"} {
+		rec, _, reported := runCallback(app, query)
+		if reported {
+			t.Errorf("query %q should not end the login", query)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("query %q: status = %d, want 400", query, rec.Code)
+		}
+	}
+	// The auth request is kept for the real redirect
+	if _, err := app.Store.GetAuthRequestInfo(context.Background(), "state-ok"); err != nil {
+		t.Errorf("auth request should survive stray requests: %v", err)
+	}
+}
+
+func TestCallbackHandlerErrorParam(t *testing.T) {
+	setupTestXDG(t)
+	app, _ := newCallbackTestApp(t)
+
+	rec, res, _ := runCallback(app, "state=state-ok&error=access_denied&error_description=denied+by+user")
+	var cbErr *oauth.AuthRequestCallbackError
+	if !errors.As(res.err, &cbErr) {
+		t.Fatalf("expected AuthRequestCallbackError, got %v", res.err)
+	}
+	if cbErr.ErrorCode != "access_denied" {
+		t.Errorf("error code = %q, want access_denied", cbErr.ErrorCode)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if _, err := LoadSessionFile(); err == nil {
+		t.Error("no session should be persisted after an error redirect")
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+)
+
+// refreshSessionPath is the XRPC endpoint atclient.PasswordAuth refreshes tokens with
+const refreshSessionPath = "/xrpc/com.atproto.server.refreshSession"
+
+// lockRefreshes coordinates token refreshes of client's password auth across
+// hb processes. atclient.PasswordAuth keeps doing the refresh and retry, and
+// swaps tokens under its own lock; the HTTP transport takes the session lock
+// around the refresh request and re-reads the stored session first: if
+// another process already rotated the refresh token, those tokens are
+// answered locally instead of refreshing again. The lock is held until the
+// refresh response is closed, so the RefreshCallback persists under it.
+func lockRefreshes(account string, client *atclient.APIClient) {
+	passAuth := client.Auth.(*atclient.PasswordAuth)
+	passAuth.RefreshCallback = func(ctx context.Context, data atclient.PasswordSessionData) {
+		if err := updateSession(account, data); err != nil {
+			slog.Warn("failed to save refreshed auth session data", "err", err)
+		}
+	}
+
+	hc := http.Client{}
+	if client.Client != nil {
+		hc = *client.Client
+	}
+	base := hc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	hc.Transport = &refreshLockTransport{account: account, did: passAuth.Session.AccountDID.String(), base: base}
+	client.Client = &hc
+}
+
+// refreshLockTransport serializes refreshSession requests on the session lock
+type refreshLockTransport struct {
+	account string
+	did     string
+	base    http.RoundTripper
+}
+
+func (t *refreshLockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, refreshSessionPath) {
+		return t.base.RoundTrip(req)
+	}
+
+	unlock, err := LockSession(t.account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another process may have refreshed while we waited for the lock
+	stored, err := loadSession(t.account)
+	if err == nil && stored.DID.String() == t.did && stored.RefreshToken != "" &&
+		req.Header.Get("Authorization") != "Bearer "+stored.RefreshToken {
+		slog.Debug("reusing session refreshed by another process", "account", t.account)
+		body, err := json.Marshal(map[string]string{
+			"accessJwt":  stored.AccessToken,
+			"refreshJwt": stored.RefreshToken,
+			"did":        t.did,
+		})
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       &unlockingBody{ReadCloser: io.NopCloser(bytes.NewReader(body)), unlock: unlock},
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	resp.Body = &unlockingBody{ReadCloser: resp.Body, unlock: unlock}
+	return resp, nil
+}
+
+// unlockingBody releases the session lock when the response body is closed
+type unlockingBody struct {
+	io.ReadCloser
+	unlock func()
+	once   sync.Once
+}
+
+func (b *unlockingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.unlock)
+	return err
+}
+
+// updateSession merges refreshed password session data into the stored
+// session. The caller must hold the session lock.
+func updateSession(account string, data atclient.PasswordSessionData) error {
+	sess, _ := loadSession(account)
+	if sess == nil {
+		sess = &Session{}
+	}
+
+	sess.DID = data.AccountDID
+	sess.AccessToken = data.AccessToken
+	sess.RefreshToken = data.RefreshToken
+	sess.PDS = data.Host
+
+	return PersistAccountSession(account, sess)
+}
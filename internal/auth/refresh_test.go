@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// mockRefreshPDS accepts only access token "fresh-access"; other tokens get
+// ExpiredToken. refreshSession rotates to fresh-access/fresh-refresh.
+func mockRefreshPDS(t *testing.T, refreshes *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.refreshSession":
+			refreshes.Add(1)
+			json.NewEncoder(w).Encode(map[string]string{
+				"accessJwt":  "fresh-access",
+				"refreshJwt": "fresh-refresh",
+				"did":        "did:plc:refresh",
+			})
+		case "/xrpc/com.atproto.server.getSession":
+			if r.Header.Get("Authorization") != "Bearer fresh-access" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "ExpiredToken"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:refresh", "handle": "refresh.test"})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestClient(host, access, refresh string) *atclient.APIClient {
+	client := atclient.ResumePasswordSession(atclient.PasswordSessionData{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		AccountDID:   syntax.DID("did:plc:refresh"),
+		Host:         host,
+	}, nil)
+	lockRefreshes(DefaultAccount, client)
+	return client
+}
+
+func TestLockedRefreshPersistsTokens(t *testing.T) {
+	setupTestXDG(t)
+	var refreshes atomic.Int32
+	srv := mockRefreshPDS(t, &refreshes)
+	defer srv.Close()
+
+	writeAccount(t, DefaultAccount, "did:plc:refresh", "refresh.test")
+	client := newTestClient(srv.URL, "stale-access", "stale-refresh")
+
+	if _, err := comatproto.ServerGetSession(context.Background(), client); err != nil {
+		t.Fatalf("ServerGetSession failed: %v", err)
+	}
+	if refreshes.Load() != 1 {
+		t.Errorf("expected 1 refresh, got %d", refreshes.Load())
+	}
+
+	sess, err := LoadSessionFile()
+	if err != nil {
+		t.Fatalf("LoadSessionFile failed: %v", err)
+	}
+	if sess.RefreshToken != "fresh-refresh" || sess.AccessToken != "fresh-access" {
+		t.Errorf("refreshed tokens not persisted: %+v", sess)
+	}
+	if sess.Handle != "refresh.test" {
+		t.Errorf("handle should be kept, got %q", sess.Handle)
+	}
+}
+
+func TestLockedRefreshReusesConcurrentRefresh(t *testing.T) {
+	setupTestXDG(t)
+	var refreshes atomic.Int32
+	srv := mockRefreshPDS(t, &refreshes)
+	defer srv.Close()
+
+	// Another process already rotated the tokens on disk
+	err := PersistAccountSession(DefaultAccount, &Session{
+		DID:          syntax.DID("did:plc:refresh"),
+		AccessToken:  "fresh-access",
+		RefreshToken: "fresh-refresh",
+	})
+	if err != nil {
+		t.Fatalf("PersistAccountSession failed: %v", err)
+	}
+	client := newTestClient(srv.URL, "stale-access", "stale-refresh")
+
+	if _, err := comatproto.ServerGetSession(context.Background(), client); err != nil {
+		t.Fatalf("ServerGetSession failed: %v", err)
+	}
+	if refreshes.Load() != 0 {
+		t.Errorf("expected stored tokens to be reused, got %d refreshes", refreshes.Load())
+	}
+}
+
+func TestLockedRefreshConcurrentRequests(t *testing.T) {
+	setupTestXDG(t)
+	var refreshes atomic.Int32
+	srv := mockRefreshPDS(t, &refreshes)
+	defer srv.Close()
+
+	writeAccount(t, DefaultAccount, "did:plc:refresh", "refresh.test")
+	client := newTestClient(srv.URL, "stale-access", "stale-refresh")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := comatproto.ServerGetSession(context.Background(), client)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ServerGetSession failed: %v", err)
+		}
+	}
+	if refreshes.Load() != 1 {
+		t.Errorf("expected 1 refresh for concurrent requests, got %d", refreshes.Load())
+	}
+}
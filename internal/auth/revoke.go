@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// refreshTokenAuth authenticates with the refresh token, as required by
+// com.atproto.server.deleteSession
+type refreshTokenAuth struct {
+	token string
+}
+
+var _ atclient.AuthMethod = refreshTokenAuth{}
+
+func (a refreshTokenAuth) DoWithAuth(c *http.Client, req *http.Request, endpoint syntax.NSID) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return c.Do(req)
+}
+
+// RevokeSession invalidates the current session on the server. Password
+// sessions are deleted on the PDS, which invalidates the refresh token;
+// OAuth tokens are revoked at the auth server. The stored session is left
+// in place (see WipeSession).
+func RevokeSession(ctx context.Context) error {
+	sess, err := CurrentSessionSource().Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if sess.OAuth != nil {
+		app := newOAuthApp(sess.OAuthCallbackURL)
+		oauthSess, err := app.ResumeSession(ctx, sess.OAuth.AccountDID, sess.OAuth.SessionID)
+		if err != nil {
+			return fmt.Errorf("failed to resume OAuth session: %w", err)
+		}
+		if oauthSess.Data.AuthServerRevocationEndpoint == "" {
+			return fmt.Errorf("auth server does not support token revocation")
+		}
+		return oauthSess.RevokeSession(ctx)
+	}
+
+	if sess.RefreshToken == "" {
+		return fmt.Errorf("session has no refresh token to revoke")
+	}
+	client := atclient.NewAPIClient(sess.PDS)
+	client.Auth = refreshTokenAuth{token: sess.RefreshToken}
+	return comatproto.ServerDeleteSession(ctx, client)
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+func TestRevokeSessionDeletesWithRefreshToken(t *testing.T) {
+	setupTestXDG(t)
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.server.deleteSession" || r.Method != http.MethodPost {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{})
+	}))
+	defer srv.Close()
+
+	sess := &Session{
+		DID:          syntax.DID("did:plc:revoke"),
+		PDS:          srv.URL,
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+	}
+	if err := PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	if err := RevokeSession(context.Background()); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if gotAuth != "Bearer refresh" {
+		t.Errorf("expected refresh token auth, got %q", gotAuth)
+	}
+
+	// The local session is untouched
+	if _, err := LoadSessionFile(); err != nil {
+		t.Errorf("session should still be stored: %v", err)
+	}
+}
+
+func TestRevokeSessionNotLoggedIn(t *testing.T) {
+	setupTestXDG(t)
+	if err := RevokeSession(context.Background()); !errors.Is(err, ErrNoAuthSession) {
+		t.Errorf("expected ErrNoAuthSession, got %v", err)
+	}
+}
+
+func TestRevokeSessionServerError(t *testing.T) {
+	setupTestXDG(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "ExpiredToken"})
+	}))
+	defer srv.Close()
+
+	if err := PersistSession(&Session{DID: "did:plc:revoke", PDS: srv.URL, RefreshToken: "old"}); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+	if err := RevokeSession(context.Background()); err == nil {
+		t.Error("expected error from server")
+	}
+}
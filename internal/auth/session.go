@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// Environment variables read by EnvSource
+const (
+	EnvUsername    = "ATP_USERNAME"
+	EnvPassword    = "ATP_PASSWORD"
+	EnvAccessToken = "ATP_ACCESS_TOKEN"
+	EnvPDSHost     = "ATP_PDS_HOST"
+)
+
+// EnvSessionSource selects the session source: "file" (the default) or "env"
+const EnvSessionSource = "HB_SESSION_SOURCE"
+
+// Session source names accepted in HB_SESSION_SOURCE
+const (
+	SourceFile = "file"
+	SourceEnv  = "env"
+)
+
+// SessionSource supplies the auth session hb acts with.
+// Load returns ErrNoAuthSession when no session is available.
+type SessionSource interface {
+	// Name identifies the source for display, e.g. the account profile
+	Name() string
+	Load(ctx context.Context) (*Session, error)
+	// Save records refreshed session data
+	Save(sess *Session) error
+	// Persistent reports whether the session is stored on disk. Only
+	// persistent sessions take the session lock and are cached on disk.
+	Persistent() bool
+}
+
+// sessionSource overrides the source selected from the environment (see SetSessionSource)
+var sessionSource SessionSource
+
+// SetSessionSource replaces the source used by RequireAuth and LoadClient.
+// Passing nil restores the environment-selected default.
+func SetSessionSource(src SessionSource) {
+	sessionSource = src
+}
+
+// DefaultSessionSource selects a source from HB_SESSION_SOURCE. "env" selects
+// an ephemeral EnvSource; otherwise the session of the active account profile
+// is read from disk. Credentials in the environment alone never switch the
+// source, since `hb account login` reads the same variables.
+func DefaultSessionSource() (SessionSource, error) {
+	switch name := os.Getenv(EnvSessionSource); name {
+	case "", SourceFile:
+		return FileSource{}, nil
+	case SourceEnv:
+		return &EnvSource{}, nil
+	default:
+		return nil, hberr.Errorf(hberr.Usage, "invalid %s %q (want %s or %s)", EnvSessionSource, name, SourceFile, SourceEnv)
+	}
+}
+
+// CurrentSessionSource returns the configured SessionSource, falling back
+// to the stored session if HB_SESSION_SOURCE is invalid
+func CurrentSessionSource() SessionSource {
+	if sessionSource != nil {
+		return sessionSource
+	}
+	if src, err := DefaultSessionSource(); err == nil {
+		return src
+	}
+	return FileSource{}
+}
+
+// FileSource reads the session of the active account profile through the
+// configured SecretStore
+type FileSource struct{}
+
+var _ SessionSource = FileSource{}
+
+func (FileSource) Name() string {
+	name, _ := ActiveAccount()
+	return name
+}
+
+func (FileSource) Load(ctx context.Context) (*Session, error) { return LoadSessionFile() }
+
+func (FileSource) Save(sess *Session) error { return PersistSession(sess) }
+
+func (FileSource) Persistent() bool { return true }
+
+// MemorySource holds a session in memory for the lifetime of the process
+type MemorySource struct {
+	mu   sync.Mutex
+	sess *Session
+}
+
+var _ SessionSource = &MemorySource{}
+
+// NewMemorySource returns a source holding sess (which may be nil)
+func NewMemorySource(sess *Session) *MemorySource {
+	m := &MemorySource{}
+	if sess != nil {
+		_ = m.Save(sess)
+	}
+	return m
+}
+
+func (m *MemorySource) Name() string { return "memory" }
+
+// Load returns a copy of the held session
+func (m *MemorySource) Load(ctx context.Context) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sess == nil {
+		return nil, ErrNoAuthSession
+	}
+	sess := *m.sess
+	return &sess, nil
+}
+
+// Save replaces the held session with a copy of sess
+func (m *MemorySource) Save(sess *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := *sess
+	m.sess = &cp
+	return nil
+}
+
+func (m *MemorySource) Persistent() bool { return false }
+
+// EnvSource authenticates from environment variables on first use and keeps
+// the session in memory, so nothing is written to disk. ATP_USERNAME and
+// ATP_PASSWORD log in with an app password; ATP_ACCESS_TOKEN uses the access
+// JWT of an existing password session and requires ATP_PDS_HOST. OAuth access
+// tokens are DPoP-bound and rejected. ATP_PDS_HOST otherwise skips resolving
+// the username to its PDS.
+type EnvSource struct {
+	mem MemorySource
+}
+
+var _ SessionSource = &EnvSource{}
+
+func (e *EnvSource) Name() string { return "env" }
+
+// Load returns the in-memory session, logging in first if needed
+func (e *EnvSource) Load(ctx context.Context) (*Session, error) {
+	if sess, err := e.mem.Load(ctx); err == nil {
+		return sess, nil
+	}
+
+	sess, err := envLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.mem.Save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (e *EnvSource) Save(sess *Session) error { return e.mem.Save(sess) }
+
+func (e *EnvSource) Persistent() bool { return false }
+
+// envLogin creates a session from the environment credentials
+func envLogin(ctx context.Context) (*Session, error) {
+	username := os.Getenv(EnvUsername)
+	password := os.Getenv(EnvPassword)
+	accessToken := os.Getenv(EnvAccessToken)
+	pdsHost := os.Getenv(EnvPDSHost)
+
+	var client *atclient.APIClient
+	var err error
+	switch {
+	case username != "" && password != "":
+		if pdsHost != "" {
+			client, err = atclient.LoginWithPasswordHost(ctx, pdsHost, username, password, "", nil)
+		} else {
+			atid, parseErr := syntax.ParseAtIdentifier(username)
+			if parseErr != nil {
+				return nil, fmt.Errorf("invalid %s: %w", EnvUsername, parseErr)
+			}
+			client, err = atclient.LoginWithPassword(ctx, ConfigDirectory(), atid, password, "", nil)
+		}
+		if err != nil {
+			return nil, hberr.Errorf(hberr.Auth, "login from %s failed: %w", EnvUsername, err)
+		}
+	case accessToken != "":
+		if pdsHost == "" {
+			return nil, hberr.Errorf(hberr.Usage, "%s requires %s", EnvAccessToken, EnvPDSHost)
+		}
+		if isDPoPBound(accessToken) {
+			return nil, hberr.Errorf(hberr.Usage,
+				"%s is a DPoP-bound OAuth token, which hb cannot send as a bearer token; use the access JWT of an app-password session, or %s and %s",
+				EnvAccessToken, EnvUsername, EnvPassword)
+		}
+		client = atclient.ResumePasswordSession(atclient.PasswordSessionData{
+			AccessToken: accessToken,
+			Host:        pdsHost,
+		}, nil)
+	default:
+		return nil, hberr.Errorf(hberr.Auth, "%s=%s but neither %s and %s nor %s is set",
+			EnvSessionSource, SourceEnv, EnvUsername, EnvPassword, EnvAccessToken)
+	}
+
+	resp, err := comatproto.ServerGetSession(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session info: %w", err)
+	}
+	did, err := syntax.ParseDID(resp.Did)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DID in session: %w", err)
+	}
+
+	passAuth := client.Auth.(*atclient.PasswordAuth)
+	return &Session{
+		DID:          did,
+		PDS:          client.Host,
+		Handle:       resp.Handle,
+		Password:     password,
+		AccessToken:  passAuth.Session.AccessToken,
+		RefreshToken: passAuth.Session.RefreshToken,
+	}, nil
+}
+
+// isDPoPBound reports whether token is a JWT bound to a DPoP key (RFC 9449
+// "cnf.jkt" claim), as OAuth access tokens are. Opaque tokens report false.
+func isDPoPBound(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Cnf struct {
+			JKT string `json:"jkt"`
+		} `json:"cnf"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return false
+	}
+	return claims.Cnf.JKT != ""
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// mockLoginPDS accepts password "app-pass" for ci.test and access token "ci-access"
+func mockLoginPDS(t *testing.T, logins *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.createSession":
+			var body struct {
+				Identifier string `json:"identifier"`
+				Password   string `json:"password"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Password != "app-pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "AuthenticationRequired"})
+				return
+			}
+			logins.Add(1)
+			json.NewEncoder(w).Encode(map[string]string{
+				"accessJwt":  "ci-access",
+				"refreshJwt": "ci-refresh",
+				"did":        "did:plc:ci",
+				"handle":     "ci.test",
+			})
+		case "/xrpc/com.atproto.server.getSession":
+			if r.Header.Get("Authorization") != "Bearer ci-access" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "ExpiredToken"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:ci", "handle": "ci.test"})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+// assertNoStateFiles fails if anything was written to the XDG state directory
+func assertNoStateFiles(t *testing.T, stateDir string) {
+	t.Helper()
+	filepath.Walk(stateDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("unexpected file written: %s", path)
+		}
+		return nil
+	})
+}
+
+func TestDefaultSessionSource(t *testing.T) {
+	t.Setenv(EnvSessionSource, "")
+	t.Setenv(EnvUsername, "ci.test")
+	t.Setenv(EnvPassword, "app-pass")
+	t.Setenv(EnvAccessToken, "token")
+
+	// Credentials alone must not bypass the stored session: login reads them too
+	src, err := DefaultSessionSource()
+	if err != nil {
+		t.Fatalf("DefaultSessionSource failed: %v", err)
+	}
+	if _, ok := src.(FileSource); !ok {
+		t.Error("expected FileSource without HB_SESSION_SOURCE")
+	}
+
+	t.Setenv(EnvSessionSource, SourceFile)
+	if src, _ := DefaultSessionSource(); src == nil || !src.Persistent() {
+		t.Error("expected FileSource with HB_SESSION_SOURCE=file")
+	}
+
+	t.Setenv(EnvSessionSource, SourceEnv)
+	if src, _ := DefaultSessionSource(); src == nil {
+		t.Error("expected EnvSource with HB_SESSION_SOURCE=env")
+	} else if _, ok := src.(*EnvSource); !ok {
+		t.Error("expected EnvSource with HB_SESSION_SOURCE=env")
+	}
+
+	t.Setenv(EnvSessionSource, "keychain")
+	if _, err := DefaultSessionSource(); err == nil {
+		t.Error("expected error for an unknown HB_SESSION_SOURCE")
+	}
+}
+
+func TestEnvSourceWithoutCredentials(t *testing.T) {
+	t.Setenv(EnvUsername, "")
+	t.Setenv(EnvPassword, "")
+	t.Setenv(EnvAccessToken, "")
+
+	_, err := (&EnvSource{}).Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), EnvSessionSource) {
+		t.Errorf("expected an error naming %s, got %v", EnvSessionSource, err)
+	}
+}
+
+func TestMemorySource(t *testing.T) {
+	src := NewMemorySource(nil)
+	if _, err := src.Load(context.Background()); !errors.Is(err, ErrNoAuthSession) {
+		t.Fatalf("expected ErrNoAuthSession, got %v", err)
+	}
+
+	sess := &Session{DID: syntax.DID("did:plc:mem"), Handle: "mem.test"}
+	if err := src.Save(sess); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	sess.Handle = "changed.test"
+
+	loaded, err := src.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Handle != "mem.test" {
+		t.Errorf("expected stored copy to be unaffected, got %s", loaded.Handle)
+	}
+	if src.Persistent() {
+		t.Error("MemorySource must not be persistent")
+	}
+}
+
+func TestEnvSourcePasswordLogin(t *testing.T) {
+	stateDir := setupTestXDG(t)
+	var logins atomic.Int32
+	srv := mockLoginPDS(t, &logins)
+	defer srv.Close()
+
+	t.Setenv(EnvUsername, "ci.test")
+	t.Setenv(EnvPassword, "app-pass")
+	t.Setenv(EnvPDSHost, srv.URL)
+	SetSessionSource(&EnvSource{})
+	t.Cleanup(func() { SetSessionSource(nil) })
+
+	ctx := context.Background()
+	sess, err := RequireAuth(ctx)
+	if err != nil {
+		t.Fatalf("RequireAuth failed: %v", err)
+	}
+	if sess.DID != "did:plc:ci" || sess.Handle != "ci.test" {
+		t.Errorf("unexpected session: %s %s", sess.DID, sess.Handle)
+	}
+
+	client, err := LoadClient(ctx)
+	if err != nil {
+		t.Fatalf("LoadClient failed: %v", err)
+	}
+	if _, err := comatproto.ServerGetSession(ctx, client); err != nil {
+		t.Fatalf("getSession failed: %v", err)
+	}
+
+	if n := logins.Load(); n != 1 {
+		t.Errorf("expected a single login per invocation, got %d", n)
+	}
+	assertNoStateFiles(t, stateDir)
+}
+
+func TestEnvSourceAccessToken(t *testing.T) {
+	stateDir := setupTestXDG(t)
+	var logins atomic.Int32
+	srv := mockLoginPDS(t, &logins)
+	defer srv.Close()
+
+	t.Setenv(EnvUsername, "")
+	t.Setenv(EnvPassword, "")
+	t.Setenv(EnvAccessToken, "ci-access")
+	t.Setenv(EnvPDSHost, srv.URL)
+
+	sess, err := (&EnvSource{}).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if sess.DID != "did:plc:ci" || sess.AccessToken != "ci-access" {
+		t.Errorf("unexpected session: %+v", sess)
+	}
+	if logins.Load() != 0 {
+		t.Error("access token mode must not create a session")
+	}
+	assertNoStateFiles(t, stateDir)
+}
+
+func TestEnvSourceAccessTokenRequiresHost(t *testing.T) {
+	t.Setenv(EnvUsername, "")
+	t.Setenv(EnvPassword, "")
+	t.Setenv(EnvAccessToken, "ci-access")
+	t.Setenv(EnvPDSHost, "")
+
+	if _, err := (&EnvSource{}).Load(context.Background()); err == nil {
+		t.Error("expected error without ATP_PDS_HOST")
+	}
+}
+
+// testJWT builds an unsigned JWT with the given payload claims
+func testJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"typ":"at+jwt","alg":"ES256"}`)) + "." + enc.EncodeToString(payload) + ".sig"
+}
+
+func TestEnvSourceRejectsOAuthToken(t *testing.T) {
+	var logins atomic.Int32
+	srv := mockLoginPDS(t, &logins)
+	defer srv.Close()
+
+	t.Setenv(EnvUsername, "")
+	t.Setenv(EnvPassword, "")
+	t.Setenv(EnvPDSHost, srv.URL)
+	t.Setenv(EnvAccessToken, testJWT(t, map[string]any{
+		"sub": "did:plc:ci",
+		"cnf": map[string]string{"jkt": "thumbprint"},
+	}))
+
+	_, err := (&EnvSource{}).Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "DPoP") {
+		t.Errorf("expected DPoP-bound token to be rejected, got %v", err)
+	}
+
+	if isDPoPBound(testJWT(t, map[string]any{"sub": "did:plc:ci", "scope": "com.atproto.access"})) {
+		t.Error("password session JWT reported as DPoP-bound")
+	}
+	if isDPoPBound("opaque-token") {
+		t.Error("opaque token reported as DPoP-bound")
+	}
+}
+
+func TestLoadClientMemorySourceRelogin(t *testing.T) {
+	stateDir := setupTestXDG(t)
+	var logins atomic.Int32
+	srv := mockLoginPDS(t, &logins)
+	defer srv.Close()
+
+	src := NewMemorySource(&Session{
+		DID:         syntax.DID("did:plc:ci"),
+		PDS:         srv.URL,
+		Handle:      "ci.test",
+		Password:    "app-pass",
+		AccessToken: "stale-access",
+	})
+	SetSessionSource(src)
+	t.Cleanup(func() { SetSessionSource(nil) })
+
+	if _, err := LoadClient(context.Background()); err != nil {
+		t.Fatalf("LoadClient failed: %v", err)
+	}
+
+	sess, _ := src.Load(context.Background())
+	if sess.AccessToken != "ci-access" || sess.RefreshToken != "ci-refresh" {
+		t.Errorf("expected new tokens in memory, got %s/%s", sess.AccessToken, sess.RefreshToken)
+	}
+	assertNoStateFiles(t, stateDir)
+}
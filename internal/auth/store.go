@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+)
+
+// SecretStore persists serialized session data for account profiles.
+// Load returns ErrNoAuthSession when the profile has no stored session.
+type SecretStore interface {
+	Load(name string) ([]byte, error)
+	Save(name string, data []byte) error
+	Delete(name string) error
+	List() ([]string, error)
+}
+
+// secretStore overrides the store selected from the environment (see SetSecretStore)
+var secretStore SecretStore
+
+// SetSecretStore replaces the store used for all session reads and writes.
+// Passing nil restores the environment-selected default.
+func SetSecretStore(store SecretStore) {
+	secretStore = store
+}
+
+// DefaultSecretStore selects a store from the environment:
+// HB_KEY_FILE or HB_PASSPHRASE select the encrypted store, otherwise
+// sessions are stored as plaintext JSON with 0600 permissions.
+func DefaultSecretStore() (SecretStore, error) {
+	if path := os.Getenv("HB_KEY_FILE"); path != "" {
+		return NewKeyFileStore(FileStore{}, path)
+	}
+	if passphrase := os.Getenv("HB_PASSPHRASE"); passphrase != "" {
+		return NewPassphraseStore(FileStore{}, passphrase), nil
+	}
+	return FileStore{}, nil
+}
+
+// defaultStore caches the environment-selected store, so an
+// EncryptedStore's derived keys are reused across session reads and writes
+var defaultStore struct {
+	sync.Mutex
+	// env is the HB_KEY_FILE and HB_PASSPHRASE the store was selected from
+	env   [2]string
+	store SecretStore
+}
+
+// currentStore returns the configured SecretStore
+func currentStore() (SecretStore, error) {
+	if secretStore != nil {
+		return secretStore, nil
+	}
+	defaultStore.Lock()
+	defer defaultStore.Unlock()
+	env := [2]string{os.Getenv("HB_KEY_FILE"), os.Getenv("HB_PASSPHRASE")}
+	if defaultStore.store != nil && defaultStore.env == env {
+		return defaultStore.store, nil
+	}
+	store, err := DefaultSecretStore()
+	if err != nil {
+		return nil, err
+	}
+	defaultStore.env, defaultStore.store = env, store
+	return store, nil
+}
+
+// FileStore stores session data as files in the XDG state directory
+type FileStore struct{}
+
+var _ SecretStore = FileStore{}
+
+// Load reads the session file for a profile
+func (FileStore) Load(name string) ([]byte, error) {
+	fPath, err := xdg.SearchStateFile(sessionFile(name))
+	if err != nil {
+		return nil, ErrNoAuthSession
+	}
+	return os.ReadFile(fPath)
+}
+
+// Save writes the session file for a profile with 0600 permissions.
+// The data is written to a temporary file and renamed into place, so a
+// crash never leaves a truncated session behind.
+func (FileStore) Save(name string, data []byte) error {
+	fPath, err := xdg.StateFile(sessionFile(name))
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp uses 0600 permissions
+	f, err := os.CreateTemp(filepath.Dir(fPath), "."+filepath.Base(fPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fPath)
+}
+
+// Delete removes the session file for a profile. A missing file is not an error.
+func (FileStore) Delete(name string) error {
+	fPath, err := xdg.SearchStateFile(sessionFile(name))
+	if err != nil {
+		// File doesn't exist, nothing to wipe
+		return nil
+	}
+	return os.Remove(fPath)
+}
+
+// List returns the names of all profiles with a session file, sorted
+func (FileStore) List() ([]string, error) {
+	var names []string
+	if _, err := xdg.SearchStateFile(defaultSessionFile); err == nil {
+		names = append(names, DefaultAccount)
+	}
+
+	dir := filepath.Join(xdg.StateHome, accountsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || ValidateAccountName(name) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ErrNothingToMigrate is returned by MigrateSessions when no encryption is
+// configured and passwords are kept, so there is nothing to convert
+var ErrNothingToMigrate = errors.New("no encryption configured (set HB_PASSPHRASE or HB_KEY_FILE, or use --token-only)")
+
+// MigrateSessions rewrites stored sessions through the configured SecretStore,
+// encrypting plaintext session files. With tokenOnly, stored app passwords
+// are removed as well. Returns the names of the profiles that were rewritten.
+func MigrateSessions(tokenOnly bool) ([]string, error) {
+	store, err := currentStore()
+	if err != nil {
+		return nil, err
+	}
+	enc, encrypted := store.(*EncryptedStore)
+	if !encrypted && !tokenOnly {
+		return nil, ErrNothingToMigrate
+	}
+
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []string
+	for _, name := range names {
+		sess, err := loadSession(name)
+		if err != nil {
+			return migrated, fmt.Errorf("account %s: %w", name, err)
+		}
+
+		needsEncryption := false
+		if encrypted {
+			raw, err := enc.Inner.Load(name)
+			if err != nil {
+				return migrated, fmt.Errorf("account %s: %w", name, err)
+			}
+			needsEncryption = !IsEncrypted(raw)
+		}
+		needsStrip := tokenOnly && sess.Password != ""
+		if !needsEncryption && !needsStrip {
+			continue
+		}
+
+		if tokenOnly {
+			sess.Password = ""
+		}
+		if err := PersistAccountSession(name, sess); err != nil {
+			return migrated, fmt.Errorf("account %s: %w", name, err)
+		}
+		migrated = append(migrated, name)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+func TestDefaultSecretStore(t *testing.T) {
+	t.Setenv("HB_KEY_FILE", "")
+	t.Setenv("HB_PASSPHRASE", "")
+	store, err := DefaultSecretStore()
+	if err != nil {
+		t.Fatalf("DefaultSecretStore failed: %v", err)
+	}
+	if _, ok := store.(FileStore); !ok {
+		t.Errorf("expected FileStore, got %T", store)
+	}
+
+	t.Setenv("HB_PASSPHRASE", "pass")
+	store, err = DefaultSecretStore()
+	if err != nil {
+		t.Fatalf("DefaultSecretStore failed: %v", err)
+	}
+	if _, ok := store.(*EncryptedStore); !ok {
+		t.Errorf("expected EncryptedStore, got %T", store)
+	}
+}
+
+func TestCurrentStoreReused(t *testing.T) {
+	t.Setenv("HB_KEY_FILE", "")
+	t.Setenv("HB_PASSPHRASE", "pass")
+	first, err := currentStore()
+	if err != nil {
+		t.Fatalf("currentStore failed: %v", err)
+	}
+	second, _ := currentStore()
+	if first != second {
+		t.Error("the store, and its derived keys, should be reused")
+	}
+
+	t.Setenv("HB_PASSPHRASE", "other")
+	if third, _ := currentStore(); third == first {
+		t.Error("a new passphrase should select a new store")
+	}
+}
+
+func TestEncryptedSessionWithoutKey(t *testing.T) {
+	setupTestXDG(t)
+	t.Setenv("HB_PASSPHRASE", "pass")
+	writeAccount(t, DefaultAccount, "did:plc:enc", "enc.test")
+
+	t.Setenv("HB_PASSPHRASE", "")
+	if _, err := LoadSessionFile(); !errors.Is(err, ErrSessionEncrypted) {
+		t.Errorf("expected ErrSessionEncrypted, got %v", err)
+	}
+}
+
+func TestMigrateSessions(t *testing.T) {
+	t.Run("nothing to migrate without encryption", func(t *testing.T) {
+		setupTestXDG(t)
+		t.Setenv("HB_PASSPHRASE", "")
+		if _, err := MigrateSessions(false); !errors.Is(err, ErrNothingToMigrate) {
+			t.Errorf("expected ErrNothingToMigrate, got %v", err)
+		}
+	})
+
+	t.Run("encrypts plaintext sessions", func(t *testing.T) {
+		setupTestXDG(t)
+		t.Setenv("HB_PASSPHRASE", "")
+		writeAccount(t, DefaultAccount, "did:plc:one", "one.test")
+		writeAccount(t, "two", "did:plc:two", "two.test")
+
+		t.Setenv("HB_PASSPHRASE", "pass")
+		migrated, err := MigrateSessions(false)
+		if err != nil {
+			t.Fatalf("MigrateSessions failed: %v", err)
+		}
+		if len(migrated) != 2 {
+			t.Errorf("expected 2 migrated accounts, got %v", migrated)
+		}
+		for _, name := range []string{DefaultAccount, "two"} {
+			raw, err := FileStore{}.Load(name)
+			if err != nil {
+				t.Fatalf("raw Load(%s) failed: %v", name, err)
+			}
+			if !IsEncrypted(raw) {
+				t.Errorf("account %s should be encrypted", name)
+			}
+		}
+
+		// Running again is a no-op
+		migrated, err = MigrateSessions(false)
+		if err != nil {
+			t.Fatalf("second MigrateSessions failed: %v", err)
+		}
+		if len(migrated) != 0 {
+			t.Errorf("expected no accounts migrated twice, got %v", migrated)
+		}
+	})
+
+	t.Run("token-only removes passwords", func(t *testing.T) {
+		setupTestXDG(t)
+		t.Setenv("HB_PASSPHRASE", "")
+		err := PersistAccountSession(DefaultAccount, &Session{
+			DID:      syntax.DID("did:plc:pw"),
+			Password: "app-password",
+		})
+		if err != nil {
+			t.Fatalf("PersistAccountSession failed: %v", err)
+		}
+
+		if _, err := MigrateSessions(true); err != nil {
+			t.Fatalf("MigrateSessions failed: %v", err)
+		}
+		sess, err := LoadSessionFile()
+		if err != nil {
+			t.Fatalf("LoadSessionFile failed: %v", err)
+		}
+		if sess.Password != "" {
+			t.Error("password should be removed")
+		}
+	})
+}
+
+func TestFileStoreSaveIsAtomic(t *testing.T) {
+	tmpDir := setupTestXDG(t)
+
+	for _, data := range []string{`{"a":1}`, `{"b":2}`} {
+		if err := (FileStore{}).Save("work", []byte(data)); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	got, err := FileStore{}.Load("work")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != `{"b":2}` {
+		t.Errorf("Load = %s, want {\"b\":2}", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(tmpDir, "heartbeads", "accounts"))
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/adrg/xdg"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// ErrIdentityUnverified is returned when the session identity cannot be verified
+var ErrIdentityUnverified = hberr.New(hberr.Auth, "identity verification failed")
+
+// VerifiedIdentity is a session identity confirmed against the PDS and the
+// identity directory
+type VerifiedIdentity struct {
+	DID        syntax.DID `json:"did"`
+	Handle     string     `json:"handle"`
+	VerifiedAt time.Time  `json:"verified_at"`
+}
+
+// verifyCacheFile returns the XDG-relative cache path for a profile
+func verifyCacheFile(account string) string {
+	return "heartbeads/verified/" + account + ".json"
+}
+
+// VerifyIdentity confirms that the session's tokens are valid on its PDS,
+// that the account is active, and that handle and DID resolve to each other.
+// Successful results are cached for ttl, so most calls stay offline.
+// Failures clear the cache and wrap ErrIdentityUnverified. Sessions from a
+// non-persistent source are verified on every call and never cached.
+func VerifyIdentity(ctx context.Context, sess *Session, ttl time.Duration) (*VerifiedIdentity, error) {
+	if !CurrentSessionSource().Persistent() {
+		return verifyIdentityOnline(ctx, sess)
+	}
+
+	account, err := ActiveAccount()
+	if err != nil {
+		return nil, err
+	}
+	if cached := cachedIdentity(account, sess, ttl); cached != nil {
+		return cached, nil
+	}
+
+	ident, err := verifyIdentityOnline(ctx, sess)
+	if err != nil {
+		clearVerified(account)
+		return nil, err
+	}
+
+	// Caching is an optimization; verification itself succeeded
+	_ = saveVerified(account, ident)
+	return ident, nil
+}
+
+// CachedIdentity returns the cached verification of sess if it is younger
+// than ttl, or nil. Nothing is checked online.
+func CachedIdentity(sess *Session, ttl time.Duration) *VerifiedIdentity {
+	if !CurrentSessionSource().Persistent() {
+		return nil
+	}
+	account, err := ActiveAccount()
+	if err != nil {
+		return nil
+	}
+	return cachedIdentity(account, sess, ttl)
+}
+
+func cachedIdentity(account string, sess *Session, ttl time.Duration) *VerifiedIdentity {
+	cached := loadVerified(account)
+	if cached == nil || cached.DID != sess.DID || cached.Handle != sess.Handle || time.Since(cached.VerifiedAt) >= ttl {
+		return nil
+	}
+	return cached
+}
+
+// verifyIdentityOnline verifies sess against its PDS and the configured directory
+func verifyIdentityOnline(ctx context.Context, sess *Session) (*VerifiedIdentity, error) {
+	client, resp, err := loadClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: session rejected by PDS: %v", ErrIdentityUnverified, err)
+	}
+	dir := ConfigDirectory()
+	purgeIdentity(ctx, dir, sess)
+	return checkIdentity(ctx, client, resp, dir, sess)
+}
+
+// purgeIdentity drops cached resolutions of the session's DID and handle, so
+// verification always resolves them fresh rather than from the identity cache.
+// The verify ttl is then the only cache in effect.
+func purgeIdentity(ctx context.Context, dir identity.Directory, sess *Session) {
+	_ = dir.Purge(ctx, sess.DID.AtIdentifier())
+	if handle, err := syntax.ParseHandle(sess.Handle); err == nil {
+		_ = dir.Purge(ctx, handle.AtIdentifier())
+	}
+}
+
+// checkIdentity performs the session and bidirectional handle<->DID checks.
+// resp is the session's getSession response if the caller already has one;
+// otherwise it is fetched with client.
+func checkIdentity(ctx context.Context, client *atclient.APIClient, resp *comatproto.ServerGetSession_Output, dir identity.Directory, sess *Session) (*VerifiedIdentity, error) {
+	if resp == nil {
+		var err error
+		if resp, err = comatproto.ServerGetSession(ctx, client); err != nil {
+			return nil, fmt.Errorf("%w: session rejected by PDS: %v", ErrIdentityUnverified, err)
+		}
+	}
+	if resp.Did != sess.DID.String() {
+		return nil, fmt.Errorf("%w: PDS session is for %s, not %s", ErrIdentityUnverified, resp.Did, sess.DID)
+	}
+	if resp.Active != nil && !*resp.Active {
+		status := "deactivated"
+		if resp.Status != nil {
+			status = *resp.Status
+		}
+		return nil, fmt.Errorf("%w: account is not active (%s)", ErrIdentityUnverified, status)
+	}
+	if !strings.EqualFold(resp.Handle, sess.Handle) {
+		return nil, fmt.Errorf("%w: handle changed from %s to %s (run: hb account login)", ErrIdentityUnverified, sess.Handle, resp.Handle)
+	}
+
+	// DID -> handle: the DID document must claim the handle
+	byDID, err := dir.LookupDID(ctx, sess.DID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to resolve %s: %v", ErrIdentityUnverified, sess.DID, err)
+	}
+	if !strings.EqualFold(byDID.Handle.String(), sess.Handle) {
+		return nil, fmt.Errorf("%w: %s does not claim handle %s", ErrIdentityUnverified, sess.DID, sess.Handle)
+	}
+
+	// handle -> DID: the handle must resolve back to the same DID
+	handle, err := syntax.ParseHandle(sess.Handle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid handle %q", ErrIdentityUnverified, sess.Handle)
+	}
+	byHandle, err := dir.LookupHandle(ctx, handle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to resolve %s: %v", ErrIdentityUnverified, sess.Handle, err)
+	}
+	if byHandle.DID != sess.DID {
+		return nil, fmt.Errorf("%w: %s resolves to %s, not %s", ErrIdentityUnverified, sess.Handle, byHandle.DID, sess.DID)
+	}
+
+	return &VerifiedIdentity{
+		DID:        sess.DID,
+		Handle:     sess.Handle,
+		VerifiedAt: time.Now().UTC(),
+	}, nil
+}
+
+func loadVerified(account string) *VerifiedIdentity {
+	fPath, err := xdg.SearchCacheFile(verifyCacheFile(account))
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil
+	}
+	var ident VerifiedIdentity
+	if json.Unmarshal(data, &ident) != nil {
+		return nil
+	}
+	return &ident
+}
+
+func saveVerified(account string, ident *VerifiedIdentity) error {
+	fPath, err := xdg.CacheFile(verifyCacheFile(account))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ident)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath, data, 0600)
+}
+
+// clearVerified drops a cached verification, e.g. after logout or a failed check
+func clearVerified(account string) {
+	if fPath, err := xdg.SearchCacheFile(verifyCacheFile(account)); err == nil {
+		_ = os.Remove(fPath)
+	}
+}
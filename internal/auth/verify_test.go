@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// mockSessionPDS serves getSession with the given response body
+func mockSessionPDS(t *testing.T, body map[string]any) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+}
+
+func mockDirectory(did, handle string) identity.Directory {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID(did), Handle: syntax.Handle(handle)})
+	return dir
+}
+
+func TestCheckIdentity(t *testing.T) {
+	sess := &Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test"}
+
+	tests := []struct {
+		name    string
+		body    map[string]any
+		dir     identity.Directory
+		wantErr bool
+	}{
+		{
+			name: "verified",
+			body: map[string]any{"did": "did:plc:alice", "handle": "alice.test"},
+			dir:  mockDirectory("did:plc:alice", "alice.test"),
+		},
+		{
+			name:    "PDS session for another DID",
+			body:    map[string]any{"did": "did:plc:mallory", "handle": "alice.test"},
+			dir:     mockDirectory("did:plc:alice", "alice.test"),
+			wantErr: true,
+		},
+		{
+			name:    "handle changed",
+			body:    map[string]any{"did": "did:plc:alice", "handle": "alice2.test"},
+			dir:     mockDirectory("did:plc:alice", "alice.test"),
+			wantErr: true,
+		},
+		{
+			name:    "deactivated account",
+			body:    map[string]any{"did": "did:plc:alice", "handle": "alice.test", "active": false},
+			dir:     mockDirectory("did:plc:alice", "alice.test"),
+			wantErr: true,
+		},
+		{
+			name:    "DID does not claim handle",
+			body:    map[string]any{"did": "did:plc:alice", "handle": "alice.test"},
+			dir:     mockDirectory("did:plc:alice", "other.test"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := mockSessionPDS(t, tt.body)
+			defer srv.Close()
+
+			client := atclient.NewAPIClient(srv.URL)
+			ident, err := checkIdentity(context.Background(), client, nil, tt.dir, sess)
+			if tt.wantErr {
+				if !errors.Is(err, ErrIdentityUnverified) {
+					t.Errorf("expected ErrIdentityUnverified, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkIdentity failed: %v", err)
+			}
+			if ident.DID != sess.DID || ident.Handle != sess.Handle {
+				t.Errorf("unexpected identity: %+v", ident)
+			}
+		})
+	}
+}
+
+func TestVerifyIdentityCache(t *testing.T) {
+	setupTestXDG(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+
+	// The PDS is unreachable, so only a cache hit can succeed
+	sess := &Session{DID: syntax.DID("did:plc:cached"), Handle: "cached.test", PDS: "http://127.0.0.1:1"}
+	if err := PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+	if err := saveVerified(DefaultAccount, &VerifiedIdentity{DID: sess.DID, Handle: sess.Handle, VerifiedAt: time.Now()}); err != nil {
+		t.Fatalf("saveVerified failed: %v", err)
+	}
+
+	if _, err := VerifyIdentity(context.Background(), sess, time.Hour); err != nil {
+		t.Fatalf("expected cache hit, got %v", err)
+	}
+
+	// An expired entry forces an online check, which fails and clears the cache
+	if _, err := VerifyIdentity(context.Background(), sess, time.Nanosecond); !errors.Is(err, ErrIdentityUnverified) {
+		t.Fatalf("expected ErrIdentityUnverified, got %v", err)
+	}
+	if loadVerified(DefaultAccount) != nil {
+		t.Error("failed verification should clear the cache")
+	}
+}
+
+func TestPurgeIdentityIgnoresStaleCache(t *testing.T) {
+	ctx := context.Background()
+	sess := &Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test"}
+	srv := mockSessionPDS(t, map[string]any{"did": "did:plc:alice", "handle": "alice.test"})
+	defer srv.Close()
+	client := atclient.NewAPIClient(srv.URL)
+
+	// The cache still maps the handle to the DID it used to belong to
+	cacheDir := t.TempDir()
+	stale := &DiskCacheDirectory{Inner: mockDirectory("did:plc:old", "alice.test"), Dir: cacheDir, TTL: time.Hour}
+	if _, err := stale.LookupHandle(ctx, syntax.Handle("alice.test")); err != nil {
+		t.Fatalf("LookupHandle failed: %v", err)
+	}
+
+	dir := &DiskCacheDirectory{Inner: mockDirectory("did:plc:alice", "alice.test"), Dir: cacheDir, TTL: time.Hour}
+	purgeIdentity(ctx, dir, sess)
+	if _, err := checkIdentity(ctx, client, nil, dir, sess); err != nil {
+		t.Errorf("expected verification against fresh resolution, got %v", err)
+	}
+
+	// and the reverse: a cached match must not hide a handle that moved away
+	moved := &Session{DID: syntax.DID("did:plc:old"), Handle: "alice.test"}
+	srvOld := mockSessionPDS(t, map[string]any{"did": "did:plc:old", "handle": "alice.test"})
+	defer srvOld.Close()
+	stale = &DiskCacheDirectory{Inner: mockDirectory("did:plc:old", "alice.test"), Dir: t.TempDir(), TTL: time.Hour}
+	if _, err := stale.LookupHandle(ctx, syntax.Handle("alice.test")); err != nil {
+		t.Fatalf("LookupHandle failed: %v", err)
+	}
+	stale.Inner = mockDirectory("did:plc:alice", "alice.test")
+	purgeIdentity(ctx, stale, moved)
+	if _, err := checkIdentity(ctx, atclient.NewAPIClient(srvOld.URL), nil, stale, moved); !errors.Is(err, ErrIdentityUnverified) {
+		t.Errorf("expected ErrIdentityUnverified for a moved handle, got %v", err)
+	}
+}
+
+func TestCheckIdentityReusesSession(t *testing.T) {
+	sess := &Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test"}
+	resp := &comatproto.ServerGetSession_Output{Did: "did:plc:alice", Handle: "alice.test"}
+
+	// No client: the getSession response from loading it is used as is
+	if _, err := checkIdentity(context.Background(), nil, resp, mockDirectory("did:plc:alice", "alice.test"), sess); err != nil {
+		t.Errorf("checkIdentity failed: %v", err)
+	}
+
+	resp.Handle = "alice2.test"
+	if _, err := checkIdentity(context.Background(), nil, resp, mockDirectory("did:plc:alice", "alice.test"), sess); !errors.Is(err, ErrIdentityUnverified) {
+		t.Errorf("expected ErrIdentityUnverified for a changed handle, got %v", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 )
 
 // graphQLRequest represents a GraphQL request payload.
@@ -66,11 +68,31 @@ const graphQLQuery = `query FetchRecords($collection: String!, $first: Int, $aft
   }
 }`
 
+// graphQLQueryByDID is graphQLQuery restricted to the records of one repo
+const graphQLQueryByDID = `query FetchRecordsByDID($collection: String!, $did: String!, $first: Int, $after: String) {
+  records(collection: $collection, did: $did, first: $first, after: $after) {
+    edges {
+      node {
+        cid
+        collection
+        did
+        rkey
+        uri
+        value
+      }
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
 // fetchPage fetches a single page of records from the GraphQL indexer.
-func fetchPage(ctx context.Context, indexerURL string, variables map[string]interface{}) (*graphQLResponse, error) {
+func fetchPage(ctx context.Context, indexerURL, query string, variables map[string]interface{}) (*graphQLResponse, error) {
 	// Create GraphQL request
 	reqBody := graphQLRequest{
-		Query:     graphQLQuery,
+		Query:     query,
 		Variables: variables,
 	}
 
@@ -89,24 +111,24 @@ func fetchPage(ctx context.Context, indexerURL string, variables map[string]inte
 	// Execute request
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, hberr.Errorf(hberr.Unavailable, "failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, hberr.Errorf(hberr.Unavailable, "unexpected status code: %d", resp.StatusCode)
 	}
 
 	// Parse response
 	var gqlResp graphQLResponse
 	if err := json.NewDecoder(resp.Body).Decode(&gqlResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, hberr.Errorf(hberr.Unavailable, "failed to decode response: %w", err)
 	}
 
 	// Check for GraphQL errors
 	if len(gqlResp.Errors) > 0 {
-		return nil, fmt.Errorf("graphql error: %s", gqlResp.Errors[0].Message)
+		return nil, hberr.Errorf(hberr.Unavailable, "graphql error: %s", gqlResp.Errors[0].Message)
 	}
 
 	return &gqlResp, nil
@@ -115,6 +137,18 @@ func fetchPage(ctx context.Context, indexerURL string, variables map[string]inte
 // FetchRecordsByCollection queries the Hypergoat GraphQL indexer for all records
 // in the given collection. Paginates automatically (100 per page, max 5 pages).
 func FetchRecordsByCollection(ctx context.Context, indexerURL, collection string) ([]IndexerRecord, error) {
+	return fetchRecords(ctx, indexerURL, graphQLQuery, map[string]interface{}{"collection": collection})
+}
+
+// FetchRecordsByDID queries the indexer for the records of one DID in the
+// given collection, so the result does not grow with other repos' activity.
+// Paginates like FetchRecordsByCollection.
+func FetchRecordsByDID(ctx context.Context, indexerURL, collection, did string) ([]IndexerRecord, error) {
+	return fetchRecords(ctx, indexerURL, graphQLQueryByDID, map[string]interface{}{"collection": collection, "did": did})
+}
+
+// fetchRecords runs query page by page with the given filter variables
+func fetchRecords(ctx context.Context, indexerURL, query string, filter map[string]interface{}) ([]IndexerRecord, error) {
 	allRecords := make([]IndexerRecord, 0)
 	var cursor *string
 	const maxPages = 5
@@ -123,15 +157,17 @@ func FetchRecordsByCollection(ctx context.Context, indexerURL, collection string
 	for page := 0; page < maxPages; page++ {
 		// Build request variables
 		variables := map[string]interface{}{
-			"collection": collection,
-			"first":      pageSize,
+			"first": pageSize,
+		}
+		for k, v := range filter {
+			variables[k] = v
 		}
 		if cursor != nil {
 			variables["after"] = *cursor
 		}
 
 		// Fetch page
-		gqlResp, err := fetchPage(ctx, indexerURL, variables)
+		gqlResp, err := fetchPage(ctx, indexerURL, query, variables)
 		if err != nil {
 			return nil, err
 		}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -251,3 +252,37 @@ func TestFetchRecordsEmpty(t *testing.T) {
 		t.Errorf("expected empty slice, got %d records", len(records))
 	}
 }
+
+func TestFetchRecordsByDID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.Variables["did"] != "did:plc:alice" {
+			t.Errorf("expected did did:plc:alice, got %v", req.Variables["did"])
+		}
+		if !strings.Contains(req.Query, "did: $did") {
+			t.Errorf("query should filter by DID: %s", req.Query)
+		}
+
+		resp := graphQLResponse{
+			Data: &graphQLData{
+				Records: &recordsPage{
+					Edges: []recordEdge{{Node: IndexerRecord{URI: "at://did:plc:alice/c/1", DID: "did:plc:alice", Collection: "c"}}},
+				},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	records, err := FetchRecordsByDID(context.Background(), server.URL, "c", "did:plc:alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].DID != "did:plc:alice" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
@@ -3,10 +3,16 @@ package comments
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
 	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/config"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 	"github.com/urfave/cli/v3"
 )
 
@@ -29,7 +35,8 @@ Examples:
   hb comment get --filter "beads-map-*"         Filter by glob pattern
   hb comment get beads-map-3jy --json           Machine-readable output
   hb comment add beads-map-3jy "LGTM"           Post a comment (requires login)
-  hb comment add --reply-to at://... beads-map-3jy "thanks!"`,
+  hb comment add --reply-to at://... beads-map-3jy "thanks!"
+  hb comment flush                              Post comments queued offline`,
 	Action: fallbackAction,
 	Commands: []*cli.Command{
 		{
@@ -92,7 +99,25 @@ ATProto repo. Use --reply-to to reply to an existing comment by its AT-URI.`,
 					Usage: "AT-URI of parent comment to reply to",
 				},
 			},
-			Action: runCommentAdd,
+			Action:        runCommentAdd,
+			ShellComplete: completeCommentAdd,
+		},
+		{
+			Name:  "flush",
+			Usage: "Post queued comments",
+			Description: `Post the comments queued after transient PDS failures (requires login).
+
+Comments that hb posts on its own, such as the comment on a closed issue
+(close_comment in .beads/hb.yaml), are retried a few times and then queued.
+The queue is also flushed by the next hb close that posts a comment. Only
+the logged-in account's comments are posted.`,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "list",
+					Usage: "List queued comments without posting them",
+				},
+			},
+			Action: runCommentFlush,
 		},
 	},
 }
@@ -109,9 +134,10 @@ func runCommentsGet(ctx context.Context, cmd *cli.Command) error {
 
 	// Build fetch options
 	opts := FetchOptions{
-		BeadsID: beadsID,
-		Pattern: filter,
-		Limit:   int(limit),
+		BeadsID:   beadsID,
+		Pattern:   filter,
+		Limit:     int(limit),
+		Directory: auth.ConfigDirectory(),
 	}
 
 	// Default limit: 10 when no beads-id and no explicit -n flag was set
@@ -136,7 +162,7 @@ func runCommentsGet(ctx context.Context, cmd *cli.Command) error {
 func runCommentAdd(ctx context.Context, cmd *cli.Command) error {
 	// Validate args
 	if cmd.Args().Len() < 2 {
-		return fmt.Errorf("usage: hb comment add [--reply-to <at-uri>] <beads-id> <text>")
+		return hberr.New(hberr.Usage, "usage: hb comment add [--reply-to <at-uri>] <beads-id> <text>")
 	}
 
 	// Extract beads-id and text
@@ -146,10 +172,17 @@ func runCommentAdd(ctx context.Context, cmd *cli.Command) error {
 	// Get --reply-to flag
 	replyTo := cmd.String("reply-to")
 
+	// Record the agent runtime the comment is written under
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	runtime := cfg.Agent()
+
 	// Load authenticated client
 	client, err := auth.LoadClient(ctx)
 	if err != nil {
-		return fmt.Errorf("authentication required: %w", err)
+		return clientError(err)
 	}
 
 	// Get session info to get the DID
@@ -159,13 +192,19 @@ func runCommentAdd(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	// Create the comment
+	start := time.Now()
 	output, err := CreateComment(ctx, client, sess.Did, CreateCommentInput{
 		BeadsID: beadsID,
 		Text:    text,
 		ReplyTo: replyTo,
+		Agent:   runtime,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create comment: %w", err)
+		err = fmt.Errorf("failed to create comment: %w", err)
+	}
+	recordAudit(sess.Did, sess.Handle, runtime, cmd.Args().Slice(), replyTo, beadsID, time.Since(start), err)
+	if err != nil {
+		return err
 	}
 
 	// Print success message
@@ -173,7 +212,89 @@ func runCommentAdd(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// runCommentFlush posts the logged-in account's queued comments
+func runCommentFlush(ctx context.Context, cmd *cli.Command) error {
+	w := cmd.Root().Writer
+	if cmd.Bool("list") {
+		queued, err := Queued()
+		if err != nil {
+			return fmt.Errorf("failed to read comment queue: %w", err)
+		}
+		if len(queued) == 0 {
+			fmt.Fprintln(w, "No queued comments")
+		}
+		for _, c := range queued {
+			fmt.Fprintf(w, "%s  %s  %s  attempts=%d", c.QueuedAt.Local().Format(time.DateTime), c.Input.BeadsID, c.DID, c.Attempts)
+			if c.LastError != "" {
+				fmt.Fprintf(w, "  last error: %s", c.LastError)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		return clientError(err)
+	}
+	sess, err := comatproto.ServerGetSession(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	result, err := Flush(ctx, client, sess.Did)
+	if err != nil {
+		return fmt.Errorf("failed to read comment queue: %w", err)
+	}
+	for _, out := range result.Posted {
+		fmt.Fprintf(w, "Comment posted: %s\n", out.URI)
+	}
+	for _, err := range result.Dropped {
+		fmt.Fprintf(os.Stderr, "warning: dropped %v\n", err)
+	}
+	if result.Remaining > 0 {
+		fmt.Fprintf(w, "%d comment(s) still queued\n", result.Remaining)
+	}
+	if hberr.KindOf(result.Stopped) == hberr.Auth {
+		return result.Stopped
+	}
+	if result.Stopped != nil {
+		return hberr.Wrap(hberr.Unavailable, result.Stopped)
+	}
+	return nil
+}
+
 // fallbackAction shows help when no subcommand is provided
 func fallbackAction(ctx context.Context, cmd *cli.Command) error {
 	return cli.ShowSubcommandHelp(cmd)
 }
+
+// recordAudit appends a comment add to the audit log
+func recordAudit(did, handle string, runtime agent.Info, args []string, replyTo, beadsID string, elapsed time.Duration, err error) {
+	if replyTo != "" {
+		args = append([]string{"--reply-to", replyTo}, args...)
+	}
+	entry := audit.Entry{
+		DID:        did,
+		Handle:     handle,
+		Session:    runtime.Session,
+		Agent:      runtime.Runtime,
+		Model:      runtime.Model,
+		Command:    "comment add",
+		Args:       args,
+		ExitCode:   hberr.ExitCode(err),
+		DurationMS: elapsed.Milliseconds(),
+		Issues:     []string{beadsID},
+	}
+	audit.Record(entry)
+}
+
+// clientError explains a failure to load the authenticated client. The kind
+// auth.LoadClient gave err is kept, so an unreachable PDS is not reported as
+// a login problem.
+func clientError(err error) error {
+	if hberr.KindOf(err) == hberr.Auth {
+		return fmt.Errorf("authentication required: %w", err)
+	}
+	return fmt.Errorf("failed to load session: %w", err)
+}
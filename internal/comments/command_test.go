@@ -10,7 +10,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 )
 
 // TestFallbackNoArgs verifies that running "hb comment" with no args shows help
@@ -307,3 +312,49 @@ func TestGetWithNFlag(t *testing.T) {
 		t.Errorf("expected 3 comments in output, got %d", commentCount)
 	}
 }
+
+// TestFlushList verifies that "hb comment flush --list" shows queued
+// comments without posting them
+func TestFlushList(t *testing.T) {
+	setupQueue(t)
+	if err := Enqueue("did:plc:alice", CreateCommentInput{BeadsID: "bd-7", Text: "Closed"}, fmt.Errorf("PDS down")); err == nil {
+		t.Fatal("Enqueue should report the queued comment")
+	}
+
+	var buf bytes.Buffer
+	app := &cli.Command{Name: "hb", Writer: &buf, Commands: []*cli.Command{CmdComment}}
+	if err := app.Run(context.Background(), []string{"hb", "comment", "flush", "--list"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, want := range []string{"bd-7", "did:plc:alice", "attempts=0", "last error: PDS down"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestAddPDSUnavailable verifies that an unreachable PDS is not reported as
+// a login problem
+func TestAddPDSUnavailable(t *testing.T) {
+	setupQueue(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	for _, name := range []string{auth.EnvUsername, auth.EnvAccessToken, auth.EnvSessionSource, "HB_PASSPHRASE", "HB_KEY_FILE"} {
+		t.Setenv(name, "")
+	}
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	sess := &auth.Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test", PDS: down.URL, AccessToken: "access"}
+	if err := auth.PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	app := &cli.Command{Name: "hb", Writer: &bytes.Buffer{}, Commands: []*cli.Command{CmdComment}}
+	err := app.Run(context.Background(), []string{"hb", "comment", "add", "bd-1", "LGTM"})
+	if kind := hberr.KindOf(err); kind != hberr.Unavailable {
+		t.Errorf("kind = %s, want %s (err: %v)", kind, hberr.Unavailable, err)
+	}
+	if err != nil && strings.Contains(err.Error(), "authentication required") {
+		t.Errorf("an unreachable PDS is not an auth failure: %v", err)
+	}
+}
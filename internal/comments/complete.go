@@ -0,0 +1,83 @@
+package comments
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/completion"
+)
+
+// replyToCompletions is how many recent comments --reply-to offers
+const replyToCompletions = 20
+
+// completeCommentAdd completes `hb comment add`: issue IDs for the
+// beads-id argument and recent comment AT-URIs for --reply-to
+func completeCommentAdd(ctx context.Context, cmd *cli.Command) {
+	prev, current := completion.Split(completion.Words(ctx))
+	w := cmd.Root().Writer
+	switch {
+	case current == "--reply-to":
+		completion.Write(w, recentComments(ctx, beadsIDArg(prev)))
+	case strings.HasPrefix(current, "-"):
+		completion.Write(w, completion.Commands(cmd, current))
+	case beadsIDArg(prev) == "":
+		completion.Write(w, completion.IssueIDs(ctx))
+	}
+}
+
+// beadsIDArg returns the beads-id already typed after "comment add", or ""
+func beadsIDArg(words []string) string {
+	i := slices.Index(words, "add")
+	if i < 0 {
+		return ""
+	}
+	for j := i + 1; j < len(words); j++ {
+		switch {
+		case words[j] == "--reply-to":
+			j++ // skip the value
+		case strings.HasPrefix(words[j], "-"):
+		default:
+			return words[j]
+		}
+	}
+	return ""
+}
+
+// recentComments lists the newest comments, on beadsID if set, with their
+// author and text as descriptions
+func recentComments(ctx context.Context, beadsID string) []completion.Candidate {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	indexerURL := os.Getenv("INDEXER_URL")
+	if indexerURL == "" {
+		indexerURL = DefaultIndexerURL
+	}
+	records, err := FetchRecordsByCollection(ctx, indexerURL, CommentCollection)
+	if err != nil {
+		return nil
+	}
+
+	comments := AssembleComments(FilterBeadsComments(records), nil, nil)
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].CreatedAt > comments[j].CreatedAt
+	})
+
+	var candidates []completion.Candidate
+	for _, c := range comments {
+		if beadsID != "" && c.NodeID != beadsID {
+			continue
+		}
+		candidates = append(candidates, completion.Candidate{Value: c.URI, Description: c.NodeID + " " + c.Handle + ": " + c.Text})
+		if len(candidates) == replyToCompletions {
+			break
+		}
+	}
+	return candidates
+}
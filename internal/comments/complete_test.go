@@ -0,0 +1,66 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBeadsIDArg(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"comment", "add"}, ""},
+		{[]string{"comment", "add", "bd-1"}, "bd-1"},
+		{[]string{"--as", "work", "comment", "add", "--reply-to", "at://x", "bd-2"}, "bd-2"},
+		{[]string{"comment", "add", "--reply-to", "at://x"}, ""},
+	}
+	for _, tt := range tests {
+		if got := beadsIDArg(tt.words); got != tt.want {
+			t.Errorf("beadsIDArg(%v) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestRecentComments(t *testing.T) {
+	record := func(rkey, node, created string) recordEdge {
+		return recordEdge{Node: IndexerRecord{
+			DID:  "did:plc:user1",
+			RKey: rkey,
+			URI:  "at://did:plc:user1/org.impactindexer.review.comment/" + rkey,
+			Value: map[string]interface{}{
+				"text":      "comment " + rkey,
+				"createdAt": created,
+				"subject":   map[string]interface{}{"uri": "beads:" + node},
+			},
+		}}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := graphQLResponse{Data: &graphQLData{Records: &recordsPage{Edges: []recordEdge{
+			record("old", "bd-1", "2026-01-01T00:00:00Z"),
+			record("new", "bd-1", "2026-02-01T00:00:00Z"),
+			record("other", "bd-2", "2026-03-01T00:00:00Z"),
+		}}}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	t.Setenv("INDEXER_URL", server.URL)
+
+	got := recentComments(context.Background(), "bd-1")
+	if len(got) != 2 {
+		t.Fatalf("expected the 2 comments on bd-1, got %v", got)
+	}
+	if got[0].Value != "at://did:plc:user1/org.impactindexer.review.comment/new" {
+		t.Errorf("newest comment should come first, got %v", got)
+	}
+	if got[0].Description != "bd-1 did:plc:user1: comment new" {
+		t.Errorf("unexpected description %q", got[0].Description)
+	}
+
+	if all := recentComments(context.Background(), ""); len(all) != 3 {
+		t.Errorf("without a beads-id expected all 3 comments, got %d", len(all))
+	}
+}
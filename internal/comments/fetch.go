@@ -55,7 +55,7 @@ func FetchComments(ctx context.Context, indexerURL, profileAPIURL string, opts F
 	}
 
 	// Resolve profiles
-	profiles := ResolveProfiles(ctx, profileAPIURL, dids)
+	profiles := ResolveProfilesWithDirectory(ctx, profileAPIURL, opts.Directory, dids)
 
 	// Assemble comments
 	assembled := AssembleComments(filteredComments, likeRecords, profiles)
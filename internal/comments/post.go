@@ -2,17 +2,22 @@ package comments
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/atclient"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
 )
 
 // CreateCommentInput holds the parameters for creating a comment.
 type CreateCommentInput struct {
-	BeadsID string // The beads issue ID to comment on
-	Text    string // Comment text
-	ReplyTo string // Optional AT-URI of parent comment (for replies)
+	BeadsID string `json:"beads_id"`           // The beads issue ID to comment on
+	Text    string `json:"text"`               // Comment text
+	ReplyTo string `json:"reply_to,omitempty"` // Optional AT-URI of parent comment (for replies)
+	// Agent is the agent runtime the comment was written under, if any
+	Agent agent.Info `json:"agent,omitzero"`
 }
 
 // CreateCommentOutput holds the result of creating a comment.
@@ -28,6 +33,14 @@ type createRecordRequest struct {
 	Record     commentRecord `json:"record"`
 }
 
+// putRecordRequest is the request body for com.atproto.repo.putRecord
+type putRecordRequest struct {
+	Repo       string        `json:"repo"`
+	Collection string        `json:"collection"`
+	RKey       string        `json:"rkey"`
+	Record     commentRecord `json:"record"`
+}
+
 // commentRecord is the record structure for a beads comment
 type commentRecord struct {
 	Type      string         `json:"$type"`
@@ -35,6 +48,7 @@ type commentRecord struct {
 	Text      string         `json:"text"`
 	CreatedAt string         `json:"createdAt"`
 	ReplyTo   string         `json:"replyTo,omitempty"`
+	Agent     agent.Info     `json:"agent,omitzero"`
 }
 
 // commentSubject identifies what the comment is about
@@ -44,6 +58,7 @@ type commentSubject struct {
 }
 
 // createRecordResponse is the response from com.atproto.repo.createRecord
+// and com.atproto.repo.putRecord
 type createRecordResponse struct {
 	URI string `json:"uri"`
 	CID string `json:"cid"`
@@ -57,16 +72,7 @@ func CreateComment(ctx context.Context, client *atclient.APIClient, did string,
 	reqBody := createRecordRequest{
 		Repo:       did,
 		Collection: CommentCollection,
-		Record: commentRecord{
-			Type: CommentCollection,
-			Subject: commentSubject{
-				URI:  BeadsURIPrefix + input.BeadsID,
-				Type: "record",
-			},
-			Text:      input.Text,
-			CreatedAt: time.Now().UTC().Format(time.RFC3339),
-			ReplyTo:   input.ReplyTo,
-		},
+		Record:     newCommentRecord(input, time.Now()),
 	}
 
 	// Call com.atproto.repo.createRecord
@@ -78,3 +84,40 @@ func CreateComment(ctx context.Context, client *atclient.APIClient, did string,
 
 	return &CreateCommentOutput{URI: output.URI, CID: output.CID}, nil
 }
+
+// PutComment writes a comment under the record key rkey, a TID, with
+// com.atproto.repo.putRecord. The comment's createdAt is the TID's time, so
+// retrying with the same rkey rewrites the same record instead of adding a
+// duplicate.
+func PutComment(ctx context.Context, client *atclient.APIClient, did string, rkey string, input CreateCommentInput) (*CreateCommentOutput, error) {
+	tid, err := syntax.ParseTID(rkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid comment record key: %w", err)
+	}
+	reqBody := putRecordRequest{
+		Repo:       did,
+		Collection: CommentCollection,
+		RKey:       rkey,
+		Record:     newCommentRecord(input, tid.Time()),
+	}
+
+	var output createRecordResponse
+	if err := client.Post(ctx, syntax.NSID("com.atproto.repo.putRecord"), reqBody, &output); err != nil {
+		return nil, err
+	}
+	return &CreateCommentOutput{URI: output.URI, CID: output.CID}, nil
+}
+
+func newCommentRecord(input CreateCommentInput, createdAt time.Time) commentRecord {
+	return commentRecord{
+		Type: CommentCollection,
+		Subject: commentSubject{
+			URI:  BeadsURIPrefix + input.BeadsID,
+			Type: "record",
+		},
+		Text:      input.Text,
+		CreatedAt: createdAt.UTC().Format(time.RFC3339),
+		ReplyTo:   input.ReplyTo,
+		Agent:     input.Agent,
+	}
+}
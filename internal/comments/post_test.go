@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
 )
 
 // TestCreateComment verifies that CreateComment sends the correct request body
@@ -195,3 +200,82 @@ func TestCreateCommentError(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+// TestCreateCommentAgent verifies that the agent runtime is recorded only
+// when one was detected
+func TestCreateCommentAgent(t *testing.T) {
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Record map[string]any `json:"record"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body.Record)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(createRecordResponse{URI: "at://did:plc:test123/org.impactindexer.review.comment/1", CID: "bafy"})
+	}))
+	defer srv.Close()
+	client := atclient.NewAPIClient(srv.URL)
+
+	runtime := agent.Info{Runtime: "codex", Session: "s-1"}
+	for _, input := range []CreateCommentInput{
+		{BeadsID: "bd-1", Text: "with agent", Agent: runtime},
+		{BeadsID: "bd-1", Text: "without agent"},
+	} {
+		if _, err := CreateComment(context.Background(), client, "did:plc:test123", input); err != nil {
+			t.Fatalf("CreateComment failed: %v", err)
+		}
+	}
+
+	got, ok := bodies[0]["agent"].(map[string]any)
+	if !ok || got["runtime"] != "codex" || got["session"] != "s-1" {
+		t.Errorf("record agent = %v, want codex with session s-1", bodies[0]["agent"])
+	}
+	if _, ok := got["model"]; ok {
+		t.Error("an unknown model should be omitted")
+	}
+	if _, ok := bodies[1]["agent"]; ok {
+		t.Errorf("record without a runtime should have no agent, got %v", bodies[1]["agent"])
+	}
+}
+
+// TestPutComment verifies that PutComment writes the record under rkey,
+// dated by the key, so a retry sends the same request
+func TestPutComment(t *testing.T) {
+	var bodies []putRecordRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.putRecord" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body putRecordRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(createRecordResponse{URI: "at://did:plc:test123/org.impactindexer.review.comment/" + body.RKey, CID: "bafy"})
+	}))
+	defer srv.Close()
+	client := atclient.NewAPIClient(srv.URL)
+
+	tid := syntax.NewTIDFromTime(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), 0)
+	input := CreateCommentInput{BeadsID: "bd-1", Text: "Closed"}
+	for range 2 {
+		out, err := PutComment(context.Background(), client, "did:plc:test123", tid.String(), input)
+		if err != nil {
+			t.Fatalf("PutComment failed: %v", err)
+		}
+		if !strings.HasSuffix(out.URI, "/"+tid.String()) {
+			t.Errorf("unexpected URI: %s", out.URI)
+		}
+	}
+
+	if len(bodies) != 2 || bodies[0] != bodies[1] {
+		t.Errorf("retries should send the same request, got %+v", bodies)
+	}
+	if got := bodies[0]; got.RKey != tid.String() || got.Record.CreatedAt != "2026-03-01T12:00:00Z" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+
+	if _, err := PutComment(context.Background(), client, "did:plc:test123", "not-a-tid", input); err == nil {
+		t.Error("expected an error for an invalid record key")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 )
 
 // ResolveProfiles resolves Bluesky profiles for a list of DIDs.
@@ -13,6 +16,12 @@ import (
 // (DID as handle) on any error. Never returns an error — all failures are graceful.
 // The returned map has one entry per unique input DID.
 func ResolveProfiles(ctx context.Context, apiURL string, dids []string) map[string]Profile {
+	return ResolveProfilesWithDirectory(ctx, apiURL, nil, dids)
+}
+
+// ResolveProfilesWithDirectory is like ResolveProfiles, but when the profile
+// API fails it falls back to dir (if non-nil) to resolve the DID's handle.
+func ResolveProfilesWithDirectory(ctx context.Context, apiURL string, dir identity.Directory, dids []string) map[string]Profile {
 	if len(dids) == 0 {
 		return make(map[string]Profile)
 	}
@@ -41,6 +50,9 @@ func ResolveProfiles(ctx context.Context, apiURL string, dids []string) map[stri
 			defer func() { <-sem }()
 
 			profile := fetchProfile(ctx, apiURL, d)
+			if profile.Handle == d && dir != nil {
+				profile = resolveHandleProfile(ctx, dir, d)
+			}
 			mu.Lock()
 			profiles[d] = profile
 			mu.Unlock()
@@ -81,3 +93,17 @@ func fetchProfile(ctx context.Context, apiURL, did string) Profile {
 
 	return profile
 }
+
+// resolveHandleProfile builds a profile from the identity directory.
+// Returns a fallback profile (DID as handle) if the handle is not verified.
+func resolveHandleProfile(ctx context.Context, dir identity.Directory, did string) Profile {
+	parsed, err := syntax.ParseDID(did)
+	if err != nil {
+		return Profile{DID: did, Handle: did}
+	}
+	ident, err := dir.LookupDID(ctx, parsed)
+	if err != nil || ident.Handle.IsInvalidHandle() {
+		return Profile{DID: did, Handle: did}
+	}
+	return Profile{DID: did, Handle: ident.Handle.String()}
+}
@@ -7,6 +7,9 @@ import (
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 )
 
 func TestResolveProfiles(t *testing.T) {
@@ -171,3 +174,26 @@ func TestResolveProfilesDisplayName(t *testing.T) {
 		t.Errorf("expected DID 'did:plc:alice', got '%s'", profile.DID)
 	}
 }
+
+func TestResolveProfilesWithDirectory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:private"),
+		Handle: syntax.Handle("alice.example.com"),
+	})
+
+	dids := []string{"did:plc:private", "did:plc:unknown"}
+	profiles := ResolveProfilesWithDirectory(context.Background(), server.URL, dir, dids)
+
+	if profiles["did:plc:private"].Handle != "alice.example.com" {
+		t.Errorf("expected handle from directory, got %s", profiles["did:plc:private"].Handle)
+	}
+	if profiles["did:plc:unknown"].Handle != "did:plc:unknown" {
+		t.Errorf("expected fallback handle did:plc:unknown, got %s", profiles["did:plc:unknown"].Handle)
+	}
+}
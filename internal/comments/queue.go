@@ -0,0 +1,291 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// queueDir is the XDG-relative state directory of comments waiting to be
+// posted, one JSON file per comment
+const queueDir = "heartbeads/comment-queue"
+
+// claimSuffix marks a queued comment that a Flush is posting. Claims are
+// taken by renaming, so concurrent hb processes never post one twice.
+const claimSuffix = ".posting"
+
+// staleClaim is how long a claim may be held before it is considered left
+// behind by a crashed hb and released
+const staleClaim = 10 * time.Minute
+
+// postAttempts is how many times PostOrQueue tries to post before queueing
+const postAttempts = 3
+
+// maxAttempts is how many failed posts a queued comment gets before Flush
+// drops it
+const maxAttempts = 10
+
+// retryDelay is the wait before the first retry; it doubles on each retry
+var retryDelay = time.Second
+
+// QueuedComment is a comment waiting to be posted to its author's repo
+type QueuedComment struct {
+	// DID is the author; only their session can post the comment
+	DID string `json:"did"`
+	// RKey is the comment's record key, minted when it was first tried, so
+	// every retry writes the same record
+	RKey      string             `json:"rkey,omitempty"`
+	Input     CreateCommentInput `json:"input"`
+	QueuedAt  time.Time          `json:"queued_at"`
+	Attempts  int                `json:"attempts"`
+	LastError string             `json:"last_error,omitempty"`
+
+	// path is the queue file the comment was read from
+	path string
+}
+
+// IsTransient reports whether a failed post may succeed if retried:
+// network errors, timeouts, rate limits and PDS errors
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *atclient.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// authError classifies a rejected session as hberr.Auth, or returns nil
+// for other errors. Retrying cannot fix it; the user has to log in again.
+func authError(err error) error {
+	var apiErr *atclient.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		return hberr.Errorf(hberr.Auth, "session rejected by the PDS (run: hb account login): %w", err)
+	}
+	return nil
+}
+
+// ErrQueued is wrapped by the errors of comments queued for a later Flush
+var ErrQueued = errors.New("comment queued")
+
+// PostOrQueue creates a comment, retrying transient failures. A comment
+// that still fails with a transient error is queued for Flush and the
+// returned error wraps ErrQueued. The record key is minted once, so
+// retries and the later Flush never post the comment twice. A rejected
+// session is an hberr.Auth error and is not queued.
+func PostOrQueue(ctx context.Context, client *atclient.APIClient, did string, input CreateCommentInput) (*CreateCommentOutput, error) {
+	rkey := syntax.NewTIDNow(0).String()
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		out, err := PutComment(ctx, client, did, rkey, input)
+		if err == nil {
+			return out, nil
+		}
+		if authErr := authError(err); authErr != nil {
+			return nil, authErr
+		}
+		if !IsTransient(err) {
+			return nil, err
+		}
+		if attempt == postAttempts {
+			return nil, queue(did, rkey, input, attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, queue(did, rkey, input, attempt, err)
+		case <-time.After(delay):
+			delay *= 2
+		}
+	}
+}
+
+// Enqueue queues a comment without trying to post it, e.g. when no
+// client can be loaded. The returned error wraps ErrQueued on success.
+func Enqueue(did string, input CreateCommentInput, cause error) error {
+	return queue(did, syntax.NewTIDNow(0).String(), input, 0, cause)
+}
+
+func queue(did, rkey string, input CreateCommentInput, attempts int, cause error) error {
+	c := QueuedComment{DID: did, RKey: rkey, Input: input, QueuedAt: time.Now().UTC(), Attempts: attempts}
+	if cause != nil {
+		c.LastError = cause.Error()
+	}
+	name := fmt.Sprintf("%d-%s.json", c.QueuedAt.UnixNano(), safeName(input.BeadsID))
+	path, err := xdg.StateFile(filepath.Join(queueDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to queue comment on %s: %w (after: %v)", input.BeadsID, err, cause)
+	}
+	if err := writeQueued(path, c); err != nil {
+		return fmt.Errorf("failed to queue comment on %s: %w (after: %v)", input.BeadsID, err, cause)
+	}
+	return fmt.Errorf("%w for retry (hb comment flush): %v", ErrQueued, cause)
+}
+
+// safeName keeps issue IDs usable in file names
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// writeQueued writes c to path through a temporary file, so a Flush never
+// reads a partial comment
+func writeQueued(path string, c QueuedComment) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Queued returns the queued comments, oldest first. Comments being posted
+// by another hb are not included.
+func Queued() ([]QueuedComment, error) {
+	dir := filepath.Join(xdg.StateHome, queueDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queued []QueuedComment
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if strings.HasSuffix(path, claimSuffix) {
+			releaseStale(path)
+			continue
+		}
+		if !strings.HasSuffix(path, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var c QueuedComment
+		if json.Unmarshal(data, &c) != nil {
+			continue
+		}
+		c.path = path
+		queued = append(queued, c)
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].QueuedAt.Before(queued[j].QueuedAt) })
+	return queued, nil
+}
+
+// releaseStale returns a claim left behind by a crashed hb to the queue
+func releaseStale(claim string) {
+	info, err := os.Stat(claim)
+	if err == nil && time.Since(info.ModTime()) > staleClaim {
+		_ = os.Rename(claim, strings.TrimSuffix(claim, claimSuffix))
+	}
+}
+
+// FlushResult is the outcome of a Flush
+type FlushResult struct {
+	Posted []CreateCommentOutput
+	// Dropped are comments that failed permanently or maxAttempts times
+	// and were removed
+	Dropped []error
+	// Remaining counts the comments still queued, including other authors'
+	Remaining int
+	// Stopped is the transient failure or hberr.Auth error that stopped
+	// the flush, if any
+	Stopped error
+}
+
+// Flush posts the queued comments of did, oldest first. Comments that
+// fail transiently stay queued until they have failed maxAttempts times;
+// the first such failure stops the flush, since the PDS is likely still
+// unreachable. A rejected session also stops the flush and keeps the
+// comment queued.
+func Flush(ctx context.Context, client *atclient.APIClient, did string) (FlushResult, error) {
+	var result FlushResult
+	queued, err := Queued()
+	if err != nil {
+		return result, err
+	}
+
+	for _, c := range queued {
+		if c.DID != did || result.Stopped != nil {
+			result.Remaining++
+			continue
+		}
+		claim := c.path + claimSuffix
+		if os.Rename(c.path, claim) != nil {
+			// Another hb claimed or posted it
+			continue
+		}
+
+		if c.RKey == "" {
+			// Queued by an older hb: fix the key before the first try
+			c.RKey = syntax.NewTIDNow(0).String()
+			if err := writeQueued(claim, c); err != nil {
+				_ = os.Rename(claim, c.path)
+				result.Remaining++
+				continue
+			}
+		}
+
+		out, err := PutComment(ctx, client, did, c.RKey, c.Input)
+		authErr := authError(err)
+		switch {
+		case err == nil:
+			result.Posted = append(result.Posted, *out)
+			_ = os.Remove(claim)
+		case authErr != nil:
+			_ = os.Rename(claim, c.path)
+			result.Remaining++
+			result.Stopped = authErr
+		case IsTransient(err) && c.Attempts+1 < maxAttempts:
+			c.Attempts++
+			c.LastError = err.Error()
+			if writeErr := writeQueued(claim, c); writeErr != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to update queued comment %s: %v\n", c.path, writeErr)
+			}
+			_ = os.Rename(claim, c.path)
+			result.Remaining++
+			result.Stopped = fmt.Errorf("comment on %s: %w", c.Input.BeadsID, err)
+		case IsTransient(err):
+			result.Dropped = append(result.Dropped, fmt.Errorf("comment on %s after %d attempts: %w", c.Input.BeadsID, maxAttempts, err))
+			_ = os.Remove(claim)
+		default:
+			result.Dropped = append(result.Dropped, fmt.Errorf("comment on %s: %w", c.Input.BeadsID, err))
+			_ = os.Remove(claim)
+		}
+	}
+	return result, nil
+}
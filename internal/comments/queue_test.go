@@ -0,0 +1,293 @@
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// mockFlakyPDS serves putRecord, failing the first failures requests
+// with status. It returns the server and a counter of requests.
+func mockFlakyPDS(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	srv, requests, _ := mockRecordingPDS(t, failures, status)
+	return srv, requests
+}
+
+// mockRecordingPDS is mockFlakyPDS that also returns the record key of
+// each request
+func mockRecordingPDS(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32, *[]string) {
+	t.Helper()
+	var requests atomic.Int32
+	var mu sync.Mutex
+	var rkeys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.putRecord" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var req putRecordRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		rkeys = append(rkeys, req.RKey)
+		mu.Unlock()
+
+		n := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if n <= failures {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failure", "message": "try later"})
+			return
+		}
+		json.NewEncoder(w).Encode(createRecordResponse{URI: fmt.Sprintf("at://did:plc:alice/%s/%d", CommentCollection, n), CID: "bafy"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &rkeys
+}
+
+// setupQueue isolates the comment queue and disables retry delays
+func setupQueue(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	delay := retryDelay
+	retryDelay = 0
+	t.Cleanup(func() { retryDelay = delay })
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&atclient.APIError{StatusCode: 503}, true},
+		{&atclient.APIError{StatusCode: 429}, true},
+		{&atclient.APIError{StatusCode: 408}, true},
+		{&atclient.APIError{StatusCode: 401}, false},
+		{&atclient.APIError{StatusCode: 400, Name: "InvalidRequest"}, false},
+		{fmt.Errorf("post: %w", &atclient.APIError{StatusCode: 502}), true},
+		{&url.Error{Op: "Post", URL: "https://pds.test", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{fmt.Errorf("post: %w", context.DeadlineExceeded), true},
+		{errors.New("failed decoding JSON response body"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPostOrQueue(t *testing.T) {
+	ctx := context.Background()
+	input := CreateCommentInput{BeadsID: "bd-1", Text: "Closed"}
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		setupQueue(t)
+		srv, requests, rkeys := mockRecordingPDS(t, 2, http.StatusServiceUnavailable)
+
+		out, err := PostOrQueue(ctx, atclient.NewAPIClient(srv.URL), "did:plc:alice", input)
+		if err != nil {
+			t.Fatalf("PostOrQueue failed: %v", err)
+		}
+		if out.URI == "" || requests.Load() != 3 {
+			t.Errorf("got %v after %d requests, want a post on the third", out, requests.Load())
+		}
+		if keys := *rkeys; len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+			t.Errorf("retries should reuse one record key, got %q", keys)
+		}
+	})
+
+	t.Run("queues after the last attempt", func(t *testing.T) {
+		setupQueue(t)
+		srv, requests := mockFlakyPDS(t, 100, http.StatusBadGateway)
+
+		_, err := PostOrQueue(ctx, atclient.NewAPIClient(srv.URL), "did:plc:alice", input)
+		if !errors.Is(err, ErrQueued) {
+			t.Fatalf("expected ErrQueued, got %v", err)
+		}
+		if requests.Load() != postAttempts {
+			t.Errorf("got %d requests, want %d", requests.Load(), postAttempts)
+		}
+		queued, err := Queued()
+		if err != nil || len(queued) != 1 {
+			t.Fatalf("Queued = %v, %v; want one comment", queued, err)
+		}
+		if q := queued[0]; q.DID != "did:plc:alice" || q.Input != input || q.Attempts != postAttempts || q.LastError == "" {
+			t.Errorf("unexpected queued comment: %+v", q)
+		}
+		if _, err := syntax.ParseTID(queued[0].RKey); err != nil {
+			t.Errorf("queued comment should keep its record key: %v", err)
+		}
+	})
+
+	t.Run("rejected sessions are auth errors", func(t *testing.T) {
+		setupQueue(t)
+		srv, requests := mockFlakyPDS(t, 100, http.StatusUnauthorized)
+
+		_, err := PostOrQueue(ctx, atclient.NewAPIClient(srv.URL), "did:plc:alice", input)
+		if hberr.KindOf(err) != hberr.Auth || errors.Is(err, ErrQueued) {
+			t.Fatalf("expected an unqueued auth error, got %v", err)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("got %d requests, want no retry", requests.Load())
+		}
+		if queued, _ := Queued(); len(queued) != 0 {
+			t.Errorf("nothing should be queued, got %v", queued)
+		}
+	})
+
+	t.Run("does not queue permanent failures", func(t *testing.T) {
+		setupQueue(t)
+		srv, requests := mockFlakyPDS(t, 100, http.StatusBadRequest)
+
+		_, err := PostOrQueue(ctx, atclient.NewAPIClient(srv.URL), "did:plc:alice", input)
+		if err == nil || errors.Is(err, ErrQueued) {
+			t.Fatalf("expected a plain error, got %v", err)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("got %d requests, want no retry", requests.Load())
+		}
+		if queued, _ := Queued(); len(queued) != 0 {
+			t.Errorf("nothing should be queued, got %v", queued)
+		}
+	})
+}
+
+func TestFlush(t *testing.T) {
+	setupQueue(t)
+	ctx := context.Background()
+	for _, c := range []struct{ did, id string }{
+		{"did:plc:alice", "bd-1"},
+		{"did:plc:bob", "bd-2"},
+		{"did:plc:alice", "bd-3"},
+	} {
+		if err := Enqueue(c.did, CreateCommentInput{BeadsID: c.id, Text: "Closed"}, errors.New("offline")); !errors.Is(err, ErrQueued) {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		time.Sleep(time.Millisecond) // distinct queue times
+	}
+
+	// A PDS still down stops the flush and keeps everything queued
+	down, _ := mockFlakyPDS(t, 100, http.StatusServiceUnavailable)
+	result, err := Flush(ctx, atclient.NewAPIClient(down.URL), "did:plc:alice")
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(result.Posted) != 0 || result.Remaining != 3 || result.Stopped == nil {
+		t.Errorf("unexpected result with PDS down: %+v", result)
+	}
+	queued, _ := Queued()
+	if len(queued) != 3 || queued[0].Input.BeadsID != "bd-1" || queued[0].Attempts != 1 {
+		t.Fatalf("unexpected queue after failed flush: %+v", queued)
+	}
+
+	// A rejected session stops the flush without counting an attempt
+	rejected, _ := mockFlakyPDS(t, 100, http.StatusUnauthorized)
+	result, err = Flush(ctx, atclient.NewAPIClient(rejected.URL), "did:plc:alice")
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if hberr.KindOf(result.Stopped) != hberr.Auth || result.Remaining != 3 || len(result.Dropped) != 0 {
+		t.Errorf("unexpected result with session rejected: %+v", result)
+	}
+	if queued, _ := Queued(); len(queued) != 3 || queued[0].Attempts != 1 {
+		t.Fatalf("unexpected queue after rejected flush: %+v", queued)
+	}
+
+	// Only the session's own comments are posted, under their queued keys
+	up, requests, rkeys := mockRecordingPDS(t, 0, http.StatusOK)
+	result, err = Flush(ctx, atclient.NewAPIClient(up.URL), "did:plc:alice")
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(result.Posted) != 2 || result.Remaining != 1 || result.Stopped != nil || requests.Load() != 2 {
+		t.Errorf("unexpected result: %+v after %d requests", result, requests.Load())
+	}
+	if want := []string{queued[0].RKey, queued[2].RKey}; !slices.Equal(*rkeys, want) {
+		t.Errorf("posted record keys %q, want the queued %q", *rkeys, want)
+	}
+	queued, _ = Queued()
+	if len(queued) != 1 || queued[0].DID != "did:plc:bob" {
+		t.Errorf("only bob's comment should remain, got %+v", queued)
+	}
+
+	// Permanent failures are dropped
+	invalid, _ := mockFlakyPDS(t, 100, http.StatusBadRequest)
+	result, err = Flush(ctx, atclient.NewAPIClient(invalid.URL), "did:plc:bob")
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(result.Dropped) != 1 || result.Remaining != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if queued, _ := Queued(); len(queued) != 0 {
+		t.Errorf("queue should be empty, got %+v", queued)
+	}
+}
+
+func TestFlushGivesUp(t *testing.T) {
+	setupQueue(t)
+	ctx := context.Background()
+	if err := Enqueue("did:plc:alice", CreateCommentInput{BeadsID: "bd-1", Text: "Closed"}, errors.New("offline")); !errors.Is(err, ErrQueued) {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	down, requests := mockFlakyPDS(t, 1000, http.StatusServiceUnavailable)
+	client := atclient.NewAPIClient(down.URL)
+	for i := 1; i < maxAttempts; i++ {
+		result, err := Flush(ctx, client, "did:plc:alice")
+		if err != nil || result.Remaining != 1 || len(result.Dropped) != 0 {
+			t.Fatalf("flush %d: unexpected result %+v, %v", i, result, err)
+		}
+	}
+
+	result, err := Flush(ctx, client, "did:plc:alice")
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(result.Dropped) != 1 || result.Remaining != 0 || requests.Load() != maxAttempts {
+		t.Errorf("the comment should be dropped after %d attempts: %+v after %d requests", maxAttempts, result, requests.Load())
+	}
+	if queued, _ := Queued(); len(queued) != 0 {
+		t.Errorf("queue should be empty, got %+v", queued)
+	}
+}
+
+func TestFlushMintsMissingRKey(t *testing.T) {
+	setupQueue(t)
+	// A comment queued before record keys were kept
+	path, err := xdg.StateFile(filepath.Join(queueDir, "1-bd-1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeQueued(path, QueuedComment{DID: "did:plc:alice", Input: CreateCommentInput{BeadsID: "bd-1", Text: "Closed"}, QueuedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	down, _, rkeys := mockRecordingPDS(t, 1000, http.StatusServiceUnavailable)
+	client := atclient.NewAPIClient(down.URL)
+	for range 2 {
+		if _, err := Flush(context.Background(), client, "did:plc:alice"); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+	if keys := *rkeys; len(keys) != 2 || keys[0] == "" || keys[1] != keys[0] {
+		t.Errorf("flushes should reuse one minted record key, got %q", keys)
+	}
+}
@@ -1,5 +1,7 @@
 package comments
 
+import "github.com/bluesky-social/indigo/atproto/identity"
+
 // DefaultIndexerURL is the default Hypergoat GraphQL indexer endpoint.
 const DefaultIndexerURL = "https://hypergoat-app-production.up.railway.app/graphql"
 
@@ -53,4 +55,7 @@ type FetchOptions struct {
 	BeadsID string // exact nodeID match (empty = no exact filter)
 	Pattern string // glob pattern match (empty = no pattern filter)
 	Limit   int    // max root comments to return (0 = unlimited)
+
+	// Directory, if set, resolves handles for DIDs the profile API cannot
+	Directory identity.Directory
 }
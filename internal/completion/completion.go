@@ -0,0 +1,316 @@
+// Package completion implements `hb completion` and the dynamic shell
+// completion of hb's commands: native commands complete through urfave/cli,
+// proxied commands through bd's own completion, and both add values only hb
+// knows, such as issue IDs and comment AT-URIs.
+package completion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/executor"
+)
+
+// completeFlag is appended by the shell scripts to request completions
+const completeFlag = "--generate-shell-completion"
+
+// ShellEnv is set by each completion script to the shell it was generated
+// for, so candidates are written in that shell's format
+const ShellEnv = "HB_COMPLETE_SHELL"
+
+// lookupTimeout bounds each bd or network lookup made while completing
+const lookupTimeout = 2 * time.Second
+
+// maxDescription is the longest description shown, in runes
+const maxDescription = 72
+
+// Candidate is a completion value with an optional description
+type Candidate struct {
+	Value       string
+	Description string
+}
+
+type argsKey struct{}
+
+// WithArgs records the raw command line (program name first) for
+// completion functions. urfave/cli strips flags without values from the
+// parsed arguments, but "--reply-to <TAB>" must still see the flag.
+func WithArgs(ctx context.Context, args []string) context.Context {
+	return context.WithValue(ctx, argsKey{}, args)
+}
+
+// Words returns the words typed before the one being completed, without
+// the program name. A partial flag being completed is the last word.
+func Words(ctx context.Context) []string {
+	args, _ := ctx.Value(argsKey{}).([]string)
+	if len(args) == 0 {
+		args = os.Args
+	}
+	words := args[1:]
+	if n := len(words); n > 0 && words[n-1] == completeFlag {
+		words = words[:n-1]
+	}
+	return words
+}
+
+// Split returns the completed words and the word being completed. The
+// scripts only pass the current word when it starts with "-", so a flag
+// that takes a value (e.g. "--reply-to <TAB>") is also returned as current.
+func Split(words []string) (prev []string, current string) {
+	if n := len(words); n > 0 && strings.HasPrefix(words[n-1], "-") {
+		return words[:n-1], words[n-1]
+	}
+	return words, ""
+}
+
+// Write prints candidates in the format of the shell named by ShellEnv:
+// zsh and fish show descriptions, bash (and any other shell) only values
+func Write(w io.Writer, candidates []Candidate) {
+	shell := os.Getenv(ShellEnv)
+	seen := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		if c.Value == "" || seen[c.Value] {
+			continue
+		}
+		seen[c.Value] = true
+		desc := strings.Join(strings.Fields(c.Description), " ")
+		if r := []rune(desc); len(r) > maxDescription {
+			desc = string(r[:maxDescription-1]) + "…"
+		}
+		switch {
+		case desc != "" && shell == "zsh":
+			fmt.Fprintf(w, "%s:%s\n", strings.ReplaceAll(c.Value, ":", `\:`), desc)
+		case desc != "" && shell == "fish":
+			fmt.Fprintf(w, "%s\t%s\n", c.Value, desc)
+		default:
+			fmt.Fprintln(w, c.Value)
+		}
+	}
+}
+
+// IssueIDs lists issues from `bd list --json`, with their titles as
+// descriptions. Returns nothing if bd is missing or fails.
+func IssueIDs(ctx context.Context) []Candidate {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	stdout, _, exitCode, err := executor.RunBd(ctx, []string{"list", "--json"}, "")
+	if err != nil || exitCode != 0 {
+		return nil
+	}
+	var issues []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	if json.Unmarshal(stdout, &issues) != nil {
+		return nil
+	}
+	candidates := make([]Candidate, 0, len(issues))
+	for _, issue := range issues {
+		candidates = append(candidates, Candidate{Value: issue.ID, Description: issue.Title})
+	}
+	return candidates
+}
+
+// Bd asks bd's own (cobra) completion for candidates: `bd __complete
+// <words...> <current>`. Returns nothing if bd is missing or has no
+// completion support.
+func Bd(ctx context.Context, words []string, current string) []Candidate {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	args := append(append([]string{"__complete"}, words...), current)
+	stdout, _, exitCode, err := executor.RunBd(ctx, args, "")
+	if err != nil || exitCode != 0 {
+		return nil
+	}
+	return ParseCobra(stdout)
+}
+
+// ParseCobra parses cobra's __complete output: one "value<TAB>description"
+// per line, ended by a ":<directive>" line
+func ParseCobra(out []byte) []Candidate {
+	var candidates []Candidate
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		value, desc, _ := strings.Cut(line, "\t")
+		candidates = append(candidates, Candidate{Value: value, Description: desc})
+	}
+	return candidates
+}
+
+// Native completes a native hb command: its flags when the current word
+// starts with "-", otherwise its subcommands
+func Native(ctx context.Context, cmd *cli.Command) {
+	_, current := Split(Words(ctx))
+	Write(cmd.Root().Writer, Commands(cmd, current))
+}
+
+// Commands lists the flags of cmd matching current when it starts with
+// "-", otherwise the visible subcommands of cmd
+func Commands(cmd *cli.Command, current string) []Candidate {
+	var candidates []Candidate
+	if strings.HasPrefix(current, "-") {
+		for _, flag := range cmd.Flags {
+			usage := ""
+			if doc, ok := flag.(cli.DocGenerationFlag); ok {
+				usage = doc.GetUsage()
+			}
+			for _, name := range flag.Names() {
+				prefix := "--"
+				if len(name) == 1 {
+					prefix = "-"
+				}
+				if strings.HasPrefix(prefix+name, current) {
+					candidates = append(candidates, Candidate{Value: prefix + name, Description: usage})
+				}
+			}
+		}
+		return candidates
+	}
+	for _, sub := range cmd.Commands {
+		if !sub.Hidden && sub.Name != "help" {
+			candidates = append(candidates, Candidate{Value: sub.Name, Description: sub.Usage})
+		}
+	}
+	return candidates
+}
+
+// Install sets Native as the completion of every command in cmds and their
+// subcommands that has none of its own
+func Install(cmds []*cli.Command) {
+	for _, cmd := range cmds {
+		if cmd.ShellComplete == nil {
+			cmd.ShellComplete = Native
+		}
+		Install(cmd.Commands)
+	}
+}
+
+// Configure adapts urfave/cli's completion command: it is listed in help,
+// and bash, zsh and fish get hb's scripts, which complete dynamically and
+// tell hb their shell through ShellEnv. Use as the root's
+// ConfigureShellCompletionCommand.
+func Configure(cmd *cli.Command) {
+	cmd.Hidden = false
+	cmd.Usage = "Output the shell completion script for bash, zsh or fish"
+	cmd.ArgsUsage = "bash|zsh|fish"
+	cmd.ShellComplete = func(ctx context.Context, cmd *cli.Command) {
+		Write(cmd.Root().Writer, []Candidate{{Value: "bash"}, {Value: "zsh"}, {Value: "fish"}})
+	}
+	action := cmd.Action
+	cmd.Action = func(ctx context.Context, cmd *cli.Command) error {
+		if script, ok := scripts[cmd.Args().First()]; ok {
+			_, err := fmt.Fprintf(cmd.Root().Writer, script, cmd.Root().Name, ShellEnv)
+			return err
+		}
+		// urfave/cli writes the other scripts to the command's own Writer
+		cmd.Writer = cmd.Root().Writer
+		return action(ctx, cmd)
+	}
+}
+
+// scripts are the completion scripts by shell, formatted with the program
+// name and ShellEnv. Like urfave/cli's, they complete through the program
+// itself with --generate-shell-completion.
+var scripts = map[string]string{
+	"bash": bashScript,
+	"zsh":  zshScript,
+	"fish": fishScript,
+}
+
+const bashScript = `#!/bin/bash
+
+# bash completion for %[1]s
+
+# Macs have bash3 for which the bash-completion package doesn't include
+# _init_completion. This is a minimal version of that function.
+__%[1]s_init_completion() {
+  COMPREPLY=()
+  _get_comp_words_by_ref "$@" cur prev words cword
+}
+
+__%[1]s_bash_autocomplete() {
+  if [[ "${COMP_WORDS[0]}" != "source" ]]; then
+    local cur opts words
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    if declare -F _init_completion >/dev/null 2>&1; then
+      _init_completion -n "=:" || return
+    else
+      __%[1]s_init_completion -n "=:" || return
+    fi
+    words=("${words[@]:0:$cword}")
+    if [[ "$cur" == "-"* ]]; then
+      requestComp="%[2]s=bash ${words[*]} ${cur} --generate-shell-completion"
+    else
+      requestComp="%[2]s=bash ${words[*]} --generate-shell-completion"
+    fi
+    opts=$(eval "${requestComp}" 2>/dev/null)
+    COMPREPLY=($(compgen -W "${opts}" -- ${cur}))
+    return 0
+  fi
+}
+
+complete -o bashdefault -o default -o nospace -F __%[1]s_bash_autocomplete %[1]s
+`
+
+const zshScript = `#compdef %[1]s
+compdef _%[1]s %[1]s
+
+# zsh completion for %[1]s
+
+_%[1]s() {
+	local -a opts
+	local current
+	current=${words[-1]}
+	if [[ "$current" == "-"* ]]; then
+		opts=("${(@f)$(%[2]s=zsh ${words[@]:0:#words[@]-1} ${current} --generate-shell-completion)}")
+	else
+		opts=("${(@f)$(%[2]s=zsh ${words[@]:0:#words[@]-1} --generate-shell-completion)}")
+	fi
+
+	if [[ "${opts[1]}" != "" ]]; then
+		_describe 'values' opts
+	else
+		_files
+	fi
+}
+
+# Don't run the completion function when being source-ed or eval-ed
+if [ "$funcstack[1]" = "_%[1]s" ]; then
+	_%[1]s
+fi
+`
+
+const fishScript = `# fish completion for %[1]s
+
+function __%[1]s_complete
+    set -lx %[2]s fish
+    set -l words (commandline -opc)
+    set -l current (commandline -ct)
+    if string match -q -- '-*' $current
+        $words $current --generate-shell-completion 2>/dev/null
+    else
+        $words --generate-shell-completion 2>/dev/null
+    end
+end
+
+complete -c %[1]s -f -a '(__%[1]s_complete)'
+`
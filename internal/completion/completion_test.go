@@ -0,0 +1,134 @@
+package completion
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestWordsAndSplit(t *testing.T) {
+	ctx := WithArgs(context.Background(), []string{"hb", "comment", "add", "--rep", "--generate-shell-completion"})
+	words := Words(ctx)
+	if !slices.Equal(words, []string{"comment", "add", "--rep"}) {
+		t.Fatalf("Words = %v", words)
+	}
+
+	prev, current := Split(words)
+	if !slices.Equal(prev, []string{"comment", "add"}) || current != "--rep" {
+		t.Errorf("Split = %v, %q", prev, current)
+	}
+
+	prev, current = Split([]string{"show"})
+	if !slices.Equal(prev, []string{"show"}) || current != "" {
+		t.Errorf("Split = %v, %q", prev, current)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	candidates := []Candidate{
+		{Value: "bd-1", Description: "Fix\nlogin"},
+		{Value: "at://did:plc:a/c/1", Description: strings.Repeat("x", 100)},
+		{Value: "bd-1", Description: "duplicate"},
+		{Value: "plain"},
+	}
+
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"bash", []string{"bd-1", "at://did:plc:a/c/1", "plain"}},
+		{"zsh", []string{"bd-1:Fix login", `at\://did\:plc\:a/c/1:` + strings.Repeat("x", 71) + "…", "plain"}},
+		{"fish", []string{"bd-1\tFix login", "at://did:plc:a/c/1\t" + strings.Repeat("x", 71) + "…", "plain"}},
+	}
+	for _, tt := range tests {
+		// The script's shell decides, not the login shell
+		t.Setenv("SHELL", "/bin/zsh")
+		t.Setenv(ShellEnv, tt.shell)
+		var buf bytes.Buffer
+		Write(&buf, candidates)
+		got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+}
+
+func TestParseCobra(t *testing.T) {
+	out := "bd-1\tFix login\nbd-2\n:4\nCompletion ended with directive: ShellCompDirectiveNoFileComp\n"
+	got := ParseCobra([]byte(out))
+	want := []Candidate{{Value: "bd-1", Description: "Fix login"}, {Value: "bd-2"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseCobra = %v, want %v", got, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	cmd := &cli.Command{
+		Name: "comment",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "json", Usage: "Output as JSON"},
+			&cli.IntFlag{Name: "n"},
+		},
+		Commands: []*cli.Command{
+			{Name: "get", Usage: "Get comments"},
+			{Name: "secret", Hidden: true},
+		},
+	}
+
+	if got := Commands(cmd, ""); !slices.Equal(got, []Candidate{{Value: "get", Description: "Get comments"}}) {
+		t.Errorf("subcommands = %v", got)
+	}
+	if got := Commands(cmd, "--j"); !slices.Equal(got, []Candidate{{Value: "--json", Description: "Output as JSON"}}) {
+		t.Errorf("flags = %v", got)
+	}
+	if got := Commands(cmd, "-"); len(got) != 2 || got[1].Value != "-n" {
+		t.Errorf("all flags = %v", got)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	called := false
+	own := func(context.Context, *cli.Command) { called = true }
+	child := &cli.Command{Name: "get"}
+	custom := &cli.Command{Name: "add", ShellComplete: own}
+	Install([]*cli.Command{{Name: "comment", Commands: []*cli.Command{child, custom}}})
+
+	if child.ShellComplete == nil {
+		t.Error("subcommands should get the native completion")
+	}
+	custom.ShellComplete(context.Background(), custom)
+	if !called {
+		t.Error("a command's own completion should be kept")
+	}
+}
+
+func TestConfigureScripts(t *testing.T) {
+	root := &cli.Command{
+		Name:                            "hb",
+		EnableShellCompletion:           true,
+		ConfigureShellCompletionCommand: Configure,
+	}
+	for shell, want := range map[string]string{
+		"bash": ShellEnv + "=bash hb",
+		"zsh":  ShellEnv + "=zsh hb",
+		"fish": "set -lx " + ShellEnv + " fish",
+	} {
+		var buf bytes.Buffer
+		root.Writer = &buf
+		if err := root.Run(context.Background(), []string{"hb", "completion", shell}); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := strings.ReplaceAll(buf.String(), "${words[*]}", "hb")
+		script = strings.ReplaceAll(script, "${words[@]:0:#words[@]-1}", "hb")
+		if !strings.Contains(script, want) {
+			t.Errorf("%s script should contain %q:\n%s", shell, want, buf.String())
+		}
+		if strings.Contains(script, "%!") {
+			t.Errorf("%s script has formatting errors:\n%s", shell, script)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/inject"
+	"github.com/gainforest/heartbeads-cli/internal/policy"
+)
+
+// FileName is the per-repo hb config file, stored next to .beads/config.yaml
+const FileName = "hb.yaml"
+
+// Config holds per-repo hb settings
+type Config struct {
+	// Account is the default account profile for this repo (overridden by --as)
+	Account string `yaml:"account,omitempty"`
+
+	// Verify controls verified-identity mode for proxied commands
+	Verify VerifyConfig `yaml:"verify,omitempty"`
+
+	// Actor selects what is recorded as the bd actor: ActorHandle (default) or ActorDID
+	Actor string `yaml:"actor,omitempty"`
+
+	// Attest writes a signed action record to the actor's PDS after each
+	// successful create, update, close, delete or reopen
+	Attest bool `yaml:"attest,omitempty"`
+
+	// Rules override the built-in flag injection and validation rules
+	// per bd subcommand (see inject.DefaultRules)
+	Rules inject.Rules `yaml:"rules,omitempty"`
+
+	// Reason configures the optional checks on commits referenced by --reason
+	Reason inject.CommitCheck `yaml:"reason,omitempty"`
+
+	// Policy restricts which identities may run which proxied commands
+	Policy policy.Policy `yaml:"policy,omitempty"`
+
+	// CloseComment posts an ATProto comment on each issue closed by a
+	// successful `hb close`
+	CloseComment CloseCommentConfig `yaml:"close_comment,omitempty"`
+
+	// Agents add agent runtimes to the built-in registry, or redefine
+	// built-in ones by name
+	Agents []agent.Runtime `yaml:"agents,omitempty"`
+}
+
+// Agent detects the agent runtime hb runs under, with the repo's runtimes
+// added to the built-in registry
+func (c *Config) Agent() agent.Info {
+	return agent.Detect(agent.Registry(c.Agents))
+}
+
+// EffectiveRules returns the built-in rules with the repo's rules applied
+func (c *Config) EffectiveRules() inject.Rules {
+	return inject.DefaultRules.Merge(c.Rules)
+}
+
+// Actor modes
+const (
+	// ActorHandle records the ATProto handle as the bd actor
+	ActorHandle = "handle"
+	// ActorDID records the stable DID, so history survives handle changes
+	ActorDID = "did"
+)
+
+// UseDIDActor reports whether the DID is recorded as the bd actor
+func (c *Config) UseDIDActor() bool {
+	return c.Actor == ActorDID
+}
+
+// DefaultVerifyTTL is how long a successful identity verification is cached
+const DefaultVerifyTTL = 15 * time.Minute
+
+// VerifyConfig controls verified-identity mode
+type VerifyConfig struct {
+	// Enabled confirms the session against the PDS and checks handle<->DID
+	// resolution before identity is injected into bd commands
+	Enabled bool `yaml:"enabled"`
+
+	// TTL is how long a successful verification is cached (default 15m)
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+// CacheTTL returns the configured TTL, or DefaultVerifyTTL if unset
+func (v VerifyConfig) CacheTTL() time.Duration {
+	if v.TTL <= 0 {
+		return DefaultVerifyTTL
+	}
+	return v.TTL
+}
+
+// DefaultRemote is the git remote whose web URL links closing commits
+const DefaultRemote = "origin"
+
+// CloseCommentConfig controls the comment posted when an issue is closed
+type CloseCommentConfig struct {
+	// Enabled posts an org.impactindexer.review.comment with the closing
+	// commit, its link on the git remote and the session ID
+	Enabled bool `yaml:"enabled"`
+
+	// Remote is the git remote linked in the comment (default origin)
+	Remote string `yaml:"remote,omitempty"`
+}
+
+// RemoteName returns the configured remote, or DefaultRemote if unset
+func (c CloseCommentConfig) RemoteName() string {
+	if c.Remote == "" {
+		return DefaultRemote
+	}
+	return c.Remote
+}
+
+// FindBeadsDir walks up from the working directory looking for a .beads directory.
+// Returns "" if none is found.
+func FindBeadsDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, ".beads")
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Path returns the path of the repo config file, or "" outside a beads repo
+func Path() string {
+	beadsDir := FindBeadsDir()
+	if beadsDir == "" {
+		return ""
+	}
+	return filepath.Join(beadsDir, FileName)
+}
+
+// Load reads the repo config. Returns an empty Config if there is no
+// beads repo or no config file.
+func Load() (*Config, error) {
+	path := Path()
+	if path == "" {
+		return &Config{}, nil
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads the config at path. A missing file yields an empty Config.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, hberr.Errorf(hberr.Config, "invalid %s: %w", path, err)
+	}
+	switch cfg.Actor {
+	case "", ActorHandle, ActorDID:
+	default:
+		return nil, hberr.Errorf(hberr.Config, "invalid %s: actor must be %q or %q, got %q", path, ActorHandle, ActorDID, cfg.Actor)
+	}
+	if err := cfg.Rules.Check(); err != nil {
+		return nil, hberr.Errorf(hberr.Config, "invalid %s: %w", path, err)
+	}
+	if err := cfg.Policy.Check(); err != nil {
+		return nil, hberr.Errorf(hberr.Config, "invalid %s: %w", path, err)
+	}
+	if err := agent.Check(cfg.Agents); err != nil {
+		return nil, hberr.Errorf(hberr.Config, "invalid %s: %w", path, err)
+	}
+	return &cfg, nil
+}
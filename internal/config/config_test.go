@@ -0,0 +1,257 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	t.Run("reads account", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("account: work\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if cfg.Account != "work" {
+			t.Errorf("account mismatch: got %q, want work", cfg.Account)
+		}
+	})
+
+	t.Run("reads verify settings", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "verify:\n  enabled: true\n  ttl: 5m\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if !cfg.Verify.Enabled {
+			t.Error("verify should be enabled")
+		}
+		if cfg.Verify.CacheTTL() != 5*time.Minute {
+			t.Errorf("ttl mismatch: got %s, want 5m", cfg.Verify.CacheTTL())
+		}
+	})
+
+	t.Run("reads actor mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("actor: did\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if !cfg.UseDIDActor() {
+			t.Error("expected DID actor mode")
+		}
+	})
+
+	t.Run("reads attest", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("attest: true\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if !cfg.Attest {
+			t.Error("attest should be enabled")
+		}
+	})
+
+	t.Run("reads close comment", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("close_comment:\n  enabled: true\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if !cfg.CloseComment.Enabled {
+			t.Error("close comment should be enabled")
+		}
+		if got := cfg.CloseComment.RemoteName(); got != DefaultRemote {
+			t.Errorf("remote: got %q, want %q", got, DefaultRemote)
+		}
+	})
+
+	t.Run("reads rules", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "rules:\n  update:\n    inject:\n      --assignee: none\n  delete:\n    require:\n      --reason:\n        validator: non-empty\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		rules := cfg.EffectiveRules()
+		if got := rules["update"].Inject["--assignee"].From; got != "none" {
+			t.Errorf("update --assignee source: got %q, want none", got)
+		}
+		if _, ok := rules["close"].Require["--reason"]; !ok {
+			t.Error("close --reason requirement should be inherited")
+		}
+		if got := rules["delete"].Require["--reason"].Validator; got != "non-empty" {
+			t.Errorf("delete --reason validator: got %q, want non-empty", got)
+		}
+	})
+
+	t.Run("reads agents", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "agents:\n  - name: aider\n    detect: [HB_TEST_AIDER]\n    model: [HB_TEST_AIDER_MODEL]\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		// Runtimes with a session would win over a marker-only one
+		t.Setenv("HB_AGENT_RUNTIME", "")
+		t.Setenv("CLAUDE_SESSION_ID", "")
+		t.Setenv("OPENCODE_SESSION", "")
+		t.Setenv("HB_TEST_AIDER", "1")
+		t.Setenv("HB_TEST_AIDER_MODEL", "sonnet")
+		if got := cfg.Agent(); got.Runtime != "aider" || got.Model != "sonnet" {
+			t.Errorf("Agent = %+v, want the configured aider runtime", got)
+		}
+	})
+
+	t.Run("rejects invalid agents", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("agents:\n  - name: aider\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "aider needs detect or session") {
+			t.Errorf("expected an agents error, got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "rules:\n  close:\n    inject:\n      --reason: clipboard\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Error("expected error for unknown injection source")
+		}
+	})
+
+	t.Run("reads reason checks", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "reason:\n  match_subject: true\n  reachable_from: origin/main\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if !cfg.Reason.MatchSubject || cfg.Reason.ReachableFrom != "origin/main" {
+			t.Errorf("unexpected reason checks: %+v", cfg.Reason)
+		}
+	})
+
+	t.Run("reads policy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "policy:\n  roles:\n    agent: [\"*.agents.example.com\"]\n  rules:\n    - effect: deny\n      commands: [delete]\n      subjects: [role:agent]\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if len(cfg.Policy.Rules) != 1 || cfg.Policy.Rules[0].Effect != "deny" {
+			t.Errorf("unexpected policy rules: %+v", cfg.Policy.Rules)
+		}
+	})
+
+	t.Run("rejects invalid policy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		data := "policy:\n  rules:\n    - effect: deny\n      subjects: [role:agent]\n"
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Error("expected error for undeclared role")
+		}
+	})
+
+	t.Run("rejects unknown actor mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("actor: email\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Error("expected error for unknown actor mode")
+		}
+	})
+
+	t.Run("missing file yields empty config", func(t *testing.T) {
+		cfg, err := LoadFile(filepath.Join(t.TempDir(), FileName))
+		if err != nil {
+			t.Fatalf("LoadFile failed: %v", err)
+		}
+		if cfg.Account != "" {
+			t.Errorf("expected empty account, got %q", cfg.Account)
+		}
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), FileName)
+		if err := os.WriteFile(path, []byte("account: [\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Error("expected error for invalid yaml")
+		}
+	})
+}
+
+func TestFindBeadsDir(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(filepath.Join(root, ".beads"), 0755); err != nil {
+		t.Fatalf("failed to create .beads: %v", err)
+	}
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	t.Chdir(nested)
+
+	got := FindBeadsDir()
+	want, _ := filepath.EvalSymlinks(filepath.Join(root, ".beads"))
+	if resolved, _ := filepath.EvalSymlinks(got); resolved != want {
+		t.Errorf("FindBeadsDir() = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyConfigDefaultTTL(t *testing.T) {
+	if got := (VerifyConfig{}).CacheTTL(); got != DefaultVerifyTTL {
+		t.Errorf("CacheTTL() = %s, want %s", got, DefaultVerifyTTL)
+	}
+}
@@ -3,10 +3,11 @@ package executor
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
 )
 
 // FindBdBinary locates the bd binary in PATH.
@@ -14,7 +15,7 @@ import (
 func FindBdBinary() (string, error) {
 	path, err := exec.LookPath("bd")
 	if err != nil {
-		return "", fmt.Errorf("bd binary not found in PATH. Install beads: https://github.com/steveyegge/beads")
+		return "", hberr.New(hberr.BdMissing, "bd binary not found in PATH. Install beads: https://github.com/steveyegge/beads")
 	}
 	return path, nil
 }
@@ -67,8 +68,7 @@ func RewriteOutput(input []byte) []byte {
 	}
 
 	// Don't rewrite JSON output — it contains user data that should be preserved
-	trimmed := bytes.TrimLeft(input, " \t\n\r")
-	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+	if isJSON(input) {
 		return input
 	}
 
@@ -80,53 +80,85 @@ func RewriteOutput(input []byte) []byte {
 	return []byte(result)
 }
 
+// isJSON reports whether output looks like a JSON document
+func isJSON(input []byte) bool {
+	trimmed := bytes.TrimLeft(input, " \t\n\r")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// didPattern matches did:plc and did:web identifiers in bd output
+var didPattern = regexp.MustCompile(`did:(?:plc:[a-z2-7]{24}|web:[a-zA-Z0-9.%-]+)`)
+
+// RewriteDIDs replaces DIDs in human-readable output with the handle
+// returned by handleFor. DIDs for which handleFor returns "" are left as-is.
+// JSON output is never rewritten, so scripts keep the stable DIDs.
+func RewriteDIDs(input []byte, handleFor func(did string) string) []byte {
+	if len(input) == 0 || isJSON(input) {
+		return input
+	}
+	return didPattern.ReplaceAllFunc(input, func(did []byte) []byte {
+		if handle := handleFor(string(did)); handle != "" {
+			return []byte(handle)
+		}
+		return did
+	})
+}
+
 // RunBd executes the bd binary with the given arguments, setting BD_NAME=hb
-// and applying output rewriting. The handle parameter is used for env fallback:
-// if GIT_AUTHOR_EMAIL is unset, it is set to handle; same for BD_ACTOR.
+// and applying output rewriting. The handle parameter is the actor (a handle,
+// or a DID in DID actor mode) used for env fallback: if GIT_AUTHOR_EMAIL is
+// unset, it is set to handle; same for BD_ACTOR.
 // Returns rewritten stdout, stderr, exit code, and any execution error.
+// Output is buffered until bd exits; use StreamBd to show it as it arrives.
 func RunBd(ctx context.Context, args []string, handle string, extraEnv ...string) (stdout []byte, stderr []byte, exitCode int, err error) {
-	bdPath, err := FindBdBinary()
+	cmd, err := bdCommand(ctx, args, handle, extraEnv)
 	if err != nil {
 		return nil, nil, 1, err
 	}
 
-	cmd := exec.CommandContext(ctx, bdPath, args...)
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
 
-	// Inherit env and add BD_NAME=hb
-	cmd.Env = append(os.Environ(), "BD_NAME=hb")
-	cmd.Env = append(cmd.Env, extraEnv...)
+	exitCode, err = exitCodeOf(cmd.Run())
+	if err != nil {
+		return nil, nil, exitCode, err
+	}
+
+	// Apply output rewriting
+	stdout = RewriteOutput(stdoutBuf.Bytes())
+	stderr = RewriteOutput(stderrBuf.Bytes())
+
+	return stdout, stderr, exitCode, nil
+}
+
+// EnvOverrides returns the variables hb adds to its own environment for bd:
+// BD_NAME=hb, extraEnv, and the GIT_AUTHOR_EMAIL and BD_ACTOR fallbacks
+func EnvOverrides(handle string, extraEnv []string) []string {
+	env := append([]string{"BD_NAME=hb"}, extraEnv...)
 
 	// Fallback: if GIT_AUTHOR_EMAIL is not set, use ATProto handle
 	// so bd's owner field has a value even without git config
 	if handle != "" && os.Getenv("GIT_AUTHOR_EMAIL") == "" {
-		cmd.Env = append(cmd.Env, "GIT_AUTHOR_EMAIL="+handle)
+		env = append(env, "GIT_AUTHOR_EMAIL="+handle)
 	}
 
 	// Fallback: set BD_ACTOR as belt-and-suspenders for created_by
 	// (--actor flag is already injected, but this covers edge cases)
 	if handle != "" && os.Getenv("BD_ACTOR") == "" {
-		cmd.Env = append(cmd.Env, "BD_ACTOR="+handle)
+		env = append(env, "BD_ACTOR="+handle)
 	}
+	return env
+}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-
-	runErr := cmd.Run()
-
-	// Get exit code
-	exitCode = 0
-	if runErr != nil {
-		if exitErr, ok := runErr.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			return nil, nil, 1, fmt.Errorf("failed to run bd: %w", runErr)
-		}
+// bdCommand prepares a bd invocation with hb's environment
+func bdCommand(ctx context.Context, args []string, handle string, extraEnv []string) (*exec.Cmd, error) {
+	bdPath, err := FindBdBinary()
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply output rewriting
-	stdout = RewriteOutput(stdoutBuf.Bytes())
-	stderr = RewriteOutput(stderrBuf.Bytes())
-
-	return stdout, stderr, exitCode, nil
+	cmd := exec.CommandContext(ctx, bdPath, args...)
+	cmd.Env = append(os.Environ(), EnvOverrides(handle, extraEnv)...)
+	return cmd, nil
 }
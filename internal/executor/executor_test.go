@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -159,3 +160,56 @@ func TestRunBdFallbackEnv(t *testing.T) {
 		t.Errorf("expected exit 0, got %d", exitCode)
 	}
 }
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_EMAIL", "")
+	t.Setenv("BD_ACTOR", "")
+
+	got := EnvOverrides("alice.test", []string{"HB_EXTRA=1"})
+	want := []string{"BD_NAME=hb", "HB_EXTRA=1", "GIT_AUTHOR_EMAIL=alice.test", "BD_ACTOR=alice.test"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Variables set by the user are left alone
+	t.Setenv("GIT_AUTHOR_EMAIL", "alice@example.com")
+	got = EnvOverrides("alice.test", nil)
+	want = []string{"BD_NAME=hb", "BD_ACTOR=alice.test"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRewriteDIDs(t *testing.T) {
+	handles := map[string]string{"did:plc:ewvi7nxzyoun6zhxrhs64oiz": "alice.bsky.social"}
+	handleFor := func(did string) string { return handles[did] }
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "human output",
+			input: "bd-a1b2 [P2] Fix login (owner: did:plc:ewvi7nxzyoun6zhxrhs64oiz)\n",
+			want:  "bd-a1b2 [P2] Fix login (owner: alice.bsky.social)\n",
+		},
+		{
+			name:  "unknown DID kept",
+			input: "Assignee: did:plc:aaaaaaaaaaaaaaaaaaaaaaaa\n",
+			want:  "Assignee: did:plc:aaaaaaaaaaaaaaaaaaaaaaaa\n",
+		},
+		{
+			name:  "JSON keeps DIDs",
+			input: `{"owner":"did:plc:ewvi7nxzyoun6zhxrhs64oiz"}`,
+			want:  `{"owner":"did:plc:ewvi7nxzyoun6zhxrhs64oiz"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(RewriteDIDs([]byte(tt.input), handleFor)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
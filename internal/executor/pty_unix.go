@@ -0,0 +1,119 @@
+//go:build unix
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// SupportsTTY reports whether StreamBd can run bd on a pseudo-terminal
+const SupportsTTY = true
+
+// runPTY runs cmd on a pseudo-terminal attached to stdio, with hb's
+// terminal in raw mode so keystrokes reach bd unchanged
+func runPTY(cmd *exec.Cmd, stdio IO) (int, error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return 1, fmt.Errorf("failed to run bd: %w", err)
+	}
+	defer ptmx.Close()
+
+	stdin, _ := stdio.Stdin.(*os.File)
+	if stdin != nil {
+		// Follow the size of hb's terminal
+		resize := make(chan os.Signal, 1)
+		signal.Notify(resize, syscall.SIGWINCH)
+		defer signal.Stop(resize)
+		go func() {
+			for range resize {
+				_ = pty.InheritSize(stdin, ptmx)
+			}
+		}()
+		_ = pty.InheritSize(stdin, ptmx)
+
+		if state, err := term.MakeRaw(int(stdin.Fd())); err == nil {
+			defer func() { _ = term.Restore(int(stdin.Fd()), state) }()
+		}
+	}
+	stop := make(chan struct{})
+	if stdio.Stdin != nil {
+		copied := make(chan struct{})
+		go func() {
+			defer close(copied)
+			copyInput(ptmx, stdio.Stdin, stop)
+		}()
+		if stdin != nil {
+			// Keep the terminal raw until the copier has stopped reading
+			defer func() { <-copied }()
+		}
+	}
+
+	out := NewLineWriter(stdio.Stdout, RewriteOutput)
+	copyErr := copyInteractive(out, ptmx)
+	waitErr := cmd.Wait()
+	close(stop)
+
+	// Reading the PTY fails with EIO once bd exits and closes its side
+	ptyClosed := errors.Is(copyErr, syscall.EIO) || errors.Is(copyErr, io.EOF)
+	if waitErr == nil && copyErr != nil && !ptyClosed {
+		return 1, fmt.Errorf("failed to read bd output: %w", copyErr)
+	}
+	return exitCodeOf(waitErr)
+}
+
+// inputPollInterval bounds how long copyInput takes to notice bd exited
+const inputPollInterval = 50 * time.Millisecond
+
+// copyInput copies stdin to the PTY until stop is closed. A terminal is
+// polled before each read, so input typed after bd exits is left for the
+// shell instead of being swallowed. Other readers cannot be interrupted
+// and are copied until they end.
+func copyInput(ptmx io.Writer, stdin io.Reader, stop <-chan struct{}) {
+	f, ok := stdin.(*os.File)
+	if !ok {
+		_, _ = io.Copy(ptmx, stdin)
+		return
+	}
+	fd := int(f.Fd())
+	buf := make([]byte, 32*1024)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(inputPollInterval/time.Millisecond))
+		if errors.Is(err, unix.EINTR) || (err == nil && n == 0) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n, err = f.Read(buf)
+		if n > 0 {
+			if _, werr := ptmx.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
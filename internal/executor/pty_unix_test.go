@@ -0,0 +1,84 @@
+//go:build unix
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestStreamBdTTY(t *testing.T) {
+	fakeBd(t, `[ -t 0 ] && [ -t 1 ] && echo "bd sees a terminal"
+printf "Title: "
+read title
+echo "created $title"
+exit 2
+`)
+
+	// A pty pair stands in for the user's terminal
+	term, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer term.Close()
+	defer tty.Close()
+	if _, err := term.Write([]byte("Fix login\n")); err != nil {
+		t.Fatalf("failed to type input: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	exitCode, err := StreamBd(context.Background(), []string{"create"}, "", IO{Stdin: tty, Stdout: &stdout, TTY: true})
+	if err != nil {
+		t.Fatalf("StreamBd failed: %v", err)
+	}
+	if exitCode != 2 {
+		t.Errorf("exit code = %d, want 2", exitCode)
+	}
+
+	out := stdout.String()
+	for _, want := range []string{"hb sees a terminal", "Title: ", "created Fix login"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestStreamBdTTYLeavesTypeahead(t *testing.T) {
+	fakeBd(t, `echo done`)
+
+	term, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer term.Close()
+	defer tty.Close()
+
+	var stdout bytes.Buffer
+	if _, err := StreamBd(context.Background(), []string{"list"}, "", IO{Stdin: tty, Stdout: &stdout, TTY: true}); err != nil {
+		t.Fatalf("StreamBd failed: %v", err)
+	}
+
+	// Input typed after bd exited must reach the next reader of the terminal
+	if _, err := term.Write([]byte("next\n")); err != nil {
+		t.Fatalf("failed to type input: %v", err)
+	}
+	read := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := tty.Read(buf)
+		read <- string(buf[:n])
+	}()
+	select {
+	case got := <-read:
+		if !strings.Contains(got, "next") {
+			t.Errorf("read %q, want the typeahead", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("typeahead was consumed by the finished bd session")
+	}
+}
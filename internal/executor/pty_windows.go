@@ -0,0 +1,17 @@
+//go:build windows
+
+package executor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// SupportsTTY reports whether StreamBd can run bd on a pseudo-terminal
+const SupportsTTY = false
+
+// runPTY is unsupported on Windows; callers fall back to pipes when
+// SupportsTTY is false
+func runPTY(cmd *exec.Cmd, stdio IO) (int, error) {
+	return 1, errors.New("terminal passthrough is not supported on Windows")
+}
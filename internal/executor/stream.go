@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// maxLineBuffer bounds how much of an unterminated line is held back for
+// rewriting; longer lines are rewritten and written in pieces
+const maxLineBuffer = 64 * 1024
+
+// LineWriter rewrites a stream line by line as it is written. A stream
+// whose first non-blank byte opens a JSON document is passed through
+// unchanged, like RewriteOutput does for buffered output.
+type LineWriter struct {
+	w       io.Writer
+	rewrite func([]byte) []byte
+	mu      *sync.Mutex
+
+	buf     []byte
+	started bool
+	raw     bool
+}
+
+// NewLineWriter returns a LineWriter applying rewrite to each line
+// (including its terminator) before writing it to w. Call Flush after the
+// last Write to emit a trailing unterminated line.
+func NewLineWriter(w io.Writer, rewrite func([]byte) []byte) *LineWriter {
+	return &LineWriter{w: w, rewrite: rewrite, mu: &sync.Mutex{}}
+}
+
+// Write implements io.Writer. It always consumes all of p.
+func (l *LineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.raw {
+		return n, l.emit(p)
+	}
+
+	if !l.started {
+		trimmed := bytes.TrimLeft(p, " \t\n\r")
+		if len(trimmed) == 0 {
+			l.buf = append(l.buf, p...)
+			return n, nil
+		}
+		l.started = true
+		if trimmed[0] == '{' || trimmed[0] == '[' {
+			l.raw = true
+			pending := append(l.buf, p...)
+			l.buf = nil
+			return n, l.emit(pending)
+		}
+	}
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexAny(l.buf, "\n\r")
+		if i < 0 {
+			break
+		}
+		line := l.buf[:i+1]
+		if err := l.emit(l.rewrite(line)); err != nil {
+			return n, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+	if len(l.buf) > maxLineBuffer {
+		return n, l.Flush()
+	}
+	return n, nil
+}
+
+// Flush writes any buffered partial line
+func (l *LineWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	pending := l.buf
+	l.buf = nil
+	if l.raw || !l.started {
+		return l.emit(pending)
+	}
+	return l.emit(l.rewrite(pending))
+}
+
+func (l *LineWriter) emit(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(p)
+	return err
+}
+
+// IO holds the standard streams of a streamed bd invocation
+type IO struct {
+	// Stdin is forwarded to bd (nil for no input). An *os.File is passed
+	// to bd directly, so `hb import -` reads hb's own stdin.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// TTY runs bd on a pseudo-terminal so it keeps colors, prompts and
+	// editors. Stdin must then be the controlling terminal; bd's stdout
+	// and stderr are merged into Stdout, as on a real terminal.
+	TTY bool
+}
+
+// StreamBd executes bd like RunBd, but writes rewritten output to the
+// streams in stdio line by line while bd runs, so long commands show
+// progress and output is never held in memory. Returns bd's exit code.
+func StreamBd(ctx context.Context, args []string, handle string, stdio IO, extraEnv ...string) (exitCode int, err error) {
+	cmd, err := bdCommand(ctx, args, handle, extraEnv)
+	if err != nil {
+		return 1, err
+	}
+	if stdio.TTY {
+		return runPTY(cmd, stdio)
+	}
+
+	// One lock for both streams keeps lines whole when they share a writer
+	mu := &sync.Mutex{}
+	outWriter := NewLineWriter(stdio.Stdout, RewriteOutput)
+	errWriter := NewLineWriter(stdio.Stderr, RewriteOutput)
+	outWriter.mu, errWriter.mu = mu, mu
+	cmd.Stdin = stdio.Stdin
+	cmd.Stdout = outWriter
+	cmd.Stderr = errWriter
+
+	runErr := cmd.Run()
+
+	// cmd.Run has waited for the copying goroutines, so flushing is safe
+	if err := outWriter.Flush(); err != nil {
+		return 1, err
+	}
+	if err := errWriter.Flush(); err != nil {
+		return 1, err
+	}
+	return exitCodeOf(runErr)
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// copyInteractive copies terminal output through w, flushing partial lines
+// after every read so prompts without a newline appear immediately
+func copyInteractive(w *LineWriter, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			_, _ = w.Write(buf[:n])
+			if ferr := w.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// exitCodeOf maps the error of cmd.Run to bd's exit code. A bd killed by
+// a signal exits with 128+signal, as in the shell. Errors other than a
+// non-zero exit are returned.
+func exitCodeOf(runErr error) (int, error) {
+	if runErr == nil {
+		return 0, nil
+	}
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 1, fmt.Errorf("failed to run bd: %w", runErr)
+}
@@ -0,0 +1,199 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	upper := func(line []byte) []byte { return bytes.ToUpper(line) }
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "lines split across writes",
+			chunks: []string{"run bd ", "sync\nbd li", "st\n"},
+			want:   "RUN BD SYNC\nBD LIST\n",
+		},
+		{
+			name:   "trailing partial line flushed",
+			chunks: []string{"done\nno newline"},
+			want:   "DONE\nNO NEWLINE",
+		},
+		{
+			name:   "carriage returns end lines",
+			chunks: []string{"10%\r", "50%\r100%\n"},
+			want:   "10%\r50%\r100%\n",
+		},
+		{
+			name:   "JSON stream passed through",
+			chunks: []string{"\n  ", "[\n  {\"title\": \"use bd\"}\n", "]\n"},
+			want:   "\n  [\n  {\"title\": \"use bd\"}\n]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			lw := NewLineWriter(&out, upper)
+			for _, c := range tt.chunks {
+				if n, err := lw.Write([]byte(c)); err != nil || n != len(c) {
+					t.Fatalf("Write(%q) = %d, %v", c, n, err)
+				}
+			}
+			if err := lw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineWriterWritesCompleteLinesImmediately(t *testing.T) {
+	var out bytes.Buffer
+	lw := NewLineWriter(&out, RewriteOutput)
+	_, _ = lw.Write([]byte("Run bd sync to push\nhalf"))
+	if got := out.String(); got != "Run hb sync to push\n" {
+		t.Errorf("got %q before flush", got)
+	}
+}
+
+func TestLineWriterLongLine(t *testing.T) {
+	var out bytes.Buffer
+	lw := NewLineWriter(&out, func(b []byte) []byte { return b })
+	long := strings.Repeat("x", maxLineBuffer+1)
+	_, _ = lw.Write([]byte(long))
+	if out.Len() != len(long) {
+		t.Errorf("expected oversized line to be written, got %d bytes", out.Len())
+	}
+}
+
+// fakeBd puts a bd shell script on PATH
+func fakeBd(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake bd needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bd"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake bd: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// signalWriter reports the first write on a channel
+type signalWriter struct {
+	bytes.Buffer
+	first chan struct{}
+}
+
+func (s *signalWriter) Write(p []byte) (int, error) {
+	select {
+	case s.first <- struct{}{}:
+	default:
+	}
+	return s.Buffer.Write(p)
+}
+
+func TestStreamBd(t *testing.T) {
+	fakeBd(t, `echo "Run bd sync"
+echo "warning: bd daemon not running" >&2
+while [ ! -e "$1" ]; do sleep 0.05; done
+echo "Synced"
+exit 3
+`)
+	// bd blocks until the gate file exists, which the test only creates
+	// after seeing the first line
+	gate := filepath.Join(t.TempDir(), "gate")
+
+	stdout := &signalWriter{first: make(chan struct{}, 1)}
+	var stderr bytes.Buffer
+	done := make(chan struct{})
+	var exitCode int
+	var err error
+	go func() {
+		exitCode, err = StreamBd(context.Background(), []string{gate}, "alice.test", IO{Stdout: stdout, Stderr: &stderr})
+		close(done)
+	}()
+
+	select {
+	case <-stdout.first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output streamed while bd was running")
+	}
+	if err := os.WriteFile(gate, nil, 0644); err != nil {
+		t.Fatalf("failed to open gate: %v", err)
+	}
+	<-done
+
+	if err != nil {
+		t.Fatalf("StreamBd failed: %v", err)
+	}
+	if exitCode != 3 {
+		t.Errorf("exit code = %d, want 3", exitCode)
+	}
+	if got := stdout.String(); got != "Run hb sync\nSynced\n" {
+		t.Errorf("stdout = %q", got)
+	}
+	if got := stderr.String(); got != "warning: hb daemon not running\n" {
+		t.Errorf("stderr = %q", got)
+	}
+}
+
+func TestStreamBdJSON(t *testing.T) {
+	fakeBd(t, `printf '[\n  {"title": "use bd sync"}\n]\n'`)
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := StreamBd(context.Background(), []string{"list", "--json"}, "", IO{Stdout: &stdout, Stderr: &stderr})
+	if err != nil || exitCode != 0 {
+		t.Fatalf("StreamBd = %d, %v", exitCode, err)
+	}
+	if got := stdout.String(); got != "[\n  {\"title\": \"use bd sync\"}\n]\n" {
+		t.Errorf("JSON output was rewritten: %q", got)
+	}
+}
+
+func TestStreamBdSignalled(t *testing.T) {
+	fakeBd(t, `kill -TERM $$`)
+
+	var out bytes.Buffer
+	exitCode, err := StreamBd(context.Background(), []string{"list"}, "", IO{Stdout: &out, Stderr: &out})
+	if err != nil {
+		t.Fatalf("StreamBd failed: %v", err)
+	}
+	if exitCode != 128+15 {
+		t.Errorf("exit code = %d, want %d (128+SIGTERM)", exitCode, 128+15)
+	}
+}
+
+func TestStreamBdMissingBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	var out bytes.Buffer
+	if _, err := StreamBd(context.Background(), []string{"list"}, "", IO{Stdout: &out, Stderr: &out}); err == nil {
+		t.Error("expected error when bd is missing")
+	}
+}
+
+func TestStreamBdStdin(t *testing.T) {
+	fakeBd(t, `while read line; do echo "imported $line"; done`)
+
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader("bd-1\nbd-2\n")
+	exitCode, err := StreamBd(context.Background(), []string{"import", "-"}, "", IO{Stdin: stdin, Stdout: &stdout, Stderr: &stderr})
+	if err != nil || exitCode != 0 {
+		t.Fatalf("StreamBd = %d, %v", exitCode, err)
+	}
+	if got := stdout.String(); got != "imported bd-1\nimported bd-2\n" {
+		t.Errorf("stdout = %q", got)
+	}
+}
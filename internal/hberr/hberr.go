@@ -0,0 +1,139 @@
+// Package hberr classifies hb errors so scripts and agents can tell failures
+// apart: each Kind maps to a documented process exit code, and errors can
+// be reported as a JSON envelope.
+package hberr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Kind is the class of an hb error
+type Kind string
+
+// Error kinds
+const (
+	// General is any unclassified error
+	General Kind = "error"
+	// Usage is an invalid invocation: missing or malformed flags, a --reason
+	// that fails validation
+	Usage Kind = "usage"
+	// Config is an invalid .beads/hb.yaml
+	Config Kind = "config"
+	// Auth is a missing, expired or unverifiable session
+	Auth Kind = "auth"
+	// Denied is a command refused by the repo policy
+	Denied Kind = "denied"
+	// Hook is a pre-command hook that refused the command
+	Hook Kind = "hook"
+	// Unavailable is an unreachable or failing indexer or PDS
+	Unavailable Kind = "unavailable"
+	// BdMissing is a missing bd binary
+	BdMissing Kind = "bd_missing"
+	// Bd is bd exiting non-zero; its exit code is passed through
+	Bd Kind = "bd"
+)
+
+// exitCodes are the process exit codes of each kind. hb's own codes use the
+// sysexits range so they rarely collide with bd's, which are passed through.
+var exitCodes = map[Kind]int{
+	General:     1,
+	Usage:       64,
+	Config:      78,
+	Unavailable: 69,
+	Hook:        75,
+	Denied:      77,
+	Auth:        80,
+	BdMissing:   127,
+}
+
+// Error is an error with a Kind. It deliberately has no ExitCode method:
+// urfave/cli would treat it as a cli.ExitCoder and exit the process.
+type Error struct {
+	Kind Kind
+	// Code is bd's exit code for Kind Bd
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error of kind with the given message
+func New(kind Kind, msg string) error {
+	return &Error{Kind: kind, Err: errors.New(msg)}
+}
+
+// Errorf formats an error of kind; %w wraps as with fmt.Errorf
+func Errorf(kind Kind, format string, a ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+// Wrap classifies err as kind. Returns nil for a nil err.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// BdExit is the error for bd exiting with a non-zero code
+func BdExit(command string, code int) error {
+	return &Error{Kind: Bd, Code: code, Err: fmt.Errorf("hb %s failed with exit code %d", command, code)}
+}
+
+// KindOf returns the kind of the outermost classified error in err's
+// chain, or General
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return General
+}
+
+// ExitCode returns the process exit code for err: 0 for nil, bd's own code
+// for bd failures, and the kind's code otherwise
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return exitCodes[General]
+	}
+	if e.Kind == Bd {
+		return e.Code
+	}
+	if code, ok := exitCodes[e.Kind]; ok {
+		return code
+	}
+	return exitCodes[General]
+}
+
+// envelope is the JSON error report written with --json
+type envelope struct {
+	Error struct {
+		Kind    Kind   `json:"kind"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Report writes err to w as "error: <message>", or as a JSON envelope
+// {"error": {"kind", "code", "message"}} when asJSON is set
+func Report(w io.Writer, err error, asJSON bool) {
+	if !asJSON {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+	var env envelope
+	env.Error.Kind = KindOf(err)
+	env.Error.Code = ExitCode(err)
+	env.Error.Message = err.Error()
+	data, _ := json.Marshal(env)
+	fmt.Fprintf(w, "%s\n", data)
+}
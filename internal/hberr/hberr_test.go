@@ -0,0 +1,76 @@
+package hberr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	sentinel := New(Auth, "no auth session found")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "plain error", err: errors.New("boom"), want: 1},
+		{name: "usage", err: Errorf(Usage, "hb close requires --reason"), want: 64},
+		{name: "config", err: New(Config, "invalid hb.yaml"), want: 78},
+		{name: "unavailable", err: New(Unavailable, "indexer down"), want: 69},
+		{name: "denied", err: Wrap(Denied, errors.New("policy")), want: 77},
+		{name: "hook", err: New(Hook, "pre-close hook failed"), want: 75},
+		{name: "auth", err: sentinel, want: 80},
+		{name: "wrapped auth", err: fmt.Errorf("failed to fetch comments: %w", sentinel), want: 80},
+		{name: "bd missing", err: New(BdMissing, "bd binary not found"), want: 127},
+		{name: "bd exit code passed through", err: BdExit("close", 3), want: 3},
+		{name: "outermost kind wins", err: Wrap(Denied, sentinel), want: 77},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	sentinel := New(Auth, "no auth session found")
+	wrapped := Errorf(Auth, "not logged in: %w", sentinel)
+	if !errors.Is(wrapped, sentinel) {
+		t.Error("Errorf should wrap with %w")
+	}
+	if Wrap(Usage, nil) != nil {
+		t.Error("Wrap(nil) should be nil")
+	}
+}
+
+func TestReport(t *testing.T) {
+	err := BdExit("close", 2)
+
+	var text bytes.Buffer
+	Report(&text, err, false)
+	if got := text.String(); got != "error: hb close failed with exit code 2\n" {
+		t.Errorf("text report = %q", got)
+	}
+
+	var out bytes.Buffer
+	Report(&out, Errorf(Auth, "Not logged in"), true)
+	var env struct {
+		Error struct {
+			Kind    string `json:"kind"`
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &env); err != nil {
+		t.Fatalf("invalid JSON envelope %q: %v", out.String(), err)
+	}
+	if env.Error.Kind != "auth" || env.Error.Code != 80 || env.Error.Message != "Not logged in" {
+		t.Errorf("unexpected envelope: %+v", env.Error)
+	}
+}
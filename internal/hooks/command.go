@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// CmdTrust is the "trust" command. It is not named "hooks", which is a bd
+// command (git hooks).
+var CmdTrust = &cli.Command{
+	Name:      "trust",
+	Usage:     "Allow the current repo's .beads/hooks to run",
+	ArgsUsage: "[repo-dir]",
+	Description: `Repo hooks in .beads/hooks are code from the repository. hb only runs
+them in repos you trust; your own hooks in ~/.config/heartbeads/hooks
+always run. Likewise, env: injection sources in .beads/hb.yaml may only
+read HB_* and BD_* variables unless the repo is trusted. Trust is stored
+per user in ~/.config/heartbeads/trusted-repos, never in the repo.
+
+Examples:
+  hb trust                   Run the current repo's hooks
+  hb trust ~/src/project     Trust another repo
+  hb trust --remove          Stop running the current repo's hooks
+  hb trust --list            Show the trusted repos`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "remove",
+			Usage: "Stop trusting the repo",
+		},
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "List the trusted repos",
+		},
+	},
+	Action: runTrust,
+}
+
+func runTrust(ctx context.Context, cmd *cli.Command) error {
+	w := cmd.Root().Writer
+	if cmd.Bool("list") {
+		repos, err := TrustedRepos()
+		if err != nil {
+			return fmt.Errorf("failed to read trusted repos: %w", err)
+		}
+		if len(repos) == 0 {
+			fmt.Fprintln(w, "No trusted repos")
+		}
+		for _, repo := range repos {
+			fmt.Fprintln(w, repo)
+		}
+		return nil
+	}
+
+	root := cmd.Args().First()
+	if root == "" {
+		if root = RepoRoot(); root == "" {
+			return hberr.New(hberr.Usage, "not in a beads repo (no .beads directory found); pass the repo directory")
+		}
+	}
+
+	if cmd.Bool("remove") {
+		root, err := Untrust(root)
+		if err != nil {
+			return fmt.Errorf("failed to untrust %s: %w", root, err)
+		}
+		fmt.Fprintf(w, "Hooks of %s will not run\n", root)
+		return nil
+	}
+	root, err := Trust(root)
+	if err != nil {
+		return fmt.Errorf("failed to trust %s: %w", root, err)
+	}
+	fmt.Fprintf(w, "Trusted hooks of %s\n", root)
+	return nil
+}
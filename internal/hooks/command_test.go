@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v3"
+)
+
+func runTrustCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := &cli.Command{
+		Name:     "hb",
+		Writer:   &out,
+		Commands: []*cli.Command{CmdTrust},
+	}
+	err := root.Run(context.Background(), append([]string{"hb", "trust"}, args...))
+	return out.String(), err
+}
+
+func TestCmdTrust(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(repo)
+
+	if _, err := runTrustCommand(t); err != nil {
+		t.Fatalf("trust failed: %v", err)
+	}
+	if !Trusted(repo) {
+		t.Fatal("current repo should be trusted")
+	}
+	out, err := runTrustCommand(t, "--list")
+	if err != nil || !strings.Contains(out, filepath.Base(repo)) {
+		t.Errorf("--list should show the repo, got %q, %v", out, err)
+	}
+
+	if _, err := runTrustCommand(t, "--remove"); err != nil {
+		t.Fatalf("trust --remove failed: %v", err)
+	}
+	if Trusted(repo) {
+		t.Error("repo should no longer be trusted")
+	}
+
+	t.Chdir(t.TempDir())
+	if _, err := runTrustCommand(t); err == nil {
+		t.Error("expected an error outside a beads repo")
+	}
+}
@@ -0,0 +1,152 @@
+// Package hooks runs user-defined executables before and after proxied bd
+// commands. A hook is an executable named <phase>-<command> (e.g.
+// pre-close, post-create) in the repo's .beads/hooks directory or the
+// user's $XDG_CONFIG_HOME/heartbeads/hooks directory. Repo hooks are code
+// from the repository, so they only run in repos the user trusts (see
+// Trust). Each hook reads a JSON Payload on stdin.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// Phases
+const (
+	// Pre hooks run before bd; a failing pre hook aborts the command
+	Pre = "pre"
+	// Post hooks run after bd, whatever its exit code
+	Post = "post"
+)
+
+// DisableEnv disables all hooks when set to a non-empty value
+const DisableEnv = "HB_NO_HOOKS"
+
+// userHooksDir is the XDG config-relative directory of the user's hooks
+const userHooksDir = "heartbeads/hooks"
+
+// Identity is the identity running the command
+type Identity struct {
+	DID    string `json:"did"`
+	Handle string `json:"handle"`
+	// Actor is what bd records: the handle, or the DID in DID actor mode
+	Actor string `json:"actor"`
+}
+
+// Result is the outcome of bd, given to post hooks
+type Result struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Payload is the JSON written to a hook's stdin
+type Payload struct {
+	// Hook is the hook name, e.g. "pre-close"
+	Hook    string `json:"hook"`
+	Command string `json:"command"`
+	// Args are the final bd arguments after the command, after flag injection
+	Args     []string `json:"args"`
+	Identity Identity `json:"identity"`
+	Session  string   `json:"session,omitempty"`
+	// Agent is the detected agent runtime, if any
+	Agent agent.Info `json:"agent,omitzero"`
+	// Result is set for post hooks
+	Result *Result `json:"result,omitempty"`
+}
+
+// Dirs returns the hook directories in the order their hooks run: the
+// repo's if the repo is trusted, then the user's
+func Dirs() []string {
+	var dirs []string
+	if root := RepoRoot(); root != "" && Trusted(root) {
+		dirs = append(dirs, repoHooksDir(root))
+	}
+	return append(dirs, filepath.Join(xdg.ConfigHome, userHooksDir))
+}
+
+func repoHooksDir(root string) string {
+	return filepath.Join(root, ".beads", "hooks")
+}
+
+// Find returns the executable hooks for phase and command, in run order
+func Find(phase, command string) []string {
+	if os.Getenv(DisableEnv) != "" {
+		return nil
+	}
+	var found []string
+	for _, dir := range Dirs() {
+		if path := findIn(dir, phase, command); path != "" {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// Untrusted returns the repo hook for phase and command that exists but
+// does not run because the repo is not trusted, or ""
+func Untrusted(phase, command string) string {
+	root := RepoRoot()
+	if os.Getenv(DisableEnv) != "" || root == "" || Trusted(root) {
+		return ""
+	}
+	return findIn(repoHooksDir(root), phase, command)
+}
+
+// findIn returns the executable hook for phase and command in dir, or ""
+func findIn(dir, phase, command string) string {
+	path := filepath.Join(dir, phase+"-"+command)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return ""
+	}
+	return path
+}
+
+// Run runs the hooks for phase and payload.Command with payload on stdin.
+// Hook output goes to out, so it never mixes with bd's stdout. A failing
+// pre hook stops the run and is returned as a Hook error; post hooks all
+// run and their failures are joined.
+func Run(ctx context.Context, phase string, payload Payload, out io.Writer) error {
+	if path := Untrusted(phase, payload.Command); path != "" {
+		fmt.Fprintf(out, "warning: skipping %s: repo hooks are not trusted (run: hb trust)\n", path)
+	}
+	paths := Find(phase, payload.Command)
+	if len(paths) == 0 {
+		return nil
+	}
+	payload.Hook = phase + "-" + payload.Command
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, path := range paths {
+		cmd := exec.CommandContext(ctx, path)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = append(os.Environ(), "HB_HOOK="+payload.Hook)
+		if err := cmd.Run(); err != nil {
+			err = hberr.Errorf(hberr.Hook, "%s hook %s failed: %w", payload.Hook, path, err)
+			if phase == Pre {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,197 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// setupHooks creates a trusted beads repo and a user config dir,
+// returning their hook directories
+func setupHooks(t *testing.T) (repoDir, userDir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	t.Setenv(DisableEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+
+	repo := t.TempDir()
+	t.Chdir(repo)
+	repoDir = filepath.Join(repo, ".beads", "hooks")
+	userDir = filepath.Join(xdg.ConfigHome, userHooksDir)
+	for _, dir := range []string{repoDir, userDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if _, err := Trust(repo); err != nil {
+		t.Fatalf("Trust failed: %v", err)
+	}
+	return repoDir, userDir
+}
+
+func writeHook(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write hook: %v", err)
+	}
+	return path
+}
+
+func TestFind(t *testing.T) {
+	repoDir, userDir := setupHooks(t)
+	repoHook := writeHook(t, repoDir, "pre-close", "exit 0\n")
+	userHook := writeHook(t, userDir, "pre-close", "exit 0\n")
+	writeHook(t, repoDir, "post-close", "exit 0\n")
+	// Not executable
+	if err := os.WriteFile(filepath.Join(repoDir, "pre-create"), []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Find(Pre, "close"); !slices.Equal(got, []string{repoHook, userHook}) {
+		t.Errorf("Find(pre, close) = %v, want repo then user hook", got)
+	}
+	if got := Find(Pre, "create"); len(got) != 0 {
+		t.Errorf("non-executable hooks should be ignored, got %v", got)
+	}
+
+	t.Setenv(DisableEnv, "1")
+	if got := Find(Pre, "close"); len(got) != 0 {
+		t.Errorf("%s should disable hooks, got %v", DisableEnv, got)
+	}
+}
+
+func TestRunPre(t *testing.T) {
+	repoDir, userDir := setupHooks(t)
+	input := filepath.Join(t.TempDir(), "input.json")
+	writeHook(t, repoDir, "pre-close", `cat > `+input+`
+echo "running $HB_HOOK"
+`)
+	ran := filepath.Join(t.TempDir(), "ran")
+	writeHook(t, userDir, "pre-close", "touch "+ran+"\n")
+
+	payload := Payload{
+		Command:  "close",
+		Args:     []string{"bd-1", "--reason", "abc1234 done"},
+		Identity: Identity{DID: "did:plc:alice", Handle: "alice.test", Actor: "alice.test"},
+	}
+	var out bytes.Buffer
+	if err := Run(context.Background(), Pre, payload, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.String() != "running pre-close\n" {
+		t.Errorf("hook output = %q", out.String())
+	}
+	if _, err := os.Stat(ran); err != nil {
+		t.Error("user hook should run after the repo hook")
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatalf("hook did not record its input: %v", err)
+	}
+	var got Payload
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid payload %s: %v", data, err)
+	}
+	if got.Hook != "pre-close" || got.Identity.DID != "did:plc:alice" || !slices.Equal(got.Args, payload.Args) || got.Result != nil {
+		t.Errorf("unexpected payload: %s", data)
+	}
+}
+
+func TestRunPreFailureAborts(t *testing.T) {
+	repoDir, userDir := setupHooks(t)
+	writeHook(t, repoDir, "pre-close", "echo 'tests failed' >&2\nexit 2\n")
+	ran := filepath.Join(t.TempDir(), "ran")
+	writeHook(t, userDir, "pre-close", "touch "+ran+"\n")
+
+	var out bytes.Buffer
+	err := Run(context.Background(), Pre, Payload{Command: "close"}, &out)
+	if hberr.KindOf(err) != hberr.Hook {
+		t.Fatalf("expected a hook error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "tests failed") {
+		t.Errorf("hook stderr should be shown, got %q", out.String())
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("hooks after a failing pre hook must not run")
+	}
+}
+
+func TestRunPost(t *testing.T) {
+	repoDir, userDir := setupHooks(t)
+	writeHook(t, repoDir, "post-sync", "exit 1\n")
+	input := filepath.Join(t.TempDir(), "input.json")
+	writeHook(t, userDir, "post-sync", "cat > "+input+"\n")
+
+	payload := Payload{Command: "sync", Result: &Result{Stdout: "synced\n", ExitCode: 0}}
+	err := Run(context.Background(), Post, payload, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "post-sync hook") {
+		t.Errorf("expected the failing post hook to be reported, got %v", err)
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatalf("post hooks should all run: %v", err)
+	}
+	if !strings.Contains(string(data), `"result":{"stdout":"synced\n","stderr":"","exit_code":0}`) {
+		t.Errorf("unexpected payload: %s", data)
+	}
+}
+
+func TestUntrustedRepoHooks(t *testing.T) {
+	repoDir, userDir := setupHooks(t)
+	ran := filepath.Join(t.TempDir(), "ran")
+	repoHook := writeHook(t, repoDir, "pre-list", "touch "+ran+"\n")
+	userHook := writeHook(t, userDir, "pre-list", "exit 0\n")
+
+	root, err := Untrust(".")
+	if err != nil {
+		t.Fatalf("Untrust failed: %v", err)
+	}
+	if Trusted(root) {
+		t.Fatal("repo should no longer be trusted")
+	}
+	if got := Find(Pre, "list"); !slices.Equal(got, []string{userHook}) {
+		t.Errorf("only the user hook should run in an untrusted repo, got %v", got)
+	}
+	if got := Untrusted(Pre, "list"); got != repoHook {
+		t.Errorf("Untrusted = %q, want %q", got, repoHook)
+	}
+
+	var out bytes.Buffer
+	if err := Run(context.Background(), Pre, Payload{Command: "list"}, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("repo hook ran in an untrusted repo")
+	}
+	if !strings.Contains(out.String(), "not trusted") {
+		t.Errorf("expected a warning about the skipped hook, got %q", out.String())
+	}
+
+	// Trust applies to the repo, from any directory inside it
+	if err := os.MkdirAll("sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir("sub")
+	if _, err := Trust(RepoRoot()); err != nil {
+		t.Fatalf("Trust failed: %v", err)
+	}
+	if got := Find(Pre, "list"); !slices.Equal(got, []string{repoHook, userHook}) {
+		t.Errorf("trusted repo hooks should run first, got %v", got)
+	}
+}
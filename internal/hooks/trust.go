@@ -0,0 +1,130 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+
+	"github.com/gainforest/heartbeads-cli/internal/config"
+)
+
+// trustFile is the XDG config-relative list of repos whose hooks may run,
+// one repo root per line
+const trustFile = "heartbeads/trusted-repos"
+
+// RepoRoot returns the root of the current beads repo (the directory
+// holding .beads), or "" outside a beads repo
+func RepoRoot() string {
+	beadsDir := config.FindBeadsDir()
+	if beadsDir == "" {
+		return ""
+	}
+	return filepath.Dir(beadsDir)
+}
+
+// canonical returns the absolute path of dir with symlinks resolved, so a
+// repo is trusted whatever path reaches it
+func canonical(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// TrustedRepos returns the repo roots the user allowed to run hooks
+func TrustedRepos() ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(xdg.ConfigHome, trustFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			repos = append(repos, line)
+		}
+	}
+	return repos, scanner.Err()
+}
+
+// Trusted reports whether the hooks of the repo at root may run
+func Trusted(root string) bool {
+	root, err := canonical(root)
+	if err != nil {
+		return false
+	}
+	repos, err := TrustedRepos()
+	if err != nil {
+		return false
+	}
+	for _, repo := range repos {
+		if repo == root {
+			return true
+		}
+	}
+	return false
+}
+
+// Trust allows the hooks of the repo at root to run. Returns the
+// canonical root that was recorded.
+func Trust(root string) (string, error) {
+	root, err := canonical(root)
+	if err != nil {
+		return "", err
+	}
+	repos, err := TrustedRepos()
+	if err != nil {
+		return "", err
+	}
+	for _, repo := range repos {
+		if repo == root {
+			return root, nil
+		}
+	}
+	return root, writeTrusted(append(repos, root))
+}
+
+// Untrust stops the hooks of the repo at root from running. Returns the
+// canonical root that was removed.
+func Untrust(root string) (string, error) {
+	root, err := canonical(root)
+	if err != nil {
+		return "", err
+	}
+	repos, err := TrustedRepos()
+	if err != nil {
+		return "", err
+	}
+	kept := repos[:0]
+	for _, repo := range repos {
+		if repo != root {
+			kept = append(kept, repo)
+		}
+	}
+	return root, writeTrusted(kept)
+}
+
+func writeTrusted(repos []string) error {
+	path, err := xdg.ConfigFile(trustFile)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, repo := range repos {
+		buf.WriteString(repo + "\n")
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
@@ -0,0 +1,184 @@
+package inject
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// ReasonAuto is the --reason value that hb replaces with the HEAD commit
+const ReasonAuto = "auto"
+
+// CommitCheck configures how commit references in --reason are verified.
+// The hash is always resolved in the local git repo; the other checks are
+// opt-in.
+type CommitCheck struct {
+	// MatchSubject requires the message to start with the commit subject
+	MatchSubject bool `yaml:"match_subject,omitempty"`
+
+	// ReachableFrom requires the commit to be an ancestor of this ref,
+	// e.g. "HEAD" or "origin/main"
+	ReachableFrom string `yaml:"reachable_from,omitempty"`
+}
+
+// AutoReason returns "<short hash> <subject>" of HEAD
+func AutoReason() (string, error) {
+	hash := gitOutput("rev-parse", "--short", "HEAD")
+	subject := GetLatestGitCommit()
+	if hash == "" || subject == "" {
+		return "", hberr.New(hberr.Usage, "--reason auto needs a git repository with at least one commit")
+	}
+	return hash + " " + subject, nil
+}
+
+// commitRefFlags returns the names (with aliases) of the flags of
+// subcommand validated as commit references
+func (r Rules) commitRefFlags(subcommand string) []string {
+	var names []string
+	for flag, rule := range r.forCommand(subcommand).Require {
+		if rule.Validator == ValidatorCommitRef {
+			names = append(append(names, flag), rule.Aliases...)
+		}
+	}
+	return names
+}
+
+// ExpandAutoReason replaces "auto" given to a commit-reference flag of
+// args[0] with the HEAD commit (see AutoReason)
+func (r Rules) ExpandAutoReason(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	flags := r.commitRefFlags(args[0])
+	if len(flags) == 0 || GetFlagValue(args, flags...) != ReasonAuto {
+		return args, nil
+	}
+	reason, err := AutoReason()
+	if err != nil {
+		return nil, err
+	}
+	return MapFlagValues(args, func(value string) string {
+		if value == ReasonAuto {
+			return reason
+		}
+		return value
+	}, flags...), nil
+}
+
+// CommitRef returns the commit hash and message given to the
+// commit-reference flag of args[0], e.g. "abc1234 fix login". Returns
+// empty strings if args[0] has no such flag or it holds no hash.
+func (r Rules) CommitRef(args []string) (hash, message string) {
+	if len(args) == 0 {
+		return "", ""
+	}
+	flags := r.commitRefFlags(args[0])
+	if len(flags) == 0 {
+		return "", ""
+	}
+	// The validator accepts any whitespace after the hash, e.g. a tab
+	value := strings.TrimSpace(GetFlagValue(args, flags...))
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return "", ""
+	}
+	return fields[0], strings.TrimSpace(strings.TrimPrefix(value, fields[0]))
+}
+
+// VerifyCommitRefs checks that the commits referenced by the
+// commit-reference flags of args[0] exist in the local git repo, and
+// applies the optional checks. Outside a git work tree commits cannot be
+// resolved: that is only an error when an optional check is configured.
+func (r Rules) VerifyCommitRefs(args []string, check CommitCheck) error {
+	hash, message := r.CommitRef(args)
+	if hash == "" {
+		return nil
+	}
+	if gitOutput("rev-parse", "--is-inside-work-tree") != "true" {
+		if check.MatchSubject || check.ReachableFrom != "" {
+			return hberr.Errorf(hberr.Usage, "cannot check commit %s: not in a git repository (reason.match_subject and reason.reachable_from need one)", hash)
+		}
+		return nil
+	}
+	return VerifyCommit(hash, message, check)
+}
+
+// ResolveCommit returns the full hash of commit hash in the local git
+// repo, or "" if it cannot be resolved
+func ResolveCommit(hash string) string {
+	return gitOutput("rev-parse", "--verify", "--quiet", hash+"^{commit}")
+}
+
+// CommitURL returns the web URL of commit hash on the git remote, or ""
+// if the remote is missing or not hosted on a web forge. GitHub, GitLab,
+// Gitea and Forgejo all serve commits at <repo>/commit/<hash>.
+func CommitURL(remote, hash string) string {
+	repo := WebURL(gitOutput("remote", "get-url", remote))
+	if repo == "" || hash == "" {
+		return ""
+	}
+	return repo + "/commit/" + hash
+}
+
+// WebURL converts a git remote URL (https, ssh or scp-like) to the web
+// URL of the repository. Returns "" for local paths and unknown schemes.
+func WebURL(remoteURL string) string {
+	u := strings.TrimSpace(remoteURL)
+	switch {
+	case strings.HasPrefix(u, "https://"), strings.HasPrefix(u, "http://"):
+	case strings.HasPrefix(u, "ssh://"):
+		u = strings.TrimPrefix(u, "ssh://")
+		host, path, _ := strings.Cut(u, "/")
+		host = host[strings.LastIndex(host, "@")+1:]
+		host, _, _ = strings.Cut(host, ":") // drop the ssh port
+		u = "https://" + host + "/" + path
+	case strings.Contains(u, ":") && !strings.Contains(u, "://"):
+		// scp-like: git@github.com:org/repo.git
+		host, path, _ := strings.Cut(u, ":")
+		host = host[strings.LastIndex(host, "@")+1:]
+		if host == "" || strings.Contains(host, "/") {
+			return ""
+		}
+		u = "https://" + host + "/" + path
+	default:
+		return ""
+	}
+	// Credentials in https remotes must never end up in a public comment
+	if scheme, rest, ok := strings.Cut(u, "://"); ok {
+		host, path, _ := strings.Cut(rest, "/")
+		host = host[strings.LastIndex(host, "@")+1:]
+		u = scheme + "://" + host + "/" + path
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+}
+
+// VerifyCommit resolves hash in the local git repo and applies check
+func VerifyCommit(hash, message string, check CommitCheck) error {
+	full := ResolveCommit(hash)
+	if full == "" {
+		return hberr.Errorf(hberr.Usage, "commit %s not found in this repository (use --reason auto for HEAD)", hash)
+	}
+
+	if check.MatchSubject {
+		subject := gitOutput("log", "-1", "--format=%s", full)
+		if !strings.HasPrefix(strings.ToLower(message), strings.ToLower(subject)) {
+			return hberr.Errorf(hberr.Usage, "--reason message does not match commit %s\n  got:      %q\n  expected: %q", hash, message, subject)
+		}
+	}
+
+	if ref := check.ReachableFrom; ref != "" {
+		err := exec.Command("git", "merge-base", "--is-ancestor", full, ref).Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+			return hberr.Errorf(hberr.Usage, "commit %s is not reachable from %s (push or merge it first)", hash, ref)
+		default:
+			return fmt.Errorf("cannot check commit %s against %s: %w", hash, ref, err)
+		}
+	}
+	return nil
+}
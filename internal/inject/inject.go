@@ -1,11 +1,10 @@
 package inject
 
 import (
-	"fmt"
-	"os"
 	"os/exec"
-	"regexp"
 	"strings"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
 )
 
 // HasFlag returns true if any of the given flag names appear in args.
@@ -37,15 +36,6 @@ func GetLatestGitCommit() string {
 	return strings.TrimSpace(string(out))
 }
 
-// GetSessionID checks CLAUDE_SESSION_ID env first, then OPENCODE_SESSION.
-// Returns "" if neither is set.
-func GetSessionID() string {
-	if id := os.Getenv("CLAUDE_SESSION_ID"); id != "" {
-		return id
-	}
-	return os.Getenv("OPENCODE_SESSION")
-}
-
 // GetFlagValue extracts the value of a flag from args.
 // Handles both "--flag value" and "--flag=value" forms.
 // Returns "" if the flag is not found or has no value.
@@ -65,64 +55,92 @@ func GetFlagValue(args []string, flags ...string) string {
 	return ""
 }
 
-// reasonPattern matches "<7+ hex chars> <message>" — a git commit hash followed by text.
-var reasonPattern = regexp.MustCompile(`^[0-9a-f]{7,40}\s+.+`)
+// ExtractFlag removes a flag and its value from args.
+// Handles both "--flag value" and "--flag=value" forms.
+// Returns the value ("" if the flag is absent) and the remaining args.
+func ExtractFlag(args []string, flag string) (string, []string) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, flag+"=") {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return strings.TrimPrefix(arg, flag+"="), rest
+		}
+		if arg == flag && i+1 < len(args) {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return args[i+1], rest
+		}
+	}
+	return "", args
+}
+
+// MapFlagValues returns a copy of args with the values of the given flags
+// replaced by fn(value). Handles both "--flag value" and "--flag=value" forms.
+func MapFlagValues(args []string, fn func(string) string, flags ...string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 0; i < len(result); i++ {
+		for _, flag := range flags {
+			if strings.HasPrefix(result[i], flag+"=") {
+				result[i] = flag + "=" + fn(strings.TrimPrefix(result[i], flag+"="))
+				break
+			}
+			if result[i] == flag && i+1 < len(result) {
+				result[i+1] = fn(result[i+1])
+				i++
+				break
+			}
+		}
+	}
+	return result
+}
+
+// mutatingCommands are bd subcommands that can write to the issue database
+var mutatingCommands = map[string]bool{
+	"create": true,
+	"q":      true,
+	"update": true,
+	"close":  true,
+	"reopen": true,
+	"delete": true,
+	"rename": true,
+	"dep":    true,
+	"label":  true,
+	"epic":   true,
+	"import": true,
+	"sync":   true,
+	"config": true,
+	"todo":   true,
+	"init":   true,
+}
+
+// IsMutating reports whether the bd subcommand in args[0] can modify issues
+// or repo configuration.
+func IsMutating(args []string) bool {
+	return len(args) > 0 && mutatingCommands[args[0]]
+}
 
 // RequireReason checks that "close" commands include --reason/-r with a valid
 // commit reference in the format "<hash> <message>".
 // Returns an error if missing or malformed. Non-close commands always pass.
+// It applies DefaultRules; repos can declare other rules (see Rules).
 func RequireReason(args []string) error {
-	if len(args) == 0 || args[0] != "close" {
-		return nil
-	}
-	if !HasFlag(args, "--reason", "-r") {
-		return fmt.Errorf("hb close requires --reason \"<commit-hash> <message>\"\n  example: hb close abc123 --reason \"a1b2c3d fix: resolve login timeout\"")
-	}
-	reason := GetFlagValue(args, "--reason", "-r")
-	if reason == "" || !reasonPattern.MatchString(reason) {
-		return fmt.Errorf("invalid --reason format: must be \"<commit-hash> <message>\"\n  got:      %q\n  expected: \"a1b2c3d fix: resolve login timeout\"", reason)
-	}
-	return nil
+	return DefaultRules.Validate(args)
 }
 
 // InjectFlags appends flags (actor, assignee, session) to args based
-// on the subcommand and logged-in handle. args[0] is the bd subcommand.
+// on the subcommand, the logged-in handle and the detected agent runtime.
+// args[0] is the bd subcommand. In DID actor mode the caller passes the DID
+// as handle. Pass runtime from config.Config.Agent, which also detects
+// the agents declared in .beads/hb.yaml.
 //
-// Injection rules:
+// Injection rules (DefaultRules):
 //   - --actor <handle>: ALL commands (global flag, controls created_by)
 //   - --assignee <handle>: update ONLY (NOT create, NOT close, NOT q)
-//   - --session <id>: close, update ONLY (from CLAUDE_SESSION_ID or OPENCODE_SESSION env)
+//   - --session <id>: close, update ONLY (runtime's session)
 //
 // If handle is empty, skip --assignee and --actor (return args unchanged).
-// If no session env var set, skip --session silently.
+// If no agent session is detected, skip --session silently.
 //
 // Note: --reason is NOT auto-injected. Use RequireReason to enforce it on close.
-func InjectFlags(args []string, handle string) []string {
-	if len(args) == 0 {
-		return args
-	}
-
-	subcommand := args[0]
-	result := make([]string, len(args))
-	copy(result, args)
-
-	// --actor (ALL commands) — only if handle is non-empty and not already present
-	if handle != "" && !HasFlag(result, "--actor") {
-		result = append(result, "--actor", handle)
-	}
-
-	// --assignee (update ONLY) — only if handle is non-empty and not already present
-	// NOT on create: auto-assignee breaks "update --claim" on newly created issues
-	if handle != "" && subcommand == "update" && !HasFlag(result, "--assignee", "-a") {
-		result = append(result, "--assignee", handle)
-	}
-
-	// --session (close, update ONLY) — from env, only if not already present
-	if (subcommand == "close" || subcommand == "update") && !HasFlag(result, "--session") {
-		if sessionID := GetSessionID(); sessionID != "" {
-			result = append(result, "--session", sessionID)
-		}
-	}
-
-	return result
+func InjectFlags(args []string, handle string, runtime agent.Info) []string {
+	return DefaultRules.Inject(args, Identity{Actor: handle, Handle: handle, Session: runtime.Session})
 }
@@ -4,6 +4,8 @@ import (
 	"slices"
 	"strings"
 	"testing"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
 )
 
 func TestHasFlag(t *testing.T) {
@@ -67,57 +69,6 @@ func TestHasFlag(t *testing.T) {
 	}
 }
 
-func TestGetSessionID(t *testing.T) {
-	tests := []struct {
-		name            string
-		claudeSessionID string
-		opencodeSession string
-		want            string
-		setClaude       bool
-		setOpencode     bool
-	}{
-		{
-			name:            "CLAUDE_SESSION_ID set",
-			claudeSessionID: "claude-123",
-			setClaude:       true,
-			want:            "claude-123",
-		},
-		{
-			name:            "OPENCODE_SESSION set",
-			opencodeSession: "oc-456",
-			setOpencode:     true,
-			want:            "oc-456",
-		},
-		{
-			name:            "both set, CLAUDE_SESSION_ID wins",
-			claudeSessionID: "claude-123",
-			opencodeSession: "oc-456",
-			setClaude:       true,
-			setOpencode:     true,
-			want:            "claude-123",
-		},
-		{
-			name: "neither set",
-			want: "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if tt.setClaude {
-				t.Setenv("CLAUDE_SESSION_ID", tt.claudeSessionID)
-			}
-			if tt.setOpencode {
-				t.Setenv("OPENCODE_SESSION", tt.opencodeSession)
-			}
-			got := GetSessionID()
-			if got != tt.want {
-				t.Errorf("GetSessionID() = %q, want %q", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestGetLatestGitCommit(t *testing.T) {
 	// We are in a git repo with commits, so this should return a non-empty string
 	got := GetLatestGitCommit()
@@ -261,7 +212,7 @@ func TestInjectFlags(t *testing.T) {
 		name              string
 		args              []string
 		handle            string
-		claudeSessionID   string
+		session           string
 		wantActor         bool
 		wantAssignee      bool
 		wantReason        bool
@@ -341,10 +292,10 @@ func TestInjectFlags(t *testing.T) {
 			wantActorValue: "custom",
 		},
 		{
-			name:             "close with CLAUDE_SESSION_ID gets --session",
+			name:             "close in an agent session gets --session",
 			args:             []string{"close", "bd-123"},
 			handle:           "alice.bsky.social",
-			claudeSessionID:  "sess-1",
+			session:          "sess-1",
 			wantActor:        true,
 			wantAssignee:     false,
 			wantReason:       false, // reason is never auto-injected
@@ -356,7 +307,7 @@ func TestInjectFlags(t *testing.T) {
 			name:             "close with explicit --session not overridden",
 			args:             []string{"close", "bd-123", "--session", "mine"},
 			handle:           "alice.bsky.social",
-			claudeSessionID:  "sess-1",
+			session:          "sess-1",
 			wantActor:        true,
 			wantAssignee:     false,
 			wantReason:       false, // reason is never auto-injected
@@ -374,10 +325,10 @@ func TestInjectFlags(t *testing.T) {
 			wantExact:    []string{"ready"},
 		},
 		{
-			name:              "update with CLAUDE_SESSION_ID gets --session",
+			name:              "update in an agent session gets --session",
 			args:              []string{"update", "bd-123", "--status", "in_progress"},
 			handle:            "alice.bsky.social",
-			claudeSessionID:   "sess-2",
+			session:           "sess-2",
 			wantActor:         true,
 			wantAssignee:      true,
 			wantSession:       true,
@@ -389,11 +340,7 @@ func TestInjectFlags(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.claudeSessionID != "" {
-				t.Setenv("CLAUDE_SESSION_ID", tt.claudeSessionID)
-			}
-
-			got := InjectFlags(tt.args, tt.handle)
+			got := InjectFlags(tt.args, tt.handle, agent.Info{Runtime: "claude-code", Session: tt.session})
 
 			if tt.checkExact {
 				if !slices.Equal(got, tt.wantExact) {
@@ -490,3 +437,95 @@ func TestInjectFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantValue string
+		wantRest  []string
+	}{
+		{
+			name:      "separate value",
+			args:      []string{"list", "--as", "work", "--json"},
+			wantValue: "work",
+			wantRest:  []string{"list", "--json"},
+		},
+		{
+			name:      "equals form",
+			args:      []string{"list", "--as=work"},
+			wantValue: "work",
+			wantRest:  []string{"list"},
+		},
+		{
+			name:      "absent",
+			args:      []string{"list", "--json"},
+			wantValue: "",
+			wantRest:  []string{"list", "--json"},
+		},
+		{
+			name:      "missing value",
+			args:      []string{"list", "--as"},
+			wantValue: "",
+			wantRest:  []string{"list", "--as"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, rest := ExtractFlag(tt.args, "--as")
+			if value != tt.wantValue {
+				t.Errorf("value = %q, want %q", value, tt.wantValue)
+			}
+			if !slices.Equal(rest, tt.wantRest) {
+				t.Errorf("rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestIsMutating(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"create", "title"}, true},
+		{[]string{"close", "bd-1"}, true},
+		{[]string{"delete", "bd-1"}, true},
+		{[]string{"list"}, false},
+		{[]string{"show", "bd-1"}, false},
+		{[]string{}, false},
+	}
+	for _, tt := range tests {
+		if got := IsMutating(tt.args); got != tt.want {
+			t.Errorf("IsMutating(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestMapFlagValues(t *testing.T) {
+	upper := strings.ToUpper
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"space form", []string{"list", "--assignee", "alice"}, []string{"list", "--assignee", "ALICE"}},
+		{"equals form", []string{"list", "--assignee=alice"}, []string{"list", "--assignee=ALICE"}},
+		{"short flag", []string{"list", "-a", "alice", "--status", "open"}, []string{"list", "-a", "ALICE", "--status", "open"}},
+		{"other flags untouched", []string{"list", "--status", "open"}, []string{"list", "--status", "open"}},
+		{"flag without value", []string{"list", "--assignee"}, []string{"list", "--assignee"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.args)
+			got := MapFlagValues(tt.args, upper, "--assignee", "-a")
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(tt.args, input) {
+				t.Error("input args were modified")
+			}
+		})
+	}
+}
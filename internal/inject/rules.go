@@ -0,0 +1,490 @@
+package inject
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// AllCommands is the rules key that applies to every bd subcommand
+const AllCommands = "*"
+
+// Injection sources
+const (
+	// SourceActor is the recorded actor: the handle, or the DID in DID actor mode
+	SourceActor = "actor"
+	// SourceHandle is the ATProto handle
+	SourceHandle = "handle"
+	// SourceDID is the ATProto DID
+	SourceDID = "did"
+	// SourceSession is the session ID of the detected agent runtime
+	SourceSession = "session"
+	// SourceNone disables an injection inherited from the defaults
+	SourceNone = "none"
+	// SourceEnvPrefix reads the first non-empty of a comma-separated list
+	// of environment variables, e.g. "env:HB_SESSION,BD_SESSION". Only
+	// variables with an EnvPrefixes prefix are read, unless the repo is
+	// trusted (see Identity.TrustedRepo).
+	SourceEnvPrefix = "env:"
+	// SourceGitPrefix reads from git: "git:commit" (short HEAD hash),
+	// "git:subject" (latest commit subject) or "git:reason" ("<hash> <subject>")
+	SourceGitPrefix = "git:"
+)
+
+// EnvPrefixes are the environment variable prefixes any repo's rules may
+// read. Other variables could hold the user's secrets, which an injected
+// flag would copy into the beads history.
+var EnvPrefixes = []string{"HB_", "BD_"}
+
+// Built-in validators
+const (
+	// ValidatorCommitRef requires "<7+ hex chars> <message>"
+	ValidatorCommitRef = "commit-ref"
+	// ValidatorNonEmpty requires a non-empty value
+	ValidatorNonEmpty = "non-empty"
+)
+
+// Rules declare, per bd subcommand (or AllCommands), which flags hb injects
+// and which flags are required. They are read from the rules section of
+// .beads/hb.yaml and merged over DefaultRules.
+type Rules map[string]CommandRules
+
+// CommandRules are the injection and validation rules of one subcommand,
+// keyed by long flag name (e.g. "--reason")
+type CommandRules struct {
+	Inject  map[string]InjectRule  `yaml:"inject,omitempty"`
+	Require map[string]RequireRule `yaml:"require,omitempty"`
+}
+
+// InjectRule injects a flag unless it (or an alias) is already present
+type InjectRule struct {
+	// From is the value source (see the Source constants)
+	From    string   `yaml:"from"`
+	Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// UnmarshalYAML accepts a bare source as shorthand, e.g. "--assignee: none"
+func (r *InjectRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.From = value.Value
+		return nil
+	}
+	type plain InjectRule
+	return value.Decode((*plain)(r))
+}
+
+// RequireRule requires a flag and optionally validates its value
+type RequireRule struct {
+	Aliases []string `yaml:"aliases,omitempty"`
+	// Validator is a built-in validator name (see the Validator constants)
+	Validator string `yaml:"validator,omitempty"`
+	// Pattern is a regular expression the value must match
+	Pattern string `yaml:"pattern,omitempty"`
+	// Example is shown in error messages
+	Example string `yaml:"example,omitempty"`
+	// Disabled drops a requirement inherited from the defaults or from
+	// AllCommands
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// re is Pattern compiled by Check
+	re *regexp.Regexp
+}
+
+// UnmarshalYAML accepts "none" as shorthand for a disabled requirement,
+// e.g. "--reason: none"
+func (r *RequireRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		if value.Value != SourceNone {
+			return fmt.Errorf("line %d: require rule must be a mapping or %q, got %q", value.Line, SourceNone, value.Value)
+		}
+		r.Disabled = true
+		return nil
+	}
+	type plain RequireRule
+	return value.Decode((*plain)(r))
+}
+
+// sessionSource is the default --session source
+const sessionSource = SourceSession
+
+// DefaultRules reproduce hb's built-in behaviour: --actor on every command,
+// --assignee on update, --session on close and update, and a commit
+// reference in --reason on close.
+var DefaultRules = Rules{
+	AllCommands: {
+		Inject: map[string]InjectRule{
+			"--actor": {From: SourceActor},
+		},
+	},
+	"update": {
+		Inject: map[string]InjectRule{
+			"--assignee": {From: SourceActor, Aliases: []string{"-a"}},
+			"--session":  {From: sessionSource},
+		},
+	},
+	"close": {
+		Inject: map[string]InjectRule{
+			"--session": {From: sessionSource},
+		},
+		Require: map[string]RequireRule{
+			"--reason": {
+				Aliases:   []string{"-r"},
+				Validator: ValidatorCommitRef,
+				Example:   "a1b2c3d fix: resolve login timeout",
+			},
+		},
+	},
+}
+
+// Merge returns the rules with overrides applied per subcommand and flag.
+// An override with From "none" removes an inherited injection, and a
+// disabled require rule an inherited requirement.
+func (r Rules) Merge(overrides Rules) Rules {
+	merged := make(Rules, len(r)+len(overrides))
+	for cmd, rules := range r {
+		merged[cmd] = rules.clone()
+	}
+	for cmd, over := range overrides {
+		rules := merged[cmd].clone()
+		for flag, rule := range over.Inject {
+			rules.Inject[flag] = rule
+		}
+		for flag, rule := range over.Require {
+			rules.Require[flag] = rule
+		}
+		merged[cmd] = rules
+	}
+	return merged
+}
+
+func (c CommandRules) clone() CommandRules {
+	out := CommandRules{
+		Inject:  make(map[string]InjectRule, len(c.Inject)),
+		Require: make(map[string]RequireRule, len(c.Require)),
+	}
+	for flag, rule := range c.Inject {
+		out.Inject[flag] = rule
+	}
+	for flag, rule := range c.Require {
+		out.Require[flag] = rule
+	}
+	return out
+}
+
+// Check reports malformed rules: unknown sources or validators and
+// patterns that do not compile. Valid patterns are compiled once here.
+func (r Rules) Check() error {
+	for cmd, rules := range r {
+		for flag, rule := range rules.Inject {
+			if err := checkSource(rule.From); err != nil {
+				return fmt.Errorf("rules.%s.inject.%s: %w", cmd, flag, err)
+			}
+		}
+		for flag, rule := range rules.Require {
+			switch rule.Validator {
+			case "", ValidatorCommitRef, ValidatorNonEmpty:
+			default:
+				return fmt.Errorf("rules.%s.require.%s: unknown validator %q", cmd, flag, rule.Validator)
+			}
+			if rule.Pattern != "" {
+				re, err := regexp.Compile(rule.Pattern)
+				if err != nil {
+					return fmt.Errorf("rules.%s.require.%s: invalid pattern: %w", cmd, flag, err)
+				}
+				rule.re = re
+				rules.Require[flag] = rule
+			}
+		}
+	}
+	return nil
+}
+
+func checkSource(from string) error {
+	switch {
+	case from == SourceActor, from == SourceHandle, from == SourceDID, from == SourceSession, from == SourceNone:
+		return nil
+	case strings.HasPrefix(from, SourceEnvPrefix) && len(from) > len(SourceEnvPrefix):
+		return nil
+	case from == SourceGitPrefix+"commit", from == SourceGitPrefix+"subject", from == SourceGitPrefix+"reason":
+		return nil
+	}
+	return fmt.Errorf("unknown source %q", from)
+}
+
+// Identity holds the values available to injection sources
+type Identity struct {
+	Actor  string
+	Handle string
+	DID    string
+	// Session is the agent runtime's session ID (see agent.Detect)
+	Session string
+	// TrustedRepo lets env sources read any variable, not only those with
+	// an EnvPrefixes prefix; set for repos the user trusted with hb trust
+	TrustedRepo bool
+}
+
+// envAllowed reports whether an env source may read the variable name
+func (id Identity) envAllowed(name string) bool {
+	if id.TrustedRepo {
+		return true
+	}
+	for _, prefix := range EnvPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// envNames returns the variables of an env source
+func envNames(from string) []string {
+	var names []string
+	for _, name := range strings.Split(strings.TrimPrefix(from, SourceEnvPrefix), ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// forCommand returns the rules applying to subcommand: AllCommands rules
+// overridden by the subcommand's own
+func (r Rules) forCommand(subcommand string) CommandRules {
+	return Rules{AllCommands: r[AllCommands]}.Merge(Rules{AllCommands: r[subcommand]})[AllCommands]
+}
+
+// Injection is the outcome of one injection rule
+type Injection struct {
+	Flag string
+	// Rule is the rules key that declared the injection: the subcommand or
+	// AllCommands
+	Rule string
+	From string
+	// Value is the injected value, empty if the rule was skipped
+	Value string
+	// Skipped says why nothing was injected
+	Skipped string
+}
+
+// Inject appends the flags declared for args[0] to a copy of args.
+// Flags already present (or given through an alias) and flags whose source
+// yields no value are skipped. Flags are appended in name order.
+func (r Rules) Inject(args []string, id Identity) []string {
+	result, _ := r.Explain(args, id)
+	return result
+}
+
+// Explain injects like Inject and also reports the outcome of every rule
+// that applies to args[0], in the order the rules were evaluated
+func (r Rules) Explain(args []string, id Identity) ([]string, []Injection) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	result := make([]string, len(args))
+	copy(result, args)
+
+	rules := r.forCommand(args[0])
+	flags := make([]string, 0, len(rules.Inject))
+	for flag := range rules.Inject {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	injections := make([]Injection, 0, len(flags))
+	for _, flag := range flags {
+		rule := rules.Inject[flag]
+		inj := Injection{Flag: flag, Rule: AllCommands, From: rule.From}
+		if _, ok := r[args[0]].Inject[flag]; ok {
+			inj.Rule = args[0]
+		}
+		switch {
+		case rule.From == SourceNone:
+			inj.Skipped = "disabled"
+		case HasFlag(result, append([]string{flag}, rule.Aliases...)...):
+			inj.Skipped = "already given"
+		default:
+			if inj.Value = sourceValue(rule.From, id); inj.Value != "" {
+				result = append(result, flag, inj.Value)
+			} else {
+				inj.Skipped = "no value from " + rule.From
+				if blocked := blockedEnv(rule.From, id); len(blocked) > 0 {
+					inj.Skipped += fmt.Sprintf(" (%s not read: repo not trusted, see hb trust)", strings.Join(blocked, ", "))
+				}
+			}
+		}
+		injections = append(injections, inj)
+	}
+	return result, injections
+}
+
+// Requirement is a required flag of a command and the value args give it
+type Requirement struct {
+	Flag  string
+	Value string
+}
+
+// Requirements lists the flags required for args[0], in name order, with
+// their values in args
+func (r Rules) Requirements(args []string) []Requirement {
+	if len(args) == 0 {
+		return nil
+	}
+	rules := r.forCommand(args[0])
+	reqs := make([]Requirement, 0, len(rules.Require))
+	for _, flag := range rules.requiredFlags() {
+		names := append([]string{flag}, rules.Require[flag].Aliases...)
+		reqs = append(reqs, Requirement{Flag: flag, Value: GetFlagValue(args, names...)})
+	}
+	return reqs
+}
+
+// requiredFlags returns the required flags in name order, leaving out
+// disabled requirements
+func (c CommandRules) requiredFlags() []string {
+	flags := make([]string, 0, len(c.Require))
+	for flag, rule := range c.Require {
+		if !rule.Disabled {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// Validate checks the required flags of args[0]. A missing flag is only an
+// error if no injection rule will supply it; call Validate again after
+// Inject to check injected values.
+func (r Rules) Validate(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	subcommand := args[0]
+	rules := r.forCommand(subcommand)
+
+	for _, flag := range rules.requiredFlags() {
+		rule := rules.Require[flag]
+		names := append([]string{flag}, rule.Aliases...)
+		if !HasFlag(args, names...) {
+			if inj, ok := rules.Inject[flag]; ok && inj.From != SourceNone {
+				continue
+			}
+			return missingFlagError(subcommand, flag, rule)
+		}
+		if err := validateValue(flag, GetFlagValue(args, names...), rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reasonPattern matches "<7+ hex chars> <message>" — a git commit hash followed by text.
+var reasonPattern = regexp.MustCompile(`^[0-9a-f]{7,40}\s+.+`)
+
+func missingFlagError(subcommand, flag string, rule RequireRule) error {
+	if rule.Validator == ValidatorCommitRef {
+		return hberr.Errorf(hberr.Usage, "hb %s requires %s \"<commit-hash> <message>\"\n  example: hb %s abc123 %s \"%s\"", subcommand, flag, subcommand, flag, rule.Example)
+	}
+	if rule.Example != "" {
+		return hberr.Errorf(hberr.Usage, "hb %s requires %s\n  example: %s %q", subcommand, flag, flag, rule.Example)
+	}
+	return hberr.Errorf(hberr.Usage, "hb %s requires %s", subcommand, flag)
+}
+
+func validateValue(flag, value string, rule RequireRule) error {
+	switch rule.Validator {
+	case ValidatorCommitRef:
+		if value == "" || !reasonPattern.MatchString(value) {
+			return hberr.Errorf(hberr.Usage, "invalid %s format: must be \"<commit-hash> <message>\"\n  got:      %q\n  expected: %q", flag, value, rule.Example)
+		}
+	case ValidatorNonEmpty:
+		if strings.TrimSpace(value) == "" {
+			return hberr.Errorf(hberr.Usage, "invalid %s: must not be empty", flag)
+		}
+	}
+	if rule.Pattern != "" {
+		re := rule.re
+		if re == nil {
+			// Rules built in code rather than loaded through Check
+			var err error
+			if re, err = regexp.Compile(rule.Pattern); err != nil {
+				return hberr.Errorf(hberr.Config, "invalid pattern for %s: %w", flag, err)
+			}
+		}
+		if !re.MatchString(value) {
+			msg := fmt.Sprintf("invalid %s format: must match %s\n  got: %q", flag, rule.Pattern, value)
+			if rule.Example != "" {
+				msg += fmt.Sprintf("\n  example: %q", rule.Example)
+			}
+			return hberr.New(hberr.Usage, msg)
+		}
+	}
+	return nil
+}
+
+// sourceValue resolves an injection source. Returns "" if it yields no value.
+func sourceValue(from string, id Identity) string {
+	switch {
+	case from == SourceActor:
+		return id.Actor
+	case from == SourceHandle:
+		return id.Handle
+	case from == SourceDID:
+		return id.DID
+	case from == SourceSession:
+		return id.Session
+	case strings.HasPrefix(from, SourceEnvPrefix):
+		for _, name := range envNames(from) {
+			if !id.envAllowed(name) {
+				continue
+			}
+			if v := os.Getenv(name); v != "" {
+				return v
+			}
+		}
+	case strings.HasPrefix(from, SourceGitPrefix):
+		return gitValue(strings.TrimPrefix(from, SourceGitPrefix))
+	}
+	return ""
+}
+
+// blockedEnv returns the variables of an env source that id may not read
+func blockedEnv(from string, id Identity) []string {
+	if !strings.HasPrefix(from, SourceEnvPrefix) {
+		return nil
+	}
+	var blocked []string
+	for _, name := range envNames(from) {
+		if !id.envAllowed(name) {
+			blocked = append(blocked, name)
+		}
+	}
+	return blocked
+}
+
+// gitValue reads commit information for git sources. Returns "" outside a
+// git repo or without commits.
+func gitValue(kind string) string {
+	switch kind {
+	case "commit":
+		return gitOutput("rev-parse", "--short", "HEAD")
+	case "subject":
+		return GetLatestGitCommit()
+	case "reason":
+		reason, _ := AutoReason()
+		return reason
+	}
+	return ""
+}
+
+func gitOutput(args ...string) string {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,308 @@
+package inject
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRulesMerge(t *testing.T) {
+	overrides := Rules{
+		"update": {Inject: map[string]InjectRule{"--assignee": {From: SourceNone}}},
+		"delete": {Require: map[string]RequireRule{"--reason": {Validator: ValidatorNonEmpty}}},
+	}
+	merged := DefaultRules.Merge(overrides)
+
+	if got := merged["update"].Inject["--assignee"].From; got != SourceNone {
+		t.Errorf("update --assignee source: got %q, want %q", got, SourceNone)
+	}
+	if _, ok := merged["update"].Inject["--session"]; !ok {
+		t.Error("update --session should be inherited from the defaults")
+	}
+	if _, ok := merged["delete"].Require["--reason"]; !ok {
+		t.Error("delete --reason should be required")
+	}
+	if got := DefaultRules["update"].Inject["--assignee"].From; got != SourceActor {
+		t.Errorf("Merge modified DefaultRules: update --assignee source is %q", got)
+	}
+}
+
+func TestRulesInject(t *testing.T) {
+	id := Identity{Actor: "did:plc:abc", Handle: "alice.bsky.social", DID: "did:plc:abc"}
+
+	t.Run("none disables an injection", func(t *testing.T) {
+		t.Setenv("CLAUDE_SESSION_ID", "")
+		t.Setenv("OPENCODE_SESSION", "")
+		rules := DefaultRules.Merge(Rules{
+			"update": {Inject: map[string]InjectRule{"--assignee": {From: SourceNone}}},
+		})
+		got := rules.Inject([]string{"update", "bd-1"}, id)
+		want := []string{"update", "bd-1", "--actor", "did:plc:abc"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("command rules override all-command rules", func(t *testing.T) {
+		rules := DefaultRules.Merge(Rules{
+			"create": {Inject: map[string]InjectRule{"--actor": {From: SourceHandle}}},
+		})
+		got := rules.Inject([]string{"create", "title"}, id)
+		want := []string{"create", "title", "--actor", "alice.bsky.social"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("env source uses first non-empty variable", func(t *testing.T) {
+		t.Setenv("HB_TEST_FIRST", "")
+		t.Setenv("HB_TEST_SECOND", "sess-2")
+		rules := Rules{"list": {Inject: map[string]InjectRule{"--session": {From: "env:HB_TEST_FIRST,HB_TEST_SECOND"}}}}
+		got := rules.Inject([]string{"list"}, id)
+		want := []string{"list", "--session", "sess-2"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("empty source is skipped", func(t *testing.T) {
+		t.Setenv("HB_TEST_UNSET", "")
+		rules := Rules{"list": {Inject: map[string]InjectRule{"--session": {From: "env:HB_TEST_UNSET"}}}}
+		got := rules.Inject([]string{"list"}, id)
+		if !slices.Equal(got, []string{"list"}) {
+			t.Errorf("got %v, want [list]", got)
+		}
+	})
+
+	t.Run("untrusted repo cannot read other variables", func(t *testing.T) {
+		t.Setenv("SECRET_TOKEN", "s3cret")
+		t.Setenv("HB_TEST_SESSION", "sess-3")
+		rules := Rules{"list": {Inject: map[string]InjectRule{
+			"--notes":   {From: "env:SECRET_TOKEN"},
+			"--session": {From: "env:SECRET_TOKEN,HB_TEST_SESSION"},
+		}}}
+		got, injections := rules.Explain([]string{"list"}, id)
+		want := []string{"list", "--session", "sess-3"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if skipped := injections[0].Skipped; !strings.Contains(skipped, "SECRET_TOKEN not read") {
+			t.Errorf("skip reason should name the unread variable, got %q", skipped)
+		}
+
+		trusted := id
+		trusted.TrustedRepo = true
+		got = rules.Inject([]string{"list"}, trusted)
+		want = []string{"list", "--notes", "s3cret", "--session", "s3cret"}
+		if !slices.Equal(got, want) {
+			t.Errorf("trusted repo: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("alias prevents injection", func(t *testing.T) {
+		rules := Rules{"update": {Inject: map[string]InjectRule{"--assignee": {From: SourceDID, Aliases: []string{"-a"}}}}}
+		got := rules.Inject([]string{"update", "bd-1", "-a", "bob"}, id)
+		want := []string{"update", "bd-1", "-a", "bob"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRulesExplain(t *testing.T) {
+	t.Setenv("CLAUDE_SESSION_ID", "")
+	t.Setenv("OPENCODE_SESSION", "")
+	id := Identity{Actor: "alice.bsky.social", Handle: "alice.bsky.social"}
+
+	got, injections := DefaultRules.Explain([]string{"update", "bd-1", "-a", "bob"}, id)
+	want := []string{"update", "bd-1", "-a", "bob", "--actor", "alice.bsky.social"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	wantInjections := []Injection{
+		{Flag: "--actor", Rule: AllCommands, From: SourceActor, Value: "alice.bsky.social"},
+		{Flag: "--assignee", Rule: "update", From: SourceActor, Skipped: "already given"},
+		{Flag: "--session", Rule: "update", From: sessionSource, Skipped: "no value from " + sessionSource},
+	}
+	if !slices.Equal(injections, wantInjections) {
+		t.Errorf("injections = %+v\nwant %+v", injections, wantInjections)
+	}
+
+	rules := DefaultRules.Merge(Rules{"update": {Inject: map[string]InjectRule{"--assignee": {From: SourceNone}}}})
+	_, injections = rules.Explain([]string{"update", "bd-1"}, id)
+	if injections[1].Skipped != "disabled" {
+		t.Errorf("--assignee: none should be reported as disabled, got %+v", injections[1])
+	}
+}
+
+func TestRulesRequirements(t *testing.T) {
+	got := DefaultRules.Requirements([]string{"close", "bd-1", "-r", "abc1234 done"})
+	want := []Requirement{{Flag: "--reason", Value: "abc1234 done"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Requirements(close) = %v, want %v", got, want)
+	}
+	if got := DefaultRules.Requirements([]string{"list"}); len(got) != 0 {
+		t.Errorf("Requirements(list) = %v, want none", got)
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	rules := DefaultRules.Merge(Rules{
+		"reopen": {Require: map[string]RequireRule{
+			"--reason": {Aliases: []string{"-r"}, Pattern: `^(bug|regression): .+`, Example: "regression: login broke again"},
+		}},
+		"delete": {Require: map[string]RequireRule{"--reason": {Validator: ValidatorNonEmpty}}},
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "reopen matching pattern", args: []string{"reopen", "bd-1", "-r", "bug: flaky"}},
+		{name: "reopen missing flag", args: []string{"reopen", "bd-1"}, wantErr: "hb reopen requires --reason"},
+		{name: "reopen not matching pattern", args: []string{"reopen", "bd-1", "--reason", "oops"}, wantErr: "must match"},
+		{name: "delete non-empty", args: []string{"delete", "bd-1", "--reason=dup"}},
+		{name: "delete empty", args: []string{"delete", "bd-1", "--reason", " "}, wantErr: "must not be empty"},
+		{name: "close keeps commit-ref", args: []string{"close", "bd-1", "--reason", "done"}, wantErr: "invalid --reason format"},
+		{name: "unconstrained command", args: []string{"list"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Validate(tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing flag supplied by injection", func(t *testing.T) {
+		rules := Rules{"close": {
+			Inject:  map[string]InjectRule{"--reason": {From: "git:reason"}},
+			Require: map[string]RequireRule{"--reason": {Validator: ValidatorCommitRef}},
+		}}
+		if err := rules.Validate([]string{"close", "bd-1"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRulesCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   Rules
+		wantErr string
+	}{
+		{name: "defaults", rules: DefaultRules},
+		{name: "git source", rules: Rules{"close": {Inject: map[string]InjectRule{"--reason": {From: "git:reason"}}}}},
+		{name: "unknown source", rules: Rules{"close": {Inject: map[string]InjectRule{"--x": {From: "file"}}}}, wantErr: `unknown source "file"`},
+		{name: "unknown git source", rules: Rules{"close": {Inject: map[string]InjectRule{"--x": {From: "git:author"}}}}, wantErr: "unknown source"},
+		{name: "empty env source", rules: Rules{"close": {Inject: map[string]InjectRule{"--x": {From: "env:"}}}}, wantErr: "unknown source"},
+		{name: "unknown validator", rules: Rules{"close": {Require: map[string]RequireRule{"--x": {Validator: "url"}}}}, wantErr: `unknown validator "url"`},
+		{name: "bad pattern", rules: Rules{"close": {Require: map[string]RequireRule{"--x": {Pattern: "("}}}}, wantErr: "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.Check()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInjectRuleUnmarshalYAML(t *testing.T) {
+	data := `
+update:
+  inject:
+    --assignee: none
+    --session:
+      from: env:MY_SESSION
+      aliases: [-s]
+`
+	var rules Rules
+	if err := yaml.Unmarshal([]byte(data), &rules); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got := rules["update"].Inject["--assignee"].From; got != SourceNone {
+		t.Errorf("--assignee source: got %q, want %q", got, SourceNone)
+	}
+	session := rules["update"].Inject["--session"]
+	if session.From != "env:MY_SESSION" || !slices.Equal(session.Aliases, []string{"-s"}) {
+		t.Errorf("--session rule: got %+v", session)
+	}
+}
+
+func TestRequireRuleDisabled(t *testing.T) {
+	data := `
+close:
+  require:
+    --reason: none
+delete:
+  require:
+    --reason:
+      disabled: true
+`
+	var overrides Rules
+	if err := yaml.Unmarshal([]byte(data), &overrides); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !overrides["close"].Require["--reason"].Disabled || !overrides["delete"].Require["--reason"].Disabled {
+		t.Fatalf("expected disabled rules, got %+v", overrides)
+	}
+
+	merged := DefaultRules.Merge(overrides)
+	if err := merged.Validate([]string{"close", "bd-1"}); err != nil {
+		t.Errorf("disabled --reason must not be required: %v", err)
+	}
+	if reqs := merged.Requirements([]string{"close", "bd-1"}); len(reqs) != 0 {
+		t.Errorf("disabled requirement listed: %+v", reqs)
+	}
+
+	// A subcommand can drop a requirement declared for every command
+	all := Rules{AllCommands: {Require: map[string]RequireRule{"--session": {}}}}.
+		Merge(Rules{"show": {Require: map[string]RequireRule{"--session": {Disabled: true}}}})
+	if err := all.Validate([]string{"show", "bd-1"}); err != nil {
+		t.Errorf("show should not require --session: %v", err)
+	}
+	if err := all.Validate([]string{"list"}); err == nil {
+		t.Error("list should still require --session")
+	}
+
+	var bad Rules
+	if err := yaml.Unmarshal([]byte("close:\n  require:\n    --reason: off\n"), &bad); err == nil {
+		t.Error("expected an error for an unknown require shorthand")
+	}
+}
+
+func TestRulesCheckCompilesPattern(t *testing.T) {
+	rules := Rules{"reopen": {Require: map[string]RequireRule{"--reason": {Pattern: "^bug: .+"}}}}
+	if err := rules.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if rules["reopen"].Require["--reason"].re == nil {
+		t.Fatal("Check should cache the compiled pattern")
+	}
+	merged := DefaultRules.Merge(rules)
+	if merged["reopen"].Require["--reason"].re == nil {
+		t.Error("Merge should keep the compiled pattern")
+	}
+	if err := merged.Validate([]string{"reopen", "bd-1", "--reason", "nope"}); err == nil {
+		t.Error("expected a pattern mismatch")
+	}
+}
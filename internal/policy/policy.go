@@ -0,0 +1,287 @@
+// Package policy decides which ATProto identities may run which proxied bd
+// commands. Policies live in the repo's .beads/hb.yaml, so a repo can let
+// agents create and close issues while reserving delete or config for people.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Rule effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Subject forms
+const (
+	// AnySubject matches every identity
+	AnySubject = "*"
+	// RolePrefix refers to a role declared in Policy.Roles, e.g. "role:agent"
+	RolePrefix = "role:"
+)
+
+// Policy is an ordered list of allow/deny rules. The first rule matching a
+// command decides; if none matches, Default applies.
+type Policy struct {
+	// Default is the effect when no rule matches: EffectAllow (default) or EffectDeny
+	Default string `yaml:"default,omitempty"`
+
+	// Roles map role names to subjects: DIDs or handle patterns like "*.agents.example.com"
+	Roles map[string][]string `yaml:"roles,omitempty"`
+
+	Rules []Rule `yaml:"rules,omitempty"`
+}
+
+// Rule allows or denies subcommands to subjects, optionally only for
+// issues with given labels or ID prefixes
+type Rule struct {
+	Effect string `yaml:"effect"`
+
+	// Commands are bd subcommands; empty or "*" matches all
+	Commands []string `yaml:"commands,omitempty"`
+
+	// Subjects are DIDs, handle patterns, "role:<name>" or "*"; empty matches all
+	Subjects []string `yaml:"subjects,omitempty"`
+
+	// Labels restrict the rule to issues carrying any of these labels
+	Labels []string `yaml:"labels,omitempty"`
+
+	// Prefixes restrict the rule to issue IDs starting with any of these
+	Prefixes []string `yaml:"prefixes,omitempty"`
+
+	// Reason is shown when the rule denies a command
+	Reason string `yaml:"reason,omitempty"`
+}
+
+// Issue is an issue affected by a command
+type Issue struct {
+	ID     string
+	Labels []string
+}
+
+// Request is a command to authorize
+type Request struct {
+	Command string
+	DID     string
+	Handle  string
+	// Issues are the issues the command affects, if any
+	Issues []Issue
+	// UnknownIssues is set when the command targets issues but none could
+	// be identified from its arguments
+	UnknownIssues bool
+}
+
+// Check reports malformed policies: unknown effects, undeclared roles and
+// invalid handle patterns
+func (p Policy) Check() error {
+	switch p.Default {
+	case "", EffectAllow, EffectDeny:
+	default:
+		return fmt.Errorf("policy.default must be %q or %q, got %q", EffectAllow, EffectDeny, p.Default)
+	}
+	for name, members := range p.Roles {
+		for _, m := range members {
+			if strings.HasPrefix(m, RolePrefix) {
+				return fmt.Errorf("policy.roles.%s: roles cannot contain roles (%q)", name, m)
+			}
+			if err := checkSubject(m); err != nil {
+				return fmt.Errorf("policy.roles.%s: %w", name, err)
+			}
+		}
+	}
+	for i, r := range p.Rules {
+		if r.Effect != EffectAllow && r.Effect != EffectDeny {
+			return fmt.Errorf("policy.rules[%d]: effect must be %q or %q, got %q", i, EffectAllow, EffectDeny, r.Effect)
+		}
+		for _, s := range r.Subjects {
+			if role, ok := strings.CutPrefix(s, RolePrefix); ok {
+				if _, declared := p.Roles[role]; !declared {
+					return fmt.Errorf("policy.rules[%d]: unknown role %q", i, role)
+				}
+				continue
+			}
+			if err := checkSubject(s); err != nil {
+				return fmt.Errorf("policy.rules[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkSubject(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty subject")
+	}
+	if _, err := path.Match(s, ""); err != nil {
+		return fmt.Errorf("invalid handle pattern %q", s)
+	}
+	return nil
+}
+
+// NeedsLabels reports whether deciding command may depend on issue labels,
+// so callers only look labels up when a rule uses them
+func (p Policy) NeedsLabels(command string) bool {
+	for _, r := range p.Rules {
+		if len(r.Labels) > 0 && r.matchesCommand(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide authorizes req. A command affecting several issues is allowed only
+// if every issue is allowed.
+func (p Policy) Decide(req Request) error {
+	if len(req.Issues) == 0 {
+		return p.decide(req, nil)
+	}
+	for i := range req.Issues {
+		if err := p.decide(req, &req.Issues[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p Policy) decide(req Request, issue *Issue) error {
+	for i, r := range p.Rules {
+		if !r.matchesCommand(req.Command) || !p.matchesSubject(r, req) || !r.matchesIssue(issue, req.UnknownIssues) {
+			continue
+		}
+		if r.Effect == EffectAllow {
+			return nil
+		}
+		return deniedError(req, issue, fmt.Sprintf("rule %d", i+1), r.Reason)
+	}
+	if p.Default == EffectDeny {
+		return deniedError(req, issue, "default", "")
+	}
+	return nil
+}
+
+func deniedError(req Request, issue *Issue, rule, reason string) *DeniedError {
+	err := &DeniedError{Command: req.Command, Actor: req.Handle, Rule: rule, Reason: reason}
+	if err.Actor == "" {
+		err.Actor = req.DID
+	}
+	if issue != nil {
+		err.IssueID = issue.ID
+	}
+	err.UnknownIssues = issue == nil && req.UnknownIssues
+	return err
+}
+
+func (r Rule) matchesCommand(command string) bool {
+	if len(r.Commands) == 0 {
+		return true
+	}
+	for _, c := range r.Commands {
+		if c == "*" || c == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) matchesSubject(r Rule, req Request) bool {
+	if len(r.Subjects) == 0 {
+		return true
+	}
+	for _, s := range r.Subjects {
+		if role, ok := strings.CutPrefix(s, RolePrefix); ok {
+			for _, m := range p.Roles[role] {
+				if subjectMatches(m, req) {
+					return true
+				}
+			}
+			continue
+		}
+		if subjectMatches(s, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectMatches matches a DID exactly, or a handle pattern case-insensitively
+func subjectMatches(subject string, req Request) bool {
+	if subject == AnySubject {
+		return true
+	}
+	if strings.HasPrefix(subject, "did:") {
+		return subject == req.DID
+	}
+	if req.Handle == "" {
+		return false
+	}
+	ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(subject, "@")), strings.ToLower(req.Handle))
+	return ok
+}
+
+// matchesIssue applies the label and prefix restrictions. A restricted rule
+// never matches a command without issues, except that a restricted deny
+// rule matches a command whose issues are unknown, so it fails closed.
+func (r Rule) matchesIssue(issue *Issue, unknown bool) bool {
+	if len(r.Labels) == 0 && len(r.Prefixes) == 0 {
+		return true
+	}
+	if issue == nil {
+		return unknown && r.Effect == EffectDeny
+	}
+	if len(r.Prefixes) > 0 && !hasAnyPrefix(issue.ID, r.Prefixes) {
+		return false
+	}
+	if len(r.Labels) > 0 && !hasAnyLabel(issue.Labels, r.Labels) {
+		return false
+	}
+	return true
+}
+
+func hasAnyPrefix(id string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if id != "" && strings.HasPrefix(id, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyLabel(labels, wanted []string) bool {
+	for _, l := range labels {
+		for _, w := range wanted {
+			if strings.EqualFold(l, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeniedError is returned when the policy refuses a command
+type DeniedError struct {
+	Command string
+	Actor   string
+	// IssueID is the issue the command was denied on, if any
+	IssueID string
+	// UnknownIssues is set when the issues of the command were unknown
+	UnknownIssues bool
+	// Rule identifies the deciding rule ("rule 2") or "default"
+	Rule   string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	msg := fmt.Sprintf("hb %s denied for %s by policy (%s)", e.Command, e.Actor, e.Rule)
+	if e.IssueID != "" {
+		msg = fmt.Sprintf("hb %s on %s denied for %s by policy (%s)", e.Command, e.IssueID, e.Actor, e.Rule)
+	} else if e.UnknownIssues {
+		msg = fmt.Sprintf("hb %s on unidentified issues denied for %s by policy (%s)", e.Command, e.Actor, e.Rule)
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
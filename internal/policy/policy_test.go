@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	aliceDID = "did:plc:alice"
+	botDID   = "did:plc:bot"
+)
+
+var testPolicy = Policy{
+	Roles: map[string][]string{
+		"maintainer": {aliceDID},
+		"agent":      {"*.agents.example.com"},
+	},
+	Rules: []Rule{
+		{Effect: EffectAllow, Commands: []string{"delete"}, Subjects: []string{"role:agent"}, Prefixes: []string{"scratch-"}},
+		{Effect: EffectDeny, Commands: []string{"delete", "rename", "config"}, Subjects: []string{"role:agent"}, Reason: "agents cannot delete issues or change config"},
+		{Effect: EffectDeny, Commands: []string{"close"}, Labels: []string{"security"}, Subjects: []string{"*"}},
+		{Effect: EffectAllow, Commands: []string{"close"}, Labels: []string{"security"}, Subjects: []string{"role:maintainer"}},
+	},
+}
+
+func TestDecide(t *testing.T) {
+	alice := Request{DID: aliceDID, Handle: "alice.bsky.social"}
+	bot := Request{DID: botDID, Handle: "ci.agents.example.com"}
+	with := func(r Request, command string, issues ...Issue) Request {
+		r.Command = command
+		r.Issues = issues
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr string
+	}{
+		{name: "agent creates", req: with(bot, "create")},
+		{name: "agent closes", req: with(bot, "close", Issue{ID: "bd-1"})},
+		{name: "agent deletes", req: with(bot, "delete", Issue{ID: "bd-1"}), wantErr: "agents cannot delete"},
+		{name: "agent deletes scratch issue", req: with(bot, "delete", Issue{ID: "scratch-1"})},
+		{name: "agent deletes mixed issues", req: with(bot, "delete", Issue{ID: "scratch-1"}, Issue{ID: "bd-2"}), wantErr: "on bd-2"},
+		{name: "agent runs config", req: with(bot, "config"), wantErr: "rule 2"},
+		{name: "maintainer deletes", req: with(alice, "delete", Issue{ID: "bd-1"})},
+		{name: "first matching rule wins", req: with(alice, "close", Issue{ID: "bd-1", Labels: []string{"Security"}}), wantErr: "rule 3"},
+		{name: "label rule skips other issues", req: with(alice, "close", Issue{ID: "bd-1", Labels: []string{"ui"}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testPolicy.Decide(tt.req)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected denial: %v", err)
+				}
+				return
+			}
+			var denied *DeniedError
+			if !errors.As(err, &denied) {
+				t.Fatalf("expected DeniedError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecideUnknownIssues(t *testing.T) {
+	p := Policy{Rules: []Rule{
+		{Effect: EffectAllow, Commands: []string{"delete"}, Prefixes: []string{"scratch-"}},
+		{Effect: EffectDeny, Commands: []string{"delete"}, Labels: []string{"security"}},
+	}}
+	req := Request{Command: "delete", Handle: "bot.test"}
+	if err := p.Decide(req); err != nil {
+		t.Errorf("restricted rules should not match a command without issues: %v", err)
+	}
+
+	// Unknown issues never satisfy a restricted allow rule, but do match a
+	// restricted deny rule
+	req.UnknownIssues = true
+	err := p.Decide(req)
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Rule != "rule 2" || !strings.Contains(err.Error(), "unidentified issues") {
+		t.Errorf("expected denial by rule 2, got %v", err)
+	}
+}
+
+func TestDecideDefaultDeny(t *testing.T) {
+	p := Policy{
+		Default: EffectDeny,
+		Rules:   []Rule{{Effect: EffectAllow, Commands: []string{"list", "show"}}},
+	}
+	if err := p.Decide(Request{Command: "list", Handle: "alice.test"}); err != nil {
+		t.Errorf("list should be allowed: %v", err)
+	}
+	err := p.Decide(Request{Command: "create", Handle: "alice.test"})
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Rule != "default" {
+		t.Errorf("expected default denial, got %v", err)
+	}
+}
+
+func TestNeedsLabels(t *testing.T) {
+	if !testPolicy.NeedsLabels("close") {
+		t.Error("close rules use labels")
+	}
+	if testPolicy.NeedsLabels("delete") {
+		t.Error("delete rules do not use labels")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr string
+	}{
+		{name: "valid", policy: testPolicy},
+		{name: "empty", policy: Policy{}},
+		{name: "bad default", policy: Policy{Default: "maybe"}, wantErr: "policy.default"},
+		{name: "bad effect", policy: Policy{Rules: []Rule{{Effect: "block"}}}, wantErr: "effect must be"},
+		{name: "unknown role", policy: Policy{Rules: []Rule{{Effect: EffectDeny, Subjects: []string{"role:ghost"}}}}, wantErr: `unknown role "ghost"`},
+		{name: "nested role", policy: Policy{Roles: map[string][]string{"a": {"role:b"}}}, wantErr: "cannot contain roles"},
+		{name: "bad pattern", policy: Policy{Rules: []Rule{{Effect: EffectDeny, Subjects: []string{"[a"}}}}, wantErr: "invalid handle pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyYAML(t *testing.T) {
+	data := `
+roles:
+  agent: ["*.agents.example.com"]
+rules:
+  - effect: deny
+    commands: [delete]
+    subjects: [role:agent]
+    reason: ask a maintainer
+`
+	var p Policy
+	if err := yaml.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if err := p.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	err := p.Decide(Request{Command: "delete", Handle: "x.agents.example.com", Issues: []Issue{{ID: "bd-1"}}})
+	if err == nil || !strings.HasSuffix(err.Error(), ": ask a maintainer") {
+		t.Errorf("expected denial with reason, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/completion"
+)
+
+// issueCommands complete issue IDs for their arguments
+var issueCommands = map[string]bool{
+	"show":   true,
+	"update": true,
+	"close":  true,
+}
+
+// completeBd completes a proxied command through bd's own completion, plus
+// issue IDs for issueCommands. The shell scripts cannot tell "--flag<TAB>"
+// from "--flag <TAB>", so a trailing flag is completed both as a flag name
+// and as a flag awaiting its value; the shell keeps what matches.
+func completeBd(ctx context.Context, cmd *cli.Command) {
+	// Flag parsing is skipped, so the arguments are exactly as typed
+	prev, current := completion.Split(append([]string{cmd.Name}, cmd.Args().Slice()...))
+
+	candidates := completion.Bd(ctx, prev, current)
+	if current != "" {
+		candidates = append(candidates, completion.Bd(ctx, append(prev, current), "")...)
+	} else if issueCommands[cmd.Name] {
+		candidates = append(candidates, completion.IssueIDs(ctx)...)
+	}
+	completion.Write(cmd.Root().Writer, candidates)
+}
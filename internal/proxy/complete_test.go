@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+// runCompletion runs a completion request for args through the proxy commands
+func runCompletion(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	root := &cli.Command{
+		Name:                  "hb",
+		Writer:                &out,
+		EnableShellCompletion: true,
+		Commands:              BuildProxyCommands(),
+	}
+	args = append(append([]string{"hb"}, args...), "--generate-shell-completion")
+	if err := root.Run(context.Background(), args); err != nil {
+		t.Fatalf("completion failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestCompleteBd(t *testing.T) {
+	t.Setenv("SHELL", "/bin/bash")
+	// bd echoes what it is asked to complete, and lists two issues
+	fakeBd(t, `case "$1" in
+  __complete) shift; echo "bd:$*"; echo ":4" ;;
+  list) echo '[{"id":"bd-1","title":"Fix login"},{"id":"bd-2","title":"Docs"}]' ;;
+esac
+`)
+
+	out := runCompletion(t, "update")
+	for _, want := range []string{"bd:update \n", "bd-1\n", "bd-2\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("update: output missing %q:\n%s", want, out)
+		}
+	}
+
+	// A trailing flag is completed as a flag name and as awaiting a value;
+	// issue IDs are not offered
+	out = runCompletion(t, "update", "bd-1", "--status")
+	want := "bd:update bd-1 --status\nbd:update bd-1 --status \n"
+	if out != want {
+		t.Errorf("update --status: got %q, want %q", out, want)
+	}
+
+	// Only issue commands get issue IDs
+	if out := runCompletion(t, "list"); strings.Contains(out, "bd-1") {
+		t.Errorf("list should not complete issue IDs:\n%s", out)
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/executor"
+)
+
+// commandCacheFile is the XDG-relative cache path of bd's command tree
+const commandCacheFile = "heartbeads/bd-commands.json"
+
+// discoverTimeout bounds the bd runs needed to discover its commands
+const discoverTimeout = 5 * time.Second
+
+// BdCommand is a top-level bd subcommand
+type BdCommand struct {
+	Name  string `json:"name"`
+	Usage string `json:"usage"`
+}
+
+// commandCache is bd's command tree, keyed by the binary's path and
+// version. Size and ModTime tell when to re-read the version, so a cache
+// hit costs a stat rather than a bd run.
+type commandCache struct {
+	Path     string      `json:"path"`
+	Version  string      `json:"version"`
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"mod_time"`
+	Commands []BdCommand `json:"commands"`
+}
+
+// builtinCommands are cobra's own commands, which hb replaces
+var builtinCommands = map[string]bool{
+	"help":       true,
+	"completion": true,
+}
+
+// Commands returns a proxy cli.Command for every command of the installed
+// bd, except the names in exclude (hb's native commands). Falls back to
+// defaultCommands when bd is missing or its commands cannot be read.
+func Commands(exclude ...string) []*cli.Command {
+	skip := make(map[string]bool, len(exclude)+len(builtinCommands))
+	for name := range builtinCommands {
+		skip[name] = true
+	}
+	for _, name := range exclude {
+		skip[name] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+	commands, err := DiscoverCommands(ctx)
+	if err != nil {
+		commands = defaultCommands
+	}
+	return buildCommands(commands, skip)
+}
+
+// DiscoverCommands reads bd's top-level commands from `bd help`, cached per
+// bd binary and version
+func DiscoverCommands(ctx context.Context) ([]BdCommand, error) {
+	bdPath, err := executor.FindBdBinary()
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(bdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := loadCommandCache()
+	if cached != nil && cached.Path == bdPath && cached.Size == info.Size() && cached.ModTime.Equal(info.ModTime()) {
+		return cached.Commands, nil
+	}
+
+	version, err := bdVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry := &commandCache{Path: bdPath, Version: version, Size: info.Size(), ModTime: info.ModTime()}
+	if cached != nil && cached.Path == bdPath && cached.Version == version {
+		// Same bd reinstalled; only the file changed
+		entry.Commands = cached.Commands
+	} else {
+		stdout, _, exitCode, err := executor.RunBd(ctx, []string{"help"}, "")
+		if err != nil {
+			return nil, err
+		}
+		if exitCode != 0 {
+			return nil, fmt.Errorf("bd help failed with exit code %d", exitCode)
+		}
+		entry.Commands = ParseHelp(stdout)
+		if len(entry.Commands) == 0 {
+			return nil, fmt.Errorf("no commands found in bd help")
+		}
+	}
+
+	if err := saveCommandCache(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to cache bd commands: %v\n", err)
+	}
+	return entry.Commands, nil
+}
+
+func bdVersion(ctx context.Context) (string, error) {
+	stdout, _, exitCode, err := executor.RunBd(ctx, []string{"version"}, "")
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("bd version failed with exit code %d", exitCode)
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(stdout)), "\n")
+	return version, nil
+}
+
+// helpCommandLine matches a command listed in cobra help: "  name   usage"
+var helpCommandLine = regexp.MustCompile(`^  ([a-z][a-z0-9-]*)(?:\s{2,}(.*))?$`)
+
+// nonCommandSections are the cobra help sections that do not list commands
+var nonCommandSections = map[string]bool{
+	"Usage:":                  true,
+	"Aliases:":                true,
+	"Examples:":               true,
+	"Flags:":                  true,
+	"Global Flags:":           true,
+	"Additional help topics:": true,
+}
+
+// ParseHelp extracts the commands listed in cobra-style help output: every
+// section other than usage, flags and examples, such as "Available
+// Commands:" or bd's command groups
+func ParseHelp(help []byte) []BdCommand {
+	var commands []BdCommand
+	seen := make(map[string]bool)
+	inCommands := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(help))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			// A section header, or prose that ends the section
+			inCommands = strings.HasSuffix(line, ":") && !nonCommandSections[line]
+			continue
+		}
+		if !inCommands {
+			continue
+		}
+		m := helpCommandLine.FindStringSubmatch(line)
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		commands = append(commands, BdCommand{Name: m[1], Usage: strings.TrimSpace(m[2])})
+	}
+	return commands
+}
+
+func loadCommandCache() *commandCache {
+	fPath, err := xdg.SearchCacheFile(commandCacheFile)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil
+	}
+	var cache commandCache
+	if json.Unmarshal(data, &cache) != nil {
+		return nil
+	}
+	return &cache
+}
+
+func saveCommandCache(cache *commandCache) error {
+	fPath, err := xdg.CacheFile(commandCacheFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath, data, 0600)
+}
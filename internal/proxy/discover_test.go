@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+)
+
+// fakeBd puts an executable bd running script first on PATH and returns
+// its path
+func fakeBd(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake bd needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bd")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake bd: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return path
+}
+
+const sampleHelp = `Issues chained together like beads.
+
+Usage:
+  bd [flags]
+  bd [command]
+
+Working With Issues:
+  close       Close one or more issues
+  create      Create a new issue (or multiple issues from markdown file)
+  gate        Manage async coordination gates
+
+Views & Reports:
+  list        List issues
+  status      Show issue database overview
+
+Additional Commands:
+  completion  Generate the autocompletion script for the specified shell
+  help        Help about any command
+
+Flags:
+      --actor string   Actor name for audit trail
+  -h, --help           help for bd
+
+Use "bd [command] --help" for more information about a command.
+`
+
+func TestParseHelp(t *testing.T) {
+	got := ParseHelp([]byte(sampleHelp))
+	want := []BdCommand{
+		{"close", "Close one or more issues"},
+		{"create", "Create a new issue (or multiple issues from markdown file)"},
+		{"gate", "Manage async coordination gates"},
+		{"list", "List issues"},
+		{"status", "Show issue database overview"},
+		{"completion", "Generate the autocompletion script for the specified shell"},
+		{"help", "Help about any command"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseHelp =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestDiscoverCommands(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+
+	runs := filepath.Join(t.TempDir(), "runs")
+	helpFile := filepath.Join(t.TempDir(), "help.txt")
+	if err := os.WriteFile(helpFile, []byte(sampleHelp), 0644); err != nil {
+		t.Fatalf("failed to write help: %v", err)
+	}
+	bdPath := fakeBd(t, `echo "$1" >> `+runs+`
+case "$1" in
+  version) echo "bd version 0.50.0 (test)" ;;
+  help) cat `+helpFile+` ;;
+esac
+`)
+	ctx := context.Background()
+
+	commands, err := DiscoverCommands(ctx)
+	if err != nil {
+		t.Fatalf("DiscoverCommands failed: %v", err)
+	}
+	if len(commands) != 7 || commands[2].Name != "gate" {
+		t.Errorf("unexpected commands: %v", commands)
+	}
+
+	// A cache hit does not run bd
+	if _, err := DiscoverCommands(ctx); err != nil {
+		t.Fatalf("cached DiscoverCommands failed: %v", err)
+	}
+	if data, _ := os.ReadFile(runs); string(data) != "version\nhelp\n" {
+		t.Errorf("bd runs = %q, want version and help once", data)
+	}
+
+	// A changed binary of the same version only re-reads the version
+	if err := os.WriteFile(bdPath, []byte("#!/bin/sh\n# reinstalled\necho \"$1\" >> "+runs+"\necho 'bd version 0.50.0 (test)'\n"), 0755); err != nil {
+		t.Fatalf("failed to rewrite fake bd: %v", err)
+	}
+	commands, err = DiscoverCommands(ctx)
+	if err != nil || len(commands) != 7 {
+		t.Fatalf("DiscoverCommands after reinstall = %v, %v", commands, err)
+	}
+	if data, _ := os.ReadFile(runs); string(data) != "version\nhelp\nversion\n" {
+		t.Errorf("bd runs = %q, want only an extra version", data)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+
+	helpFile := filepath.Join(t.TempDir(), "help.txt")
+	if err := os.WriteFile(helpFile, []byte(sampleHelp), 0644); err != nil {
+		t.Fatalf("failed to write help: %v", err)
+	}
+	fakeBd(t, `case "$1" in
+  version) echo "bd version 0.50.0" ;;
+  help) cat `+helpFile+` ;;
+esac
+`)
+
+	var names []string
+	for _, cmd := range Commands("status") {
+		names = append(names, cmd.Name)
+		if !cmd.SkipFlagParsing {
+			t.Errorf("%s should skip flag parsing", cmd.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "close,create,gate,list" {
+		t.Errorf("commands = %s, want bd's minus excluded and built-in ones", got)
+	}
+}
+
+func TestCommandsFallback(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("PATH", t.TempDir())
+	xdg.Reload()
+
+	if got, want := len(Commands()), len(BuildProxyCommands()); got != want {
+		t.Errorf("without bd, got %d commands, want the %d defaults", got, want)
+	}
+}
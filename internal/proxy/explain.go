@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gainforest/heartbeads-cli/internal/executor"
+	"github.com/gainforest/heartbeads-cli/internal/hooks"
+)
+
+// ExplainBd runs the proxy pipeline up to the point of executing bd and
+// writes what would run: the bd binary and argv, the environment hb adds,
+// the outcome of each injection and requirement rule, the hooks that would
+// run and the comment a close would post. Neither bd nor hooks run and
+// nothing is recorded. Returns the error the real run would fail with
+// before reaching bd.
+func ExplainBd(ctx context.Context, w io.Writer, args []string) error {
+	inv, err := prepare(ctx, args, true)
+	if err != nil {
+		return err
+	}
+
+	bdPath, bdErr := executor.FindBdBinary()
+	if bdErr != nil {
+		bdPath = "(not found in PATH)"
+	}
+
+	fmt.Fprintf(w, "Binary:  %s\n", bdPath)
+	fmt.Fprintf(w, "Command: %s\n", quoteArgs(append([]string{"bd"}, inv.args...)))
+	fmt.Fprintln(w, "Env:")
+	for _, kv := range executor.EnvOverrides(inv.actor, inv.agent.Env()) {
+		fmt.Fprintf(w, "  %s\n", kv)
+	}
+
+	fmt.Fprintln(w, "Rules:")
+	requirements := inv.rules.Requirements(inv.args)
+	if len(inv.injections) == 0 && len(requirements) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, inj := range inv.injections {
+		outcome := "injected " + quoteArgs([]string{inj.Value})
+		if inj.Skipped != "" {
+			outcome = "skipped: " + inj.Skipped
+		}
+		fmt.Fprintf(w, "  %-12s %s (rules.%s.inject, from %s)\n", inj.Flag, outcome, inj.Rule, inj.From)
+	}
+	for _, req := range requirements {
+		fmt.Fprintf(w, "  %-12s required, got %s\n", req.Flag, quoteArgs([]string{req.Value}))
+	}
+
+	var hookLines []string
+	for _, phase := range []string{hooks.Pre, hooks.Post} {
+		if path := hooks.Untrusted(phase, inv.args[0]); path != "" {
+			hookLines = append(hookLines, fmt.Sprintf("  %-4s %s (skipped: repo not trusted, see hb trust)", phase, path))
+		}
+		for _, path := range hooks.Find(phase, inv.args[0]) {
+			hookLines = append(hookLines, fmt.Sprintf("  %-4s %s", phase, path))
+		}
+	}
+	if len(hookLines) > 0 {
+		fmt.Fprintln(w, "Hooks:")
+		fmt.Fprintln(w, strings.Join(hookLines, "\n"))
+	}
+
+	if inv.cfg.CloseComment.Enabled && inv.args[0] == "close" {
+		fmt.Fprintln(w, "Comment:")
+		for _, line := range strings.Split(closeCommentText(inv.cfg.CloseComment, inv.rules, inv.agent, inv.args), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	if inv.identity != "" {
+		fmt.Fprintf(w, "Verify:  %s\n", inv.identity)
+	}
+	if inv.policy != "" {
+		fmt.Fprintf(w, "Policy:  %s\n", inv.policy)
+	}
+
+	return bdErr
+}
+
+// quoteArgs joins args for display, quoting those a shell would split
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?;&|<>()") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
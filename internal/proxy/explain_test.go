@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+)
+
+// setupLoggedIn logs in alice.test in an empty working directory, outside
+// any agent runtime, and puts a bd on PATH that records any invocation in
+// the returned file
+func setupLoggedIn(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake bd needs a POSIX shell")
+	}
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	for _, name := range []string{agent.RuntimeEnv, agent.SessionEnv, agent.ModelEnv} {
+		t.Setenv(name, "")
+	}
+	for _, r := range agent.Builtin {
+		for _, name := range slices.Concat(r.Detect, r.Session, r.Model) {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv("GIT_AUTHOR_EMAIL", "")
+	t.Setenv("BD_ACTOR", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	t.Chdir(t.TempDir())
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test", PDS: "http://127.0.0.1:1"}
+	if err := auth.PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	script := "#!/bin/sh\ntouch " + ran + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "bd"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake bd: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return ran
+}
+
+func TestExplainBd(t *testing.T) {
+	ran := setupLoggedIn(t)
+	t.Setenv("CLAUDECODE", "1")
+	t.Setenv("ANTHROPIC_MODEL", "opus")
+
+	var out bytes.Buffer
+	err := ExplainBd(context.Background(), &out, []string{"update", "bd-1", "--status", "in progress"})
+	if err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("bd must not run in a dry run")
+	}
+
+	for _, want := range []string{
+		`Command: bd update bd-1 --status "in progress" --actor alice.test --assignee alice.test`,
+		"BD_NAME=hb",
+		"BD_ACTOR=alice.test",
+		"HB_AGENT_RUNTIME=claude-code",
+		"HB_AGENT_MODEL=opus",
+		"GIT_AUTHOR_EMAIL=alice.test",
+		"--assignee   injected alice.test (rules.update.inject, from actor)",
+		"--actor      injected alice.test (rules.*.inject, from actor)",
+		"--session    skipped: no value from session",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestExplainBdValidation(t *testing.T) {
+	setupLoggedIn(t)
+
+	var out bytes.Buffer
+	err := ExplainBd(context.Background(), &out, []string{"close", "bd-1"})
+	if hberr.KindOf(err) != hberr.Usage {
+		t.Fatalf("expected a usage error for close without --reason, got %v", err)
+	}
+
+	out.Reset()
+	if err := ExplainBd(context.Background(), &out, []string{"close", "bd-1", "-r", "abc1234 done"}); err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `--reason     required, got "abc1234 done"`) {
+		t.Errorf("output missing --reason requirement:\n%s", out.String())
+	}
+}
+
+func TestExplainBdLabelPolicy(t *testing.T) {
+	ran := setupLoggedIn(t)
+	if err := os.MkdirAll(".beads", 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `policy:
+  rules:
+    - effect: deny
+      commands: [update]
+      labels: [security]
+`
+	if err := os.WriteFile(filepath.Join(".beads", "hb.yaml"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ExplainBd(context.Background(), &out, []string{"update", "bd-1", "--status", "open"}); err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("a dry run must not run bd show to read labels")
+	}
+	if !strings.Contains(out.String(), "Policy:  depends on the labels of bd-1") {
+		t.Errorf("output should say the policy depends on labels:\n%s", out.String())
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+	got := quoteArgs([]string{"bd", "create", "Fix login", "", "--json"})
+	want := `bd create "Fix login" "" --json`
+	if got != want {
+		t.Errorf("quoteArgs = %s, want %s", got, want)
+	}
+}
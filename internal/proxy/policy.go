@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/executor"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/inject"
+	"github.com/gainforest/heartbeads-cli/internal/policy"
+)
+
+// authorize checks the repo policy before a command reaches bd. Denials
+// are recorded in the audit log.
+func authorize(ctx context.Context, pol policy.Policy, sess *auth.Session, actor string, runtime agent.Info, args []string) error {
+	req, err := checkPolicy(ctx, pol, sess, actor, args)
+	var deniedErr *policy.DeniedError
+	if errors.As(err, &deniedErr) {
+		return denied(req, runtime, args, err)
+	}
+	return err
+}
+
+// checkPolicy decides the repo policy for args without recording anything.
+// Returns a *policy.DeniedError for a denied command.
+func checkPolicy(ctx context.Context, pol policy.Policy, sess *auth.Session, actor string, args []string) (policy.Request, error) {
+	req := policy.Request{
+		DID:    sess.DID.String(),
+		Handle: sess.Handle,
+	}
+	if len(args) == 0 || (len(pol.Rules) == 0 && pol.Default != policy.EffectDeny) {
+		return req, nil
+	}
+
+	req.Command = args[0]
+	issues, err := affectedIssues(ctx, args, actor, pol.NeedsLabels(args[0]))
+	if err != nil {
+		// Not a denial: keep the kind of the bd failure (e.g. bd missing)
+		return req, fmt.Errorf("cannot check policy for hb %s: %w", args[0], err)
+	}
+	req.Issues = issues
+	req.UnknownIssues = len(issues) == 0 && targetsIssues[args[0]]
+	return req, pol.Decide(req)
+}
+
+// targetsIssues are the bd subcommands that act on existing issues named
+// by ID. When no ID can be found in their arguments (e.g. delete
+// --from-file), restricted deny rules apply to them.
+var targetsIssues = map[string]bool{
+	"update": true,
+	"close":  true,
+	"delete": true,
+	"reopen": true,
+	"show":   true,
+	"edit":   true,
+	"label":  true,
+	"dep":    true,
+}
+
+// explainPolicy decides the repo policy for a dry run and describes the
+// outcome. Labels are never read with bd: when a rule needs the labels of
+// existing issues, the outcome says the decision depends on them.
+func explainPolicy(ctx context.Context, pol policy.Policy, sess *auth.Session, actor string, args []string) (string, error) {
+	if len(args) == 0 || (len(pol.Rules) == 0 && pol.Default != policy.EffectDeny) {
+		return "", nil
+	}
+	if pol.NeedsLabels(args[0]) && !createsIssue(args) {
+		if ids := attest.IssueIDs(args, nil); len(ids) > 0 {
+			return fmt.Sprintf("depends on the labels of %s (not read in a dry run)", strings.Join(ids, ", ")), nil
+		}
+	}
+	if _, err := checkPolicy(ctx, pol, sess, actor, args); err != nil {
+		var deniedErr *policy.DeniedError
+		if errors.As(err, &deniedErr) {
+			err = hberr.Wrap(hberr.Denied, err)
+		}
+		return "", err
+	}
+	return "allowed", nil
+}
+
+// denied records a policy denial in the audit log and classifies it
+func denied(req policy.Request, runtime agent.Info, args []string, err error) error {
+	err = hberr.Wrap(hberr.Denied, err)
+	entry := audit.Entry{
+		DID:      req.DID,
+		Handle:   req.Handle,
+		Session:  sessionOf(args, runtime),
+		Agent:    runtime.Runtime,
+		Model:    runtime.Model,
+		Command:  req.Command,
+		Args:     args[1:],
+		ExitCode: hberr.ExitCode(err),
+		Decision: audit.DecisionDenied,
+		Reason:   err.Error(),
+	}
+	for _, issue := range req.Issues {
+		if issue.ID != "" {
+			entry.Issues = append(entry.Issues, issue.ID)
+		}
+	}
+	audit.Record(entry)
+	return err
+}
+
+// affectedIssues lists the issues a command targets. For create, the new
+// issue's labels come from the label flags; for other commands labels are
+// read with `bd show` only when a rule needs them.
+func affectedIssues(ctx context.Context, args []string, actor string, withLabels bool) ([]policy.Issue, error) {
+	if args[0] == "create" || args[0] == "q" {
+		labels := splitLabels(inject.GetFlagValue(args, "--labels", "--label", "-l"))
+		if len(labels) == 0 {
+			return nil, nil
+		}
+		return []policy.Issue{{Labels: labels}}, nil
+	}
+
+	ids := attest.IssueIDs(args, nil)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	issues := make([]policy.Issue, len(ids))
+	for i, id := range ids {
+		issues[i].ID = id
+	}
+	if !withLabels {
+		return issues, nil
+	}
+
+	labels, err := issueLabels(ctx, ids, actor)
+	if err != nil {
+		return nil, err
+	}
+	for i := range issues {
+		issues[i].Labels = labels[issues[i].ID]
+	}
+	return issues, nil
+}
+
+// issueLabels reads the labels of issues with `bd show <ids> --json`
+func issueLabels(ctx context.Context, ids []string, actor string) (map[string][]string, error) {
+	args := append(append([]string{"show"}, ids...), "--json")
+	stdout, stderr, exitCode, err := executor.RunBd(ctx, args, actor)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("bd show failed with exit code %d: %s", exitCode, strings.TrimSpace(string(stderr)))
+	}
+
+	var shown []struct {
+		ID     string   `json:"id"`
+		Labels []string `json:"labels"`
+	}
+	if err := json.Unmarshal(stdout, &shown); err != nil {
+		return nil, fmt.Errorf("failed to parse bd show output: %w", err)
+	}
+	labels := make(map[string][]string, len(shown))
+	for _, s := range shown {
+		labels[s.ID] = s.Labels
+	}
+	return labels, nil
+}
+
+func splitLabels(value string) []string {
+	var labels []string
+	for _, l := range strings.Split(value, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
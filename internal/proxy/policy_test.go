@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/policy"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:bot"), Handle: "ci.agents.example.com"}
+	pol := policy.Policy{
+		Roles: map[string][]string{"agent": {"*.agents.example.com"}},
+		Rules: []policy.Rule{
+			{Effect: policy.EffectDeny, Commands: []string{"delete"}, Subjects: []string{"role:agent"}},
+			{Effect: policy.EffectDeny, Commands: []string{"create"}, Subjects: []string{"role:agent"}, Labels: []string{"security"}},
+		},
+	}
+	ctx := context.Background()
+
+	if err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"close", "bd-1", "--reason", "abc1234 done"}); err != nil {
+		t.Errorf("close should be allowed: %v", err)
+	}
+	if err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"create", "Fix", "--labels", "ui,docs"}); err != nil {
+		t.Errorf("create without security label should be allowed: %v", err)
+	}
+
+	var denied *policy.DeniedError
+	err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"create", "Rotate keys", "-l", "ops, security"})
+	if !errors.As(err, &denied) {
+		t.Errorf("create with security label should be denied, got %v", err)
+	}
+	err = authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"delete", "bd-1", "--force"})
+	if !errors.As(err, &denied) || denied.IssueID != "bd-1" {
+		t.Fatalf("delete should be denied on bd-1, got %v", err)
+	}
+
+	// Both denials are audited
+	path, err := audit.Path()
+	if err != nil {
+		t.Fatalf("audit.Path failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d:\n%s", len(lines), data)
+	}
+	if !strings.Contains(lines[1], `"decision":"denied"`) || !strings.Contains(lines[1], `"command":"delete"`) {
+		t.Errorf("unexpected audit entry: %s", lines[1])
+	}
+}
+
+func TestAuthorizeUnknownIssues(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:bot"), Handle: "bot.test"}
+	pol := policy.Policy{Rules: []policy.Rule{
+		{Effect: policy.EffectDeny, Commands: []string{"delete"}, Prefixes: []string{"prod-"}},
+	}}
+	ctx := context.Background()
+
+	if err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"delete", "bd-1"}); err != nil {
+		t.Errorf("delete outside the prefix should be allowed: %v", err)
+	}
+	// The IDs are in the file, so the prefix rule cannot be checked
+	var denied *policy.DeniedError
+	err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"delete", "--from-file", "ids.txt"})
+	if !errors.As(err, &denied) || !denied.UnknownIssues {
+		t.Errorf("delete with unidentified issues should be denied, got %v", err)
+	}
+	if err := authorize(ctx, pol, sess, sess.Handle, agent.Info{}, []string{"list"}); err != nil {
+		t.Errorf("list targets no issues and should be allowed: %v", err)
+	}
+}
+
+func TestAuthorizeLabelLookupFailure(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	fakeBd(t, "echo 'database locked' >&2\nexit 3\n")
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:bot"), Handle: "bot.test"}
+	pol := policy.Policy{Rules: []policy.Rule{
+		{Effect: policy.EffectDeny, Commands: []string{"close"}, Labels: []string{"security"}},
+	}}
+	err := authorize(context.Background(), pol, sess, sess.Handle, agent.Info{}, []string{"close", "bd-1"})
+	if err == nil || !strings.Contains(err.Error(), "database locked") {
+		t.Fatalf("expected the bd show failure, got %v", err)
+	}
+	// A failed lookup is not a policy decision
+	if kind := hberr.KindOf(err); kind != hberr.General {
+		t.Errorf("kind = %s, want %s", kind, hberr.General)
+	}
+}
+
+func TestAuthorizeLabelAdd(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	// bd show fails on anything but bd-1, like a real bd given a label
+	fakeBd(t, `if [ "$*" != "show bd-1 --json" ]; then echo "no issue found: $*" >&2; exit 1; fi
+echo '[{"id":"bd-1","labels":["ui"]}]'
+`)
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:bot"), Handle: "bot.test"}
+	pol := policy.Policy{Rules: []policy.Rule{
+		{Effect: policy.EffectDeny, Commands: []string{"label"}, Labels: []string{"security"}},
+	}}
+	if err := authorize(context.Background(), pol, sess, sess.Handle, agent.Info{}, []string{"label", "add", "bd-1", "my-label"}); err != nil {
+		t.Errorf("label add on an issue without the security label should be allowed: %v", err)
+	}
+}
+
+func TestAuthorizeWithoutPolicy(t *testing.T) {
+	sess := &auth.Session{DID: syntax.DID("did:plc:bot"), Handle: "bot.test"}
+	if err := authorize(context.Background(), policy.Policy{}, sess, sess.Handle, agent.Info{}, []string{"delete", "bd-1"}); err != nil {
+		t.Errorf("empty policy should allow everything: %v", err)
+	}
+}
+
+func TestRecordAudit(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("CLAUDE_SESSION_ID", "")
+	t.Setenv("OPENCODE_SESSION", "")
+	xdg.Reload()
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test"}
+	args := []string{"create", "Fix login", "--actor", "alice.test", "--session", "sess-1"}
+	runtime := agent.Info{Runtime: "claude-code", Session: "env-session", Model: "opus"}
+	recordAudit(sess, runtime, args, 0, 1500*time.Millisecond, []byte("✓ Created issue: bd-x9\n"))
+
+	entries, err := audit.Read(audit.Filter{Issue: "bd-x9"})
+	if err != nil {
+		t.Fatalf("audit.Read failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry for bd-x9, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Command != "create" || e.Session != "sess-1" || e.DurationMS != 1500 || e.DID != "did:plc:alice" || e.Agent != "claude-code" || e.Model != "opus" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if !slices.Equal(e.Args, args[1:]) {
+		t.Errorf("args = %v, want %v", e.Args, args[1:])
+	}
+}
+
+func TestRecordAuditQuickCapture(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test"}
+	recordAudit(sess, agent.Info{}, []string{"q", "Fix login"}, 0, time.Second, []byte("bd-q1\n"))
+
+	entries, err := audit.Read(audit.Filter{Issue: "bd-q1"})
+	if err != nil {
+		t.Fatalf("audit.Read failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Command != "q" {
+		t.Errorf("expected the q entry for bd-q1, got %+v", entries)
+	}
+}
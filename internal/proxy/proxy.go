@@ -1,117 +1,522 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/gainforest/heartbeads-cli/internal/agent"
+	"github.com/gainforest/heartbeads-cli/internal/alias"
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
 	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+	"github.com/gainforest/heartbeads-cli/internal/config"
 	"github.com/gainforest/heartbeads-cli/internal/executor"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/hooks"
 	"github.com/gainforest/heartbeads-cli/internal/inject"
 	"github.com/urfave/cli/v3"
 )
 
-// ExecBd authenticates, validates required flags, injects flags, runs bd, and writes output.
-// Returns an error if auth fails, validation fails, bd fails to execute, or exits non-zero.
+// ExecBd authenticates, validates required flags, checks the repo policy, injects flags,
+// runs pre hooks, runs bd, writes output, records the run in the audit log and runs post hooks.
+// Successful commands are then attested, and closed issues commented on, if the repo enables it.
+// Returns an error if auth fails, validation fails, the policy denies the command, a pre hook
+// fails, bd fails to execute, or exits non-zero. Denials, pre hook aborts and failures to
+// execute bd are audited too.
 func ExecBd(ctx context.Context, w io.Writer, args []string) error {
-	// Validate required flags before auth (fast-fail on bad input)
-	if err := inject.RequireReason(args); err != nil {
+	inv, err := prepare(ctx, args, false)
+	if err != nil {
 		return err
 	}
+	cfg, sess, actor, aliases, runtime := inv.cfg, inv.sess, inv.actor, inv.aliases, inv.agent
+	args = inv.args
+
+	payload := hooks.Payload{
+		Command:  args[0],
+		Args:     args[1:],
+		Identity: hooks.Identity{DID: sess.DID.String(), Handle: sess.Handle, Actor: actor},
+		Session:  sessionOf(args, runtime),
+		Agent:    runtime,
+	}
+	if err := hooks.Run(ctx, hooks.Pre, payload, os.Stderr); err != nil {
+		return recordFailure(sess, runtime, args, audit.DecisionAborted, err)
+	}
+
+	// Output streams as bd runs; attestation needs a copy of stdout to find
+	// the issue IDs, post hooks a copy of both streams
+	attesting := cfg.Attest && attest.ShouldAttest(args)
+	postHooks := len(hooks.Find(hooks.Post, args[0])) > 0
+	var captured, capturedErr bytes.Buffer
+	stdout, stderr := w, io.Writer(os.Stderr)
+	if attesting || postHooks || createsIssue(args) {
+		stdout = io.MultiWriter(w, &captured)
+	}
+	if postHooks {
+		stderr = io.MultiWriter(stderr, &capturedErr)
+	}
 
-	sess, err := auth.RequireAuth()
+	// Output is rewritten from the local alias map only, so a slow
+	// directory never stalls bd's output; unknown DIDs are resolved in the
+	// background and show as handles from the next run on
+	var didOut, didErr *executor.LineWriter
+	var resolver *alias.Resolver
+	if aliases != nil {
+		resolver = alias.NewResolver(ctx, aliases, auth.ConfigDirectory())
+		rewrite := func(line []byte) []byte { return executor.RewriteDIDs(line, resolver.Handle) }
+		didOut = executor.NewLineWriter(stdout, rewrite)
+		didErr = executor.NewLineWriter(stderr, rewrite)
+		stdout, stderr = didOut, didErr
+	}
+
+	stdio := executor.IO{Stdin: os.Stdin, Stdout: stdout, Stderr: stderr, TTY: onTerminal(w)}
+	start := time.Now()
+	exitCode, err := executor.StreamBd(ctx, args, actor, stdio, runtime.Env()...)
+	if aliases != nil {
+		_ = didOut.Flush()
+		_ = didErr.Flush()
+		resolver.Wait()
+		_ = aliases.Save()
+	}
 	if err != nil {
-		return err
+		return recordFailure(sess, runtime, args, audit.DecisionFailed, err)
+	}
+	recordAudit(sess, runtime, args, exitCode, time.Since(start), captured.Bytes())
+
+	if postHooks {
+		payload.Result = &hooks.Result{Stdout: captured.String(), Stderr: capturedErr.String(), ExitCode: exitCode}
+		if err := hooks.Run(ctx, hooks.Post, payload, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	if exitCode != 0 {
+		return hberr.BdExit(args[0], exitCode)
+	}
+
+	if attesting {
+		attestAction(ctx, sess, actor, args, captured.Bytes())
+	}
+	if cfg.CloseComment.Enabled && args[0] == "close" {
+		commentOnClose(ctx, cfg.CloseComment, inv.rules, sess, runtime, args)
+	}
+
+	return nil
+}
+
+// invocation is a bd command that passed hb's checks, ready to run
+type invocation struct {
+	cfg   *config.Config
+	rules inject.Rules
+	sess  *auth.Session
+	actor string
+	// agent is the detected agent runtime, if any
+	agent agent.Info
+	// aliases is set in DID actor mode
+	aliases *alias.Map
+	// args are the final bd arguments, after flag injection
+	args       []string
+	injections []inject.Injection
+	// policy is the outcome of the repo policy in a dry run, "" without one
+	policy string
+	// identity is the cached identity verification in a dry run, "" when
+	// verified-identity mode is off
+	identity string
+}
+
+// prepare runs everything before bd executes: account selection, flag
+// validation, auth, identity verification, the repo policy and flag
+// injection. A dry run does not record policy denials in the audit log, and
+// does not run bd to read labels: a decision that depends on them is left
+// open.
+func prepare(ctx context.Context, args []string, dryRun bool) (*invocation, error) {
+	// --as is an hb flag; bd never sees it
+	if as, rest := inject.ExtractFlag(args, "--as"); as != "" {
+		if err := auth.SelectAccount(as); err != nil {
+			return nil, err
+		}
+		args = rest
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	rules := cfg.EffectiveRules()
+	runtime := cfg.Agent()
+
+	args, err = rules.ExpandAutoReason(args)
+	if err != nil {
+		return nil, err
 	}
 
-	args = inject.InjectFlags(args, sess.Handle)
+	// Validate required flags before auth (fast-fail on bad input)
+	if err := validateArgs(rules, cfg, args); err != nil {
+		return nil, err
+	}
 
-	stdout, stderr, exitCode, err := executor.RunBd(ctx, args, sess.Handle)
+	sess, err := auth.RequireAuth(ctx)
 	if err != nil {
+		return nil, err
+	}
+
+	var identityOutcome string
+	if dryRun {
+		identityOutcome = explainIdentity(cfg, sess)
+	} else if err := verifyIdentity(ctx, cfg, sess, args); err != nil {
+		return nil, err
+	}
+
+	actor := sess.Handle
+	if cfg.UseDIDActor() {
+		actor = sess.DID.String()
+	}
+
+	var policyOutcome string
+	if dryRun {
+		if policyOutcome, err = explainPolicy(ctx, cfg.Policy, sess, actor, args); err != nil {
+			return nil, err
+		}
+	} else if err := authorize(ctx, cfg.Policy, sess, actor, runtime, args); err != nil {
+		return nil, err
+	}
+
+	var aliases *alias.Map
+	if cfg.UseDIDActor() {
+		aliases = loadAliases(sess)
+		args = resolveHandleArgs(args, aliases)
+	}
+
+	// Only a trusted repo's rules may read any environment variable
+	root := hooks.RepoRoot()
+	id := inject.Identity{Actor: actor, Handle: sess.Handle, DID: sess.DID.String(), Session: runtime.Session, TrustedRepo: root != "" && hooks.Trusted(root)}
+	args, injections := rules.Explain(args, id)
+
+	// Injected values must satisfy the rules too
+	if err := validateArgs(rules, cfg, args); err != nil {
+		return nil, err
+	}
+
+	return &invocation{
+		cfg:        cfg,
+		rules:      rules,
+		sess:       sess,
+		actor:      actor,
+		agent:      runtime,
+		aliases:    aliases,
+		args:       args,
+		injections: injections,
+		policy:     policyOutcome,
+		identity:   identityOutcome,
+	}, nil
+}
+
+// onTerminal reports whether hb runs interactively with output to w, in
+// which case bd gets a pseudo-terminal and behaves as if run directly
+func onTerminal(w io.Writer) bool {
+	return executor.SupportsTTY && w == io.Writer(os.Stdout) &&
+		executor.IsTerminal(os.Stdin) && executor.IsTerminal(os.Stdout)
+}
+
+// createsIssue reports whether args create an issue, whose ID is then
+// only known from bd's output
+func createsIssue(args []string) bool {
+	return len(args) > 0 && (args[0] == "create" || args[0] == "q")
+}
+
+// sessionOf returns the agent session of a command: its --session flag,
+// or the session of the detected agent runtime
+func sessionOf(args []string, runtime agent.Info) string {
+	if session := inject.GetFlagValue(args, "--session"); session != "" {
+		return session
+	}
+	return runtime.Session
+}
+
+// recordAudit appends a bd run to the audit log. stdout is only needed to
+// find the ID of a created issue.
+func recordAudit(sess *auth.Session, runtime agent.Info, args []string, exitCode int, elapsed time.Duration, stdout []byte) {
+	entry := auditEntry(sess, runtime, args, stdout)
+	entry.ExitCode = exitCode
+	entry.DurationMS = elapsed.Milliseconds()
+	audit.Record(entry)
+}
+
+// recordFailure appends a command that never reached or never started bd
+// to the audit log with decision and err's exit code, and returns err
+func recordFailure(sess *auth.Session, runtime agent.Info, args []string, decision string, err error) error {
+	entry := auditEntry(sess, runtime, args, nil)
+	entry.ExitCode = hberr.ExitCode(err)
+	entry.Decision = decision
+	entry.Reason = err.Error()
+	audit.Record(entry)
+	return err
+}
+
+func auditEntry(sess *auth.Session, runtime agent.Info, args []string, stdout []byte) audit.Entry {
+	return audit.Entry{
+		DID:     sess.DID.String(),
+		Handle:  sess.Handle,
+		Session: sessionOf(args, runtime),
+		Agent:   runtime.Runtime,
+		Model:   runtime.Model,
+		Command: args[0],
+		Args:    args[1:],
+		Issues:  attest.IssueIDs(args, stdout),
+	}
+}
+
+// validateArgs checks required flags and the commits their reasons reference
+func validateArgs(rules inject.Rules, cfg *config.Config, args []string) error {
+	if err := rules.Validate(args); err != nil {
 		return err
 	}
+	return rules.VerifyCommitRefs(args, cfg.Reason)
+}
 
-	if len(stdout) > 0 {
-		_, _ = w.Write(stdout)
+// attestAction writes an attestation record for each issue changed by a
+// successful bd command. The bd command has already succeeded, so failures
+// are reported as warnings.
+func attestAction(ctx context.Context, sess *auth.Session, actor string, args []string, stdout []byte) {
+	ids := attest.IssueIDs(args, stdout)
+	if len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "warning: not attested: no issue ID found for hb %s\n", args[0])
+		return
 	}
-	if len(stderr) > 0 {
-		_, _ = os.Stderr.Write(stderr)
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: not attested: %v\n", err)
+		return
 	}
 
-	if exitCode != 0 {
-		return fmt.Errorf("hb %s failed with exit code %d", args[0], exitCode)
+	normalized := attest.NormalizeArgs(args[1:])
+	for _, id := range ids {
+		action := attest.Action{IssueID: id, Operation: args[0], Args: normalized}
+		if args[0] != "delete" {
+			action.IssueHash = issueHash(ctx, actor, id)
+		}
+		if _, err := attest.Create(ctx, client, sess.DID.String(), action); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to attest %s: %v\n", id, err)
+		}
+	}
+}
+
+// commentOnClose posts a comment with the closing commit and session on
+// each issue closed by a successful bd close. Comments that cannot be
+// posted now are queued and posted by the next close or `hb comment flush`.
+// The bd command has already succeeded, so failures are reported as warnings.
+func commentOnClose(ctx context.Context, cfg config.CloseCommentConfig, rules inject.Rules, sess *auth.Session, runtime agent.Info, args []string) {
+	ids := attest.IssueIDs(args, nil)
+	text := closeCommentText(cfg, rules, runtime, args)
+	did := sess.DID.String()
+
+	client, err := auth.LoadClient(ctx)
+	if err != nil {
+		for _, id := range ids {
+			err := comments.Enqueue(did, comments.CreateCommentInput{BeadsID: id, Text: text, Agent: runtime}, err)
+			fmt.Fprintf(os.Stderr, "warning: close comment on %s: %v\n", id, err)
+		}
+		return
 	}
 
+	// Earlier comments first, so the issue history stays in order
+	result, err := comments.Flush(ctx, client, did)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to read queued comments: %v\n", err)
+	}
+	for _, err := range result.Dropped {
+		fmt.Fprintf(os.Stderr, "warning: dropped queued %v\n", err)
+	}
+
+	for _, id := range ids {
+		if _, err := comments.PostOrQueue(ctx, client, did, comments.CreateCommentInput{BeadsID: id, Text: text, Agent: runtime}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: close comment on %s: %v\n", id, err)
+		}
+	}
+}
+
+// closeCommentText describes a close: the reason, a link to the closing
+// commit on the configured git remote, and the agent session
+func closeCommentText(cfg config.CloseCommentConfig, rules inject.Rules, runtime agent.Info, args []string) string {
+	var b strings.Builder
+	b.WriteString("Closed")
+	if reason := inject.GetFlagValue(args, "--reason", "-r"); reason != "" {
+		b.WriteString(": " + reason)
+	}
+	if hash, _ := rules.CommitRef(args); hash != "" {
+		commit := hash
+		if full := inject.ResolveCommit(hash); full != "" {
+			commit = full
+			if url := inject.CommitURL(cfg.RemoteName(), full); url != "" {
+				commit = url
+			}
+		}
+		b.WriteString("\nCommit: " + commit)
+	}
+	if session := sessionOf(args, runtime); session != "" {
+		b.WriteString("\nSession: " + session)
+	}
+	return b.String()
+}
+
+// issueHash hashes the current state of an issue as shown by bd.
+// Returns "" if the issue cannot be read.
+func issueHash(ctx context.Context, actor, id string) string {
+	out, _, exitCode, err := executor.RunBd(ctx, []string{"show", id, "--json"}, actor)
+	if err != nil || exitCode != 0 {
+		return ""
+	}
+	hash, err := attest.IssueHash(out)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// loadAliases loads the handle<->DID alias map and records the session's
+// own handle. Aliases are a display aid, so errors yield an empty map.
+func loadAliases(sess *auth.Session) *alias.Map {
+	aliases, err := alias.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring alias map: %v\n", err)
+		aliases = &alias.Map{DIDs: make(map[string]alias.Entry)}
+	}
+	aliases.Set(sess.DID.String(), sess.Handle)
+	return aliases
+}
+
+// resolveHandleArgs replaces known handles given to actor flags with their
+// DIDs, so filters like `hb list --assignee alice.bsky.social` match the
+// DIDs recorded in DID actor mode
+func resolveHandleArgs(args []string, aliases *alias.Map) []string {
+	return inject.MapFlagValues(args, func(value string) string {
+		if did := aliases.DID(strings.TrimPrefix(value, "@")); did != "" {
+			return did
+		}
+		return value
+	}, "--actor", "--assignee", "-a")
+}
+
+// verifyIdentity runs verified-identity mode when enabled in the repo config.
+// Mutating commands are refused for an unverified identity; read-only
+// commands only warn.
+func verifyIdentity(ctx context.Context, cfg *config.Config, sess *auth.Session, args []string) error {
+	if !cfg.Verify.Enabled {
+		return nil
+	}
+
+	if _, err := auth.VerifyIdentity(ctx, sess, cfg.Verify.CacheTTL()); err != nil {
+		if inject.IsMutating(args) {
+			return fmt.Errorf("refusing hb %s: %w", args[0], err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
 	return nil
 }
 
+// explainIdentity describes verified-identity mode for a dry run from the
+// verification cache alone; nothing is checked online
+func explainIdentity(cfg *config.Config, sess *auth.Session) string {
+	if !cfg.Verify.Enabled {
+		return ""
+	}
+	if cached := auth.CachedIdentity(sess, cfg.Verify.CacheTTL()); cached != nil {
+		return "verified " + cached.VerifiedAt.Local().Format(time.DateTime)
+	}
+	return "not verified recently (checked online when the command runs)"
+}
+
 // ProxyAction is the unified action for all proxied bd commands.
 // It checks auth, builds args with assignee injection, and delegates to bd.
+// With the global --explain flag it explains the command instead of running it.
 func ProxyAction(ctx context.Context, cmd *cli.Command) error {
 	args := append([]string{cmd.Name}, cmd.Args().Slice()...)
+	return Run(ctx, cmd, args)
+}
+
+// Run executes args through bd, or explains them with the global
+// --explain flag
+func Run(ctx context.Context, cmd *cli.Command, args []string) error {
+	if cmd.Root().Bool("explain") {
+		return ExplainBd(ctx, cmd.Root().Writer, args)
+	}
 	return ExecBd(ctx, cmd.Root().Writer, args)
 }
 
+// defaultCommands are the bd commands proxied when bd's command tree cannot
+// be discovered (see DiscoverCommands)
+var defaultCommands = []BdCommand{
+	// Core workflow
+	{"init", "Initialize hb in the current directory"},
+	{"list", "List issues"},
+	{"ready", "Show issues ready to work (no blockers)"},
+	{"show", "Show issue details"},
+	{"create", "Create a new issue"},
+	{"update", "Update one or more issues"},
+	{"close", "Close one or more issues"},
+	{"search", "Search issues by text query"},
+	{"blocked", "Show blocked issues"},
+
+	// Dependencies
+	{"dep", "Manage dependencies"},
+
+	// Sync
+	{"sync", "Sync with git"},
+	{"export", "Export issues to JSONL"},
+	{"import", "Import issues from JSONL"},
+
+	// Setup
+	{"onboard", "Display minimal snippet for AGENTS.md"},
+	{"prime", "Output AI-optimized workflow context"},
+	{"quickstart", "Quick start guide"},
+	{"setup", "Setup integration with AI editors"},
+	{"config", "Manage configuration settings"},
+	{"info", "Show database and daemon information"},
+	{"status", "Show issue database overview"},
+	{"hooks", "Manage git hooks"},
+	{"doctor", "Check for issues"},
+
+	// Structure
+	{"epic", "Epic management commands"},
+	{"children", "List child beads of a parent"},
+	{"graph", "Display issue dependency graph"},
+	{"label", "Manage issue labels"},
+
+	// Other
+	{"delete", "Delete one or more issues"},
+	{"reopen", "Reopen closed issues"},
+	{"count", "Count issues matching filters"},
+	{"stale", "Show stale issues"},
+	{"q", "Quick capture: create issue and output only ID"},
+	{"rename", "Rename an issue ID"},
+	{"todo", "Manage TODO items"},
+}
+
 // BuildProxyCommands returns cli.Command entries for common bd commands.
 // Each command uses SkipFlagParsing=true so bd handles all flag parsing.
 func BuildProxyCommands() []*cli.Command {
-	commands := []struct {
-		name  string
-		usage string
-	}{
-		// Core workflow
-		{"init", "Initialize hb in the current directory"},
-		{"list", "List issues"},
-		{"ready", "Show issues ready to work (no blockers)"},
-		{"show", "Show issue details"},
-		{"create", "Create a new issue"},
-		{"update", "Update one or more issues"},
-		{"close", "Close one or more issues"},
-		{"search", "Search issues by text query"},
-		{"blocked", "Show blocked issues"},
-
-		// Dependencies
-		{"dep", "Manage dependencies"},
-
-		// Sync
-		{"sync", "Sync with git"},
-		{"export", "Export issues to JSONL"},
-		{"import", "Import issues from JSONL"},
-
-		// Setup
-		{"onboard", "Display minimal snippet for AGENTS.md"},
-		{"prime", "Output AI-optimized workflow context"},
-		{"quickstart", "Quick start guide"},
-		{"setup", "Setup integration with AI editors"},
-		{"config", "Manage configuration settings"},
-		{"info", "Show database and daemon information"},
-		{"status", "Show issue database overview"},
-		{"hooks", "Manage git hooks"},
-		{"doctor", "Check for issues"},
-
-		// Structure
-		{"epic", "Epic management commands"},
-		{"children", "List child beads of a parent"},
-		{"graph", "Display issue dependency graph"},
-		{"label", "Manage issue labels"},
-
-		// Other
-		{"delete", "Delete one or more issues"},
-		{"reopen", "Reopen closed issues"},
-		{"count", "Count issues matching filters"},
-		{"stale", "Show stale issues"},
-		{"q", "Quick capture: create issue and output only ID"},
-		{"rename", "Rename an issue ID"},
-		{"todo", "Manage TODO items"},
-	}
+	return buildCommands(defaultCommands, nil)
+}
 
+// buildCommands returns a proxy cli.Command for each bd command, skipping
+// the names in exclude
+func buildCommands(commands []BdCommand, exclude map[string]bool) []*cli.Command {
 	result := make([]*cli.Command, 0, len(commands))
 	for _, c := range commands {
+		if exclude[c.Name] {
+			continue
+		}
 		result = append(result, &cli.Command{
-			Name:            c.name,
-			Usage:           c.usage,
+			Name:            c.Name,
+			Usage:           c.Usage,
 			Action:          ProxyAction,
+			ShellComplete:   completeBd,
 			SkipFlagParsing: true,
 			HideHelpCommand: true,
 		})
@@ -1,7 +1,28 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/gainforest/heartbeads-cli/internal/alias"
+	"github.com/gainforest/heartbeads-cli/internal/audit"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+	"github.com/gainforest/heartbeads-cli/internal/config"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/gainforest/heartbeads-cli/internal/hooks"
 )
 
 func TestBuildProxyCommands(t *testing.T) {
@@ -31,3 +52,241 @@ func TestBuildProxyCommands(t *testing.T) {
 		}
 	}
 }
+
+// setupVerifiedRepo creates a beads repo with verified-identity mode enabled
+// and a session whose PDS is unreachable, so verification always fails.
+func setupVerifiedRepo(t *testing.T) *auth.Session {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatalf("failed to create .beads: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".beads", "hb.yaml"), []byte("verify:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write hb.yaml: %v", err)
+	}
+	t.Chdir(repo)
+
+	sess := &auth.Session{DID: syntax.DID("did:plc:stale"), Handle: "stale.test", PDS: "http://127.0.0.1:1"}
+	if err := auth.PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+	return sess
+}
+
+func TestVerifyIdentityRefusesMutating(t *testing.T) {
+	sess := setupVerifiedRepo(t)
+	cfg := &config.Config{Verify: config.VerifyConfig{Enabled: true}}
+
+	err := verifyIdentity(context.Background(), cfg, sess, []string{"close", "bd-1"})
+	if !errors.Is(err, auth.ErrIdentityUnverified) {
+		t.Fatalf("expected ErrIdentityUnverified for close, got %v", err)
+	}
+
+	if err := verifyIdentity(context.Background(), cfg, sess, []string{"list"}); err != nil {
+		t.Errorf("read-only commands should only warn, got %v", err)
+	}
+}
+
+func TestVerifyIdentityDisabled(t *testing.T) {
+	sess := &auth.Session{DID: syntax.DID("did:plc:any"), Handle: "any.test"}
+	if err := verifyIdentity(context.Background(), &config.Config{}, sess, []string{"close", "bd-1"}); err != nil {
+		t.Errorf("verification should be skipped without repo config, got %v", err)
+	}
+}
+
+func TestExplainUsesVerificationCache(t *testing.T) {
+	setupVerifiedRepo(t)
+	fakeBd(t, "exit 0\n")
+
+	// The PDS is unreachable: only the cache may be consulted
+	var out bytes.Buffer
+	if err := ExplainBd(context.Background(), &out, []string{"close", "bd-1", "--reason", "abc1234 fix: login"}); err != nil {
+		t.Fatalf("ExplainBd should not verify online, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Verify:  not verified recently") {
+		t.Errorf("explain should report the uncached verification:\n%s", out.String())
+	}
+}
+
+func TestResolveHandleArgs(t *testing.T) {
+	aliases := &alias.Map{DIDs: map[string]alias.Entry{
+		"did:plc:alice": {Handle: "alice.bsky.social", UpdatedAt: time.Now()},
+	}}
+
+	got := resolveHandleArgs([]string{"list", "--assignee", "@alice.bsky.social", "--actor=bob.test"}, aliases)
+	want := []string{"list", "--assignee", "did:plc:alice", "--actor=bob.test"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecBdHooks(t *testing.T) {
+	ran := setupLoggedIn(t)
+	hooksDir := filepath.Join(".beads", "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		t.Fatalf("failed to create hooks dir: %v", err)
+	}
+	payload := filepath.Join(t.TempDir(), "payload.json")
+	writeScript := func(name, script string) {
+		if err := os.WriteFile(filepath.Join(hooksDir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("failed to write hook: %v", err)
+		}
+	}
+	writeScript("pre-close", "exit 1\n")
+	writeScript("post-list", "cat > "+payload+"\n")
+
+	// Repo hooks only run once the user trusts the repo
+	var out bytes.Buffer
+	if err := ExplainBd(context.Background(), &out, []string{"close", "bd-1", "-r", "abc1234 done"}); err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "skipped: repo not trusted") {
+		t.Errorf("dry run should show the untrusted pre-close hook:\n%s", out.String())
+	}
+	if _, err := hooks.Trust("."); err != nil {
+		t.Fatalf("Trust failed: %v", err)
+	}
+
+	// A failing pre hook aborts before bd runs
+	err := ExecBd(context.Background(), &bytes.Buffer{}, []string{"close", "bd-1", "-r", "abc1234 done"})
+	if hberr.KindOf(err) != hberr.Hook {
+		t.Fatalf("expected a hook error, got %v", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("bd must not run after a failing pre hook")
+	}
+	entries, err := audit.Read(audit.Filter{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Read = %v, %v; want the aborted close", entries, err)
+	}
+	if e := entries[0]; e.Command != "close" || e.Decision != audit.DecisionAborted || e.ExitCode != 75 || !slices.Equal(e.Issues, []string{"bd-1"}) {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+
+	// Post hooks see bd's result
+	fakeBd(t, "echo 'bd-1 open'\necho 'note' >&2\nexit 3\n")
+	err = ExecBd(context.Background(), &bytes.Buffer{}, []string{"list"})
+	if hberr.ExitCode(err) != 3 {
+		t.Fatalf("expected bd's exit code 3, got %v", err)
+	}
+	data, err := os.ReadFile(payload)
+	if err != nil {
+		t.Fatalf("post hook did not run: %v", err)
+	}
+	// Dry runs list hooks without running them
+	out.Reset()
+	if err := ExplainBd(context.Background(), &out, []string{"close", "bd-1", "-r", "abc1234 done"}); err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Hooks:\n  pre  ") || !strings.Contains(out.String(), filepath.Join(hooksDir, "pre-close")) {
+		t.Errorf("dry run should list the pre-close hook:\n%s", out.String())
+	}
+
+	for _, want := range []string{`"hook":"post-list"`, `"actor":"alice.test"`, `"stdout":"bd-1 open\n"`, `"stderr":"note\n"`, `"exit_code":3`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("payload missing %s: %s", want, data)
+		}
+	}
+}
+
+func TestExecBdMissingAudited(t *testing.T) {
+	setupLoggedIn(t)
+	t.Setenv("PATH", t.TempDir())
+
+	err := ExecBd(context.Background(), &bytes.Buffer{}, []string{"update", "bd-1", "--status", "closed"})
+	if hberr.KindOf(err) != hberr.BdMissing {
+		t.Fatalf("expected a missing bd error, got %v", err)
+	}
+	entries, err := audit.Read(audit.Filter{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Read = %v, %v; want the failed update", entries, err)
+	}
+	e := entries[0]
+	if e.Command != "update" || e.Decision != audit.DecisionFailed || e.ExitCode != 127 {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+	if !strings.Contains(e.Reason, "bd binary not found") {
+		t.Errorf("reason should say why bd did not run, got %q", e.Reason)
+	}
+}
+
+func TestExecBdCloseComment(t *testing.T) {
+	setupLoggedIn(t)
+	t.Setenv("CLAUDE_SESSION_ID", "sess-1")
+	if err := os.MkdirAll(".beads", 0755); err != nil {
+		t.Fatalf("failed to create .beads: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".beads", "hb.yaml"), []byte("close_comment:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("failed to write hb.yaml: %v", err)
+	}
+	args := []string{"close", "bd-1", "-r", "abc1234 fix: login"}
+	wantText := "Closed: abc1234 fix: login\nCommit: abc1234\nSession: sess-1"
+
+	// An unreachable PDS queues the comment; the close still succeeds
+	if err := ExecBd(context.Background(), &bytes.Buffer{}, args); err != nil {
+		t.Fatalf("ExecBd failed: %v", err)
+	}
+	queued, err := comments.Queued()
+	if err != nil || len(queued) != 1 {
+		t.Fatalf("Queued = %v, %v; want one comment", queued, err)
+	}
+	if got := queued[0].Input; got.BeadsID != "bd-1" || got.Text != wantText {
+		t.Errorf("unexpected queued comment: %+v", got)
+	}
+
+	// The next close flushes the queue before posting its own comment
+	var posted, runtimes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.getSession":
+			json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:alice", "handle": "alice.test"})
+		case "/xrpc/com.atproto.repo.putRecord":
+			var req struct {
+				Record struct {
+					Subject struct{ URI string }
+					Text    string
+					Agent   struct{ Runtime string }
+				}
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			posted = append(posted, req.Record.Subject.URI+" "+req.Record.Text)
+			runtimes = append(runtimes, req.Record.Agent.Runtime)
+			json.NewEncoder(w).Encode(map[string]string{"uri": "at://did:plc:alice/org.impactindexer.review.comment/1", "cid": "bafy"})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	sess := &auth.Session{DID: syntax.DID("did:plc:alice"), Handle: "alice.test", PDS: srv.URL, AccessToken: "access"}
+	if err := auth.PersistSession(sess); err != nil {
+		t.Fatalf("PersistSession failed: %v", err)
+	}
+
+	if err := ExecBd(context.Background(), &bytes.Buffer{}, []string{"close", "bd-2", "-r", "abc1234 fix: login"}); err != nil {
+		t.Fatalf("ExecBd failed: %v", err)
+	}
+	want := []string{"beads:bd-1 " + wantText, "beads:bd-2 " + wantText}
+	if !slices.Equal(posted, want) {
+		t.Errorf("posted =\n%q\nwant\n%q", posted, want)
+	}
+	if !slices.Equal(runtimes, []string{"claude-code", "claude-code"}) {
+		t.Errorf("comments should record the agent runtime, got %q", runtimes)
+	}
+	if queued, _ := comments.Queued(); len(queued) != 0 {
+		t.Errorf("queue should be empty, got %+v", queued)
+	}
+
+	// Dry runs show the comment
+	var out bytes.Buffer
+	if err := ExplainBd(context.Background(), &out, args); err != nil {
+		t.Fatalf("ExplainBd failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Comment:\n  Closed: abc1234 fix: login\n  Commit: abc1234\n  Session: sess-1\n") {
+		t.Errorf("dry run should show the comment:\n%s", out.String())
+	}
+}
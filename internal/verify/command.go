@@ -0,0 +1,169 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/gainforest/heartbeads-cli/internal/auth"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+	"github.com/gainforest/heartbeads-cli/internal/hberr"
+	"github.com/urfave/cli/v3"
+)
+
+// Record sources
+const (
+	SourceIndexer = "indexer"
+	SourcePDS     = "pds"
+)
+
+// CmdVerify is the "verify" command
+var CmdVerify = &cli.Command{
+	Name:      "verify",
+	Usage:     "Audit issue authorship against ATProto records",
+	ArgsUsage: "[issue-id...]",
+	Description: `Check that the actors recorded in the beads database really acted.
+
+Every issue's created_by and closed_by actor is matched against records in
+that actor's ATProto repo: an org.impactindexer.beads.action attestation
+(see attest in .beads/hb.yaml) or, failing that, a comment on the issue.
+Claims without a matching record are reported, and hb exits non-zero.
+A close attestation for an issue ID other than the database's is reported
+as mismatch. When the issue has been edited since it was closed, its hash
+differs from the close attestation's: the claim still verifies, and is
+listed as modified.
+
+Records are read from the Hypergoat indexer by default, or directly from
+each actor's PDS with --source pds. No login required.
+
+Examples:
+  hb verify                           Audit the whole database (bd export)
+  hb verify bd-a1b2 bd-c3d4           Audit specific issues
+  hb verify --file issues.jsonl       Audit an exported JSONL file
+  hb verify --json                    Machine-readable report for CI
+  hb verify --require-attestation     Comments alone do not count`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the full report as JSON",
+		},
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "Read issues from an exported JSONL file instead of bd",
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "Where to read records from: indexer or pds",
+			Value: SourceIndexer,
+		},
+		&cli.StringFlag{
+			Name:    "indexer-url",
+			Usage:   "Hypergoat indexer URL",
+			Value:   comments.DefaultIndexerURL,
+			Sources: cli.EnvVars("INDEXER_URL"),
+		},
+		&cli.BoolFlag{
+			Name:  "require-attestation",
+			Usage: "Only accept action attestations, not comment trails",
+		},
+	},
+	Action: runVerify,
+}
+
+func runVerify(ctx context.Context, cmd *cli.Command) error {
+	source := cmd.String("source")
+	if source != SourceIndexer && source != SourcePDS {
+		return hberr.Errorf(hberr.Usage, "invalid --source %q (want %s or %s)", source, SourceIndexer, SourcePDS)
+	}
+
+	issues, err := LoadIssues(ctx, cmd.String("file"), cmd.Args().Slice())
+	if err != nil {
+		return fmt.Errorf("failed to load issues: %w", err)
+	}
+
+	claims := Claims(issues)
+	dir := auth.ConfigDirectory()
+	purgeActors(ctx, dir, claims)
+	dids := ResolveActors(ctx, dir, claims)
+
+	unique := make(map[string]bool)
+	for _, did := range dids {
+		unique[did] = true
+	}
+	didList := make([]string, 0, len(unique))
+	for did := range unique {
+		didList = append(didList, did)
+	}
+	sort.Strings(didList)
+
+	var records []comments.IndexerRecord
+	if len(didList) > 0 {
+		if source == SourcePDS {
+			records, err = FetchPDSRecords(ctx, dir, didList)
+		} else {
+			records, err = FetchIndexerRecords(ctx, cmd.String("indexer-url"), didList)
+		}
+		if err != nil {
+			return hberr.Errorf(hberr.Unavailable, "failed to fetch records: %w", err)
+		}
+	}
+
+	report := Check(claims, dids, records, cmd.Bool("require-attestation"))
+
+	w := cmd.Root().Writer
+	if cmd.Bool("json") {
+		if err := FormatJSON(w, report); err != nil {
+			return err
+		}
+	} else {
+		FormatText(w, report)
+	}
+
+	if report.Unverified > 0 {
+		return fmt.Errorf("%d of %d authorship claims unverified", report.Unverified, len(report.Claims))
+	}
+	return nil
+}
+
+// purgeActors drops cached resolutions of every actor of claims, so
+// verification never accepts a handle or PDS from a stale identity cache
+func purgeActors(ctx context.Context, dir identity.Directory, claims []Claim) {
+	seen := make(map[string]bool)
+	for _, c := range claims {
+		if seen[c.Actor] {
+			continue
+		}
+		seen[c.Actor] = true
+		if atid, err := syntax.ParseAtIdentifier(strings.TrimPrefix(c.Actor, "@")); err == nil {
+			_ = dir.Purge(ctx, atid)
+		}
+	}
+}
+
+// FormatJSON writes the report as indented JSON
+func FormatJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// FormatText writes the unverified claims, the closes of issues modified
+// since, and a summary line
+func FormatText(w io.Writer, report *Report) {
+	for _, c := range report.Claims {
+		if c.Verified && c.Status != StatusModified {
+			continue
+		}
+		fmt.Fprintf(w, "%-16s %-8s %-32s %s\n", c.IssueID, c.Role, c.Actor, c.Status)
+	}
+	if len(report.Claims) == 0 {
+		fmt.Fprintln(w, "No authorship claims to verify")
+		return
+	}
+	fmt.Fprintf(w, "%d of %d authorship claims verified\n", report.Verified, len(report.Claims))
+}
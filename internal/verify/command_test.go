@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+)
+
+func runVerifyCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := &cli.Command{Name: "hb", Writer: &out, ErrWriter: &out, Commands: []*cli.Command{CmdVerify}}
+	err := root.Run(context.Background(), append([]string{"hb", "verify"}, args...))
+	return out.String(), err
+}
+
+func TestCmdVerify(t *testing.T) {
+	srv := mockIndexer(t, []comments.IndexerRecord{
+		record(attest.ActionCollection, "did:plc:alice", "bd-1", "create"),
+	})
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "issues.jsonl")
+	data := `{"id":"bd-1","created_by":"did:plc:alice"}
+{"id":"bd-2","created_by":"did:plc:mallory"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	out, err := runVerifyCommand(t, "--file", path, "--indexer-url", srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected unverified error, got %v", err)
+	}
+	if !strings.Contains(out, "bd-2") || strings.Contains(out, "bd-1 ") {
+		t.Errorf("expected only bd-2 to be reported, got:\n%s", out)
+	}
+
+	out, _ = runVerifyCommand(t, "--file", path, "--indexer-url", srv.URL, "--json")
+	var report Report
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if len(report.Claims) != 2 || report.Verified != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestCmdVerifyInvalidSource(t *testing.T) {
+	if _, err := runVerifyCommand(t, "--source", "carrier-pigeon"); err == nil {
+		t.Error("expected error for invalid source")
+	}
+}
@@ -0,0 +1,215 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+	"github.com/gainforest/heartbeads-cli/internal/executor"
+)
+
+// evidenceCollections are the record collections that back authorship claims
+var evidenceCollections = []string{attest.ActionCollection, comments.CommentCollection}
+
+// LoadIssues reads issues from an exported JSONL file if path is set,
+// otherwise from bd: `bd show <ids> --json` for the given IDs, or
+// `bd export` for the whole database. Issues read from bd carry the hash
+// of their `bd show --json` form when they are closed, so close
+// attestations can be checked against it; a file gives no hashes.
+func LoadIssues(ctx context.Context, path string, ids []string) ([]Issue, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseIssues(data)
+	}
+
+	args := []string{"export"}
+	if len(ids) > 0 {
+		args = showArgs(ids)
+	}
+	stdout, err := runBd(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	issues, err := ParseIssues(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	var closed []string
+	for _, issue := range issues {
+		if issue.ClosedBy != "" {
+			closed = append(closed, issue.ID)
+		}
+	}
+	if len(closed) == 0 {
+		return issues, nil
+	}
+	shown := stdout
+	if len(ids) == 0 {
+		if shown, err = runBd(ctx, showArgs(closed)); err != nil {
+			return nil, err
+		}
+	}
+	hashes, err := issueHashes(shown)
+	if err != nil {
+		return nil, err
+	}
+	for i := range issues {
+		if issues[i].ClosedBy != "" {
+			issues[i].Hash = hashes[issues[i].ID]
+		}
+	}
+	return issues, nil
+}
+
+func showArgs(ids []string) []string {
+	return append(append([]string{"show"}, ids...), "--json")
+}
+
+// runBd runs a read-only bd command and returns its stdout
+func runBd(ctx context.Context, args []string) ([]byte, error) {
+	stdout, stderr, exitCode, err := executor.RunBd(ctx, args, "")
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("hb %s failed with exit code %d: %s", args[0], exitCode, strings.TrimSpace(string(stderr)))
+	}
+	return stdout, nil
+}
+
+// issueHashes maps issue IDs to the attest.IssueHash of each issue in
+// `bd show --json` output, the form attestations hash
+func issueHashes(data []byte) (map[string]string, error) {
+	var shown []json.RawMessage
+	if err := json.Unmarshal(data, &shown); err != nil {
+		return nil, fmt.Errorf("failed to parse issues: %w", err)
+	}
+	hashes := make(map[string]string, len(shown))
+	for _, raw := range shown {
+		var issue struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			return nil, fmt.Errorf("failed to parse issues: %w", err)
+		}
+		hash, err := attest.IssueHash(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash issue %s: %w", issue.ID, err)
+		}
+		hashes[issue.ID] = hash
+	}
+	return hashes, nil
+}
+
+// FetchIndexerRecords fetches attestations and comments of the given DIDs
+// from the Hypergoat indexer, filtered by DID on the indexer
+func FetchIndexerRecords(ctx context.Context, indexerURL string, dids []string) ([]comments.IndexerRecord, error) {
+	var records []comments.IndexerRecord
+	for _, collection := range evidenceCollections {
+		for _, did := range dids {
+			recs, err := comments.FetchRecordsByDID(ctx, indexerURL, collection, did)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch %s records of %s: %w", collection, did, err)
+			}
+			// Guard against an indexer that ignores the filter
+			for _, r := range recs {
+				if r.DID == did {
+					records = append(records, r)
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// listRecordsOutput is the response of com.atproto.repo.listRecords with
+// record values kept as plain JSON
+type listRecordsOutput struct {
+	Cursor  *string `json:"cursor"`
+	Records []struct {
+		URI   string                 `json:"uri"`
+		CID   string                 `json:"cid"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"records"`
+}
+
+// FetchPDSRecords fetches attestations and comments directly from each
+// DID's PDS, bypassing the indexer
+func FetchPDSRecords(ctx context.Context, dir identity.Directory, dids []string) ([]comments.IndexerRecord, error) {
+	var records []comments.IndexerRecord
+	for _, did := range dids {
+		parsed, err := syntax.ParseDID(did)
+		if err != nil {
+			continue
+		}
+		ident, err := dir.LookupDID(ctx, parsed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", did, err)
+		}
+		pds := ident.PDSEndpoint()
+		if pds == "" {
+			return nil, fmt.Errorf("%s has no PDS", did)
+		}
+
+		client := atclient.NewAPIClient(pds)
+		for _, collection := range evidenceCollections {
+			fetched, err := listRecords(ctx, client, did, collection)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s records of %s: %w", collection, did, err)
+			}
+			records = append(records, fetched...)
+		}
+	}
+	return records, nil
+}
+
+// listRecords pages through a whole collection of one repo. Every record is
+// read, since a record left unseen would be reported as missing.
+func listRecords(ctx context.Context, client *atclient.APIClient, did, collection string) ([]comments.IndexerRecord, error) {
+	var records []comments.IndexerRecord
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		params := map[string]any{"repo": did, "collection": collection, "limit": 100}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var out listRecordsOutput
+		if err := client.Get(ctx, syntax.NSID("com.atproto.repo.listRecords"), params, &out); err != nil {
+			return nil, err
+		}
+		for _, r := range out.Records {
+			rkey := r.URI[strings.LastIndex(r.URI, "/")+1:]
+			records = append(records, comments.IndexerRecord{
+				CID:        r.CID,
+				Collection: collection,
+				DID:        did,
+				RKey:       rkey,
+				URI:        r.URI,
+				Value:      r.Value,
+			})
+		}
+
+		if out.Cursor == nil || *out.Cursor == "" || len(out.Records) == 0 {
+			return records, nil
+		}
+		if seen[*out.Cursor] {
+			return nil, fmt.Errorf("PDS repeated listRecords cursor %q", *out.Cursor)
+		}
+		seen[*out.Cursor] = true
+		cursor = *out.Cursor
+	}
+}
@@ -0,0 +1,190 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+)
+
+// mockIndexer serves one page of records per collection and DID. Requests
+// without a DID filter fail, so callers must not page whole collections.
+func mockIndexer(t *testing.T, records []comments.IndexerRecord) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		did, _ := req.Variables["did"].(string)
+		if did == "" || !strings.Contains(req.Query, "did: $did") {
+			t.Errorf("indexer query without a DID filter: %v", req.Variables)
+		}
+
+		var edges []map[string]interface{}
+		for _, rec := range records {
+			if rec.Collection == req.Variables["collection"] && rec.DID == did {
+				edges = append(edges, map[string]interface{}{"node": rec})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"records": map[string]interface{}{
+					"edges":    edges,
+					"pageInfo": map[string]interface{}{"hasNextPage": false},
+				},
+			},
+		})
+	}))
+}
+
+func TestFetchIndexerRecords(t *testing.T) {
+	srv := mockIndexer(t, []comments.IndexerRecord{
+		record(attest.ActionCollection, "did:plc:alice", "bd-1", "create"),
+		record(attest.ActionCollection, "did:plc:other", "bd-1", "create"),
+		record(comments.CommentCollection, "did:plc:alice", "bd-2", ""),
+	})
+	defer srv.Close()
+
+	records, err := FetchIndexerRecords(context.Background(), srv.URL, []string{"did:plc:alice"})
+	if err != nil {
+		t.Fatalf("FetchIndexerRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 records of did:plc:alice, got %d", len(records))
+	}
+}
+
+func TestFetchPDSRecords(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.listRecords" || r.URL.Query().Get("repo") != "did:plc:alice" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		collection := r.URL.Query().Get("collection")
+		w.Header().Set("Content-Type", "application/json")
+
+		// Two pages of actions, no comments
+		var out map[string]interface{}
+		switch {
+		case collection != attest.ActionCollection:
+			out = map[string]interface{}{"records": []interface{}{}}
+		case r.URL.Query().Get("cursor") == "":
+			out = map[string]interface{}{
+				"cursor":  "next",
+				"records": []interface{}{map[string]interface{}{"uri": "at://did:plc:alice/" + collection + "/1", "cid": "c1", "value": map[string]interface{}{"operation": "create"}}},
+			}
+		default:
+			out = map[string]interface{}{
+				"records": []interface{}{map[string]interface{}{"uri": "at://did:plc:alice/" + collection + "/2", "cid": "c2", "value": map[string]interface{}{"operation": "close"}}},
+			}
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:alice"),
+		Handle: syntax.Handle("alice.example.com"),
+		Services: map[string]identity.ServiceEndpoint{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: srv.URL},
+		},
+	})
+
+	records, err := FetchPDSRecords(context.Background(), dir, []string{"did:plc:alice"})
+	if err != nil {
+		t.Fatalf("FetchPDSRecords failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records across pages, got %d", len(records))
+	}
+	if records[1].RKey != "2" || records[1].DID != "did:plc:alice" || records[1].Collection != attest.ActionCollection {
+		t.Errorf("unexpected record: %+v", records[1])
+	}
+}
+
+func TestListRecordsReadsAllPages(t *testing.T) {
+	const pages = 25
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		out := map[string]interface{}{
+			"records": []interface{}{map[string]interface{}{"uri": fmt.Sprintf("at://did:plc:alice/%s/%d", attest.ActionCollection, page), "value": map[string]interface{}{}}},
+		}
+		if page+1 < pages {
+			out["cursor"] = strconv.Itoa(page + 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	records, err := listRecords(context.Background(), atclient.NewAPIClient(srv.URL), "did:plc:alice", attest.ActionCollection)
+	if err != nil {
+		t.Fatalf("listRecords failed: %v", err)
+	}
+	if len(records) != pages {
+		t.Errorf("expected %d records, got %d", pages, len(records))
+	}
+}
+
+func TestListRecordsRepeatedCursor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"cursor":  "same",
+			"records": []interface{}{map[string]interface{}{"uri": "at://did:plc:alice/" + attest.ActionCollection + "/1", "value": map[string]interface{}{}}},
+		})
+	}))
+	defer srv.Close()
+
+	if _, err := listRecords(context.Background(), atclient.NewAPIClient(srv.URL), "did:plc:alice", attest.ActionCollection); err == nil {
+		t.Error("expected an error for a repeated cursor")
+	}
+}
+
+func TestLoadIssuesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issues.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":"bd-1","created_by":"did:plc:alice"}`+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	issues, err := LoadIssues(context.Background(), path, nil)
+	if err != nil {
+		t.Fatalf("LoadIssues failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].CreatedBy != "did:plc:alice" {
+		t.Errorf("unexpected issues: %+v", issues)
+	}
+}
+
+func TestIssueHashes(t *testing.T) {
+	shown := []byte(`[{"id":"bd-1","status":"closed","closed_by":"alice"},{"id":"bd-2","status":"closed"}]`)
+	hashes, err := issueHashes(shown)
+	if err != nil {
+		t.Fatalf("issueHashes failed: %v", err)
+	}
+	// Same hash as the attestation of `bd show bd-1 --json`
+	want, _ := attest.IssueHash([]byte(`[{"closed_by":"alice","id":"bd-1","status":"closed"}]`))
+	if hashes["bd-1"] != want {
+		t.Errorf("hash of bd-1 = %q, want %q", hashes["bd-1"], want)
+	}
+	if len(hashes) != 2 || hashes["bd-2"] == hashes["bd-1"] {
+		t.Errorf("unexpected hashes: %v", hashes)
+	}
+}
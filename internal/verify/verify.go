@@ -0,0 +1,256 @@
+// Package verify audits issue authorship in the beads database against
+// records in the claimed actors' ATProto repos.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+)
+
+// Roles of an actor in an issue's history
+const (
+	RoleCreator = "creator"
+	RoleCloser  = "closer"
+)
+
+// Claim statuses
+const (
+	// StatusAttested means a matching action attestation exists
+	StatusAttested = "attested"
+	// StatusCommented means the actor has only a comment trail on the issue
+	StatusCommented = "commented"
+	// StatusMissing means the actor has no record about the issue
+	StatusMissing = "missing"
+	// StatusUnresolved means the claimed actor is not a resolvable handle or DID
+	StatusUnresolved = "unresolved"
+	// StatusMismatch means the actor attested the operation, but for a
+	// different issue ID than the database shows
+	StatusMismatch = "mismatch"
+	// StatusModified means the actor attested closing the issue, and the
+	// issue has changed since: its hash differs from the close attestation's
+	StatusModified = "modified"
+)
+
+// Issue is the subset of a bd issue relevant to authorship
+type Issue struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	CreatedBy string `json:"created_by"`
+	ClosedBy  string `json:"closed_by"`
+	// Hash is the attest.IssueHash of the issue as printed by `bd show
+	// --json`, or "" when unknown
+	Hash string `json:"-"`
+}
+
+// Claim is an actor's claimed role in an issue, with its verification status
+type Claim struct {
+	IssueID string `json:"issue_id"`
+	Role    string `json:"role"`
+	Actor   string `json:"actor"`
+	DID     string `json:"did,omitempty"`
+	Status  string `json:"status"`
+	// Verified is true if the status counts as proof of the claim
+	Verified bool `json:"verified"`
+	// Evidence is the AT-URI of the matching record, if any
+	Evidence string `json:"evidence,omitempty"`
+	// IssueHash is the current hash of a closed issue, compared with the
+	// issueHash of close attestations to detect later edits ("" skips the
+	// comparison)
+	IssueHash string `json:"-"`
+}
+
+// Report is the result of an authorship audit
+type Report struct {
+	Claims     []Claim `json:"claims"`
+	Verified   int     `json:"verified"`
+	Unverified int     `json:"unverified"`
+}
+
+// ParseIssues decodes bd issues from `bd show --json` (a JSON array) or
+// `bd export` (JSONL) output
+func ParseIssues(data []byte) ([]Issue, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	if trimmed[0] == '[' {
+		var issues []Issue
+		if err := json.Unmarshal(trimmed, &issues); err != nil {
+			return nil, fmt.Errorf("failed to parse issues: %w", err)
+		}
+		return issues, nil
+	}
+
+	var issues []Issue
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var issue Issue
+		err := dec.Decode(&issue)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issues: %w", err)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// Claims lists the authorship claims made by issues: the creator of every
+// issue and the closer of closed issues that record one
+func Claims(issues []Issue) []Claim {
+	var claims []Claim
+	for _, issue := range issues {
+		if issue.CreatedBy != "" {
+			claims = append(claims, Claim{IssueID: issue.ID, Role: RoleCreator, Actor: issue.CreatedBy})
+		}
+		if issue.ClosedBy != "" {
+			claims = append(claims, Claim{IssueID: issue.ID, Role: RoleCloser, Actor: issue.ClosedBy, IssueHash: issue.Hash})
+		}
+	}
+	return claims
+}
+
+// ResolveActors maps each distinct actor of claims to its DID. Actors are
+// DIDs (DID actor mode) or handles; unresolvable actors are left out.
+func ResolveActors(ctx context.Context, dir identity.Directory, claims []Claim) map[string]string {
+	dids := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, c := range claims {
+		if seen[c.Actor] {
+			continue
+		}
+		seen[c.Actor] = true
+
+		actor := strings.TrimPrefix(c.Actor, "@")
+		if did, err := syntax.ParseDID(actor); err == nil {
+			dids[c.Actor] = did.String()
+			continue
+		}
+		handle, err := syntax.ParseHandle(actor)
+		if err != nil {
+			continue
+		}
+		ident, err := dir.LookupHandle(ctx, handle)
+		if err != nil {
+			continue
+		}
+		dids[c.Actor] = ident.DID.String()
+	}
+	return dids
+}
+
+// Check sets the status of each claim from the actors' records.
+// dids maps actors to DIDs (see ResolveActors); records are action
+// attestations and comments from any of the actors' repos.
+// With requireAttestation, a comment trail alone does not verify a claim.
+func Check(claims []Claim, dids map[string]string, records []comments.IndexerRecord, requireAttestation bool) *Report {
+	// Index evidence by DID and issue
+	type key struct{ did, issueID string }
+	actions := make(map[key][]comments.IndexerRecord)
+	trails := make(map[key]string)
+	for _, r := range records {
+		issueID, ok := subjectIssue(r)
+		if !ok {
+			continue
+		}
+		k := key{r.DID, issueID}
+		switch r.Collection {
+		case attest.ActionCollection:
+			actions[k] = append(actions[k], r)
+		case comments.CommentCollection:
+			if _, exists := trails[k]; !exists {
+				trails[k] = r.URI
+			}
+		}
+	}
+
+	report := &Report{Claims: make([]Claim, 0, len(claims))}
+	for _, c := range claims {
+		if did, ok := dids[c.Actor]; !ok {
+			c.Status = StatusUnresolved
+		} else {
+			c.DID = did
+			k := key{did, c.IssueID}
+			if uri, status := matchingAction(actions[k], c); uri != "" {
+				c.Status, c.Evidence = status, uri
+			} else if uri, found := trails[k]; found {
+				c.Status, c.Evidence = StatusCommented, uri
+			} else {
+				c.Status = StatusMissing
+			}
+		}
+
+		// An edit after the close does not make the close any less genuine
+		c.Verified = c.Status == StatusAttested || c.Status == StatusModified || (c.Status == StatusCommented && !requireAttestation)
+		if c.Verified {
+			report.Verified++
+		} else {
+			report.Unverified++
+		}
+		report.Claims = append(report.Claims, c)
+	}
+	return report
+}
+
+// roleOperations are the attested operations that back each role
+var roleOperations = map[string]string{
+	RoleCreator: "create",
+	RoleCloser:  "close",
+}
+
+// matchingAction finds an attestation of the operation backing c's role
+// and returns its URI with the claim status it supports: StatusAttested
+// for a record agreeing with c's issue ID and, when both are known, issue
+// hash; StatusModified for one whose hash differs from the current issue;
+// StatusMismatch for one naming another issue. The best match wins; uri is
+// "" without any record of the operation.
+func matchingAction(records []comments.IndexerRecord, c Claim) (uri, status string) {
+	rank := map[string]int{"": 0, StatusMismatch: 1, StatusModified: 2}
+	for _, r := range records {
+		if op, _ := r.Value["operation"].(string); op != roleOperations[c.Role] {
+			continue
+		}
+		issueID, _ := r.Value["issueId"].(string)
+		hash, _ := r.Value["issueHash"].(string)
+		found := StatusAttested
+		switch {
+		case issueID != "" && issueID != c.IssueID:
+			found = StatusMismatch
+		case hash != "" && c.IssueHash != "" && hash != c.IssueHash:
+			found = StatusModified
+		}
+		if found == StatusAttested {
+			return r.URI, found
+		}
+		if rank[found] > rank[status] {
+			uri, status = r.URI, found
+		}
+	}
+	return uri, status
+}
+
+// subjectIssue returns the beads issue ID a record is about
+func subjectIssue(r comments.IndexerRecord) (string, bool) {
+	subject, ok := r.Value["subject"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	uri, _ := subject["uri"].(string)
+	if !strings.HasPrefix(uri, attest.BeadsURIPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, attest.BeadsURIPrefix), true
+}
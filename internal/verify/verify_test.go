@@ -0,0 +1,217 @@
+package verify
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/gainforest/heartbeads-cli/internal/attest"
+	"github.com/gainforest/heartbeads-cli/internal/comments"
+)
+
+func record(collection, did, issueID, operation string) comments.IndexerRecord {
+	value := map[string]interface{}{
+		"subject": map[string]interface{}{"uri": "beads:" + issueID, "type": "record"},
+	}
+	if operation != "" {
+		value["operation"] = operation
+	}
+	return comments.IndexerRecord{
+		Collection: collection,
+		DID:        did,
+		URI:        "at://" + did + "/" + collection + "/" + issueID + operation,
+		Value:      value,
+	}
+}
+
+func TestParseIssues(t *testing.T) {
+	jsonl := `{"id":"bd-1","created_by":"alice.test"}
+{"id":"bd-2","created_by":"bob.test","closed_by":"alice.test"}
+`
+	issues, err := ParseIssues([]byte(jsonl))
+	if err != nil {
+		t.Fatalf("ParseIssues(jsonl) failed: %v", err)
+	}
+	if len(issues) != 2 || issues[1].ClosedBy != "alice.test" {
+		t.Errorf("unexpected issues: %+v", issues)
+	}
+
+	issues, err = ParseIssues([]byte(`[{"id":"bd-1","created_by":"alice.test"}]`))
+	if err != nil {
+		t.Fatalf("ParseIssues(array) failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].ID != "bd-1" {
+		t.Errorf("unexpected issues: %+v", issues)
+	}
+
+	if _, err := ParseIssues([]byte("{not json")); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims([]Issue{
+		{ID: "bd-1", CreatedBy: "alice.test"},
+		{ID: "bd-2", CreatedBy: "bob.test", ClosedBy: "alice.test"},
+		{ID: "bd-3"},
+	})
+	if len(claims) != 3 {
+		t.Fatalf("expected 3 claims, got %d: %+v", len(claims), claims)
+	}
+	if claims[2].Role != RoleCloser || claims[2].IssueID != "bd-2" {
+		t.Errorf("unexpected closer claim: %+v", claims[2])
+	}
+}
+
+// purgeRecorder records the identifiers purged from a directory
+type purgeRecorder struct {
+	identity.Directory
+	purged []string
+}
+
+func (p *purgeRecorder) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	p.purged = append(p.purged, atid.String())
+	return nil
+}
+
+func TestPurgeActors(t *testing.T) {
+	dir := &purgeRecorder{Directory: identity.NewMockDirectory()}
+	purgeActors(context.Background(), dir, []Claim{
+		{Actor: "alice.example.com"},
+		{Actor: "alice.example.com"},
+		{Actor: "@bob.example.com"},
+		{Actor: "did:plc:carol"},
+		{Actor: "not a handle"},
+	})
+
+	want := []string{"alice.example.com", "bob.example.com", "did:plc:carol"}
+	if len(dir.purged) != len(want) {
+		t.Fatalf("purged %v, want %v", dir.purged, want)
+	}
+	for i := range want {
+		if dir.purged[i] != want[i] {
+			t.Errorf("purged %v, want %v", dir.purged, want)
+		}
+	}
+}
+
+func TestResolveActors(t *testing.T) {
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:alice"), Handle: syntax.Handle("alice.example.com")})
+
+	dids := ResolveActors(context.Background(), dir, []Claim{
+		{Actor: "alice.example.com"},
+		{Actor: "@alice.example.com"},
+		{Actor: "did:plc:bob"},
+		{Actor: "unknown.example.com"},
+		{Actor: "not a handle"},
+	})
+
+	if dids["alice.example.com"] != "did:plc:alice" || dids["@alice.example.com"] != "did:plc:alice" {
+		t.Errorf("handle not resolved: %v", dids)
+	}
+	if dids["did:plc:bob"] != "did:plc:bob" {
+		t.Errorf("DID actor should map to itself: %v", dids)
+	}
+	if _, ok := dids["unknown.example.com"]; ok {
+		t.Error("unknown handle should be unresolved")
+	}
+	if _, ok := dids["not a handle"]; ok {
+		t.Error("invalid actor should be unresolved")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	claims := []Claim{
+		{IssueID: "bd-1", Role: RoleCreator, Actor: "alice"},
+		{IssueID: "bd-1", Role: RoleCloser, Actor: "alice"},
+		{IssueID: "bd-2", Role: RoleCreator, Actor: "bob"},
+		{IssueID: "bd-3", Role: RoleCreator, Actor: "alice"},
+		{IssueID: "bd-4", Role: RoleCreator, Actor: "mallory"},
+	}
+	dids := map[string]string{"alice": "did:plc:alice", "bob": "did:plc:bob"}
+	records := []comments.IndexerRecord{
+		record(attest.ActionCollection, "did:plc:alice", "bd-1", "create"),
+		record(comments.CommentCollection, "did:plc:bob", "bd-2", ""),
+		// Alice's attestation for bd-3 is not evidence for Bob, and vice versa
+		record(attest.ActionCollection, "did:plc:bob", "bd-3", "create"),
+	}
+
+	report := Check(claims, dids, records, false)
+	want := []string{StatusAttested, StatusMissing, StatusCommented, StatusMissing, StatusUnresolved}
+	for i, c := range report.Claims {
+		if c.Status != want[i] {
+			t.Errorf("claim %d (%s %s): status %s, want %s", i, c.IssueID, c.Role, c.Status, want[i])
+		}
+	}
+	if report.Verified != 2 || report.Unverified != 3 {
+		t.Errorf("summary = %d verified / %d unverified", report.Verified, report.Unverified)
+	}
+	if report.Claims[0].Evidence == "" {
+		t.Error("attested claim should carry evidence")
+	}
+
+	strict := Check(claims, dids, records, true)
+	if strict.Verified != 1 {
+		t.Errorf("with requireAttestation, comment trails must not count (verified = %d)", strict.Verified)
+	}
+}
+
+func TestCheckMatchesIssueAndHash(t *testing.T) {
+	closed := func(issueID, hash string) comments.IndexerRecord {
+		r := record(attest.ActionCollection, "did:plc:alice", "bd-1", "close")
+		r.Value["issueId"] = issueID
+		if hash != "" {
+			r.Value["issueHash"] = hash
+		}
+		return r
+	}
+	dids := map[string]string{"alice": "did:plc:alice"}
+	tests := []struct {
+		name      string
+		issueHash string
+		record    comments.IndexerRecord
+		want      string
+	}{
+		{"same hash", "sha256:aa", closed("bd-1", "sha256:aa"), StatusAttested},
+		{"different hash", "sha256:aa", closed("bd-1", "sha256:bb"), StatusModified},
+		{"no recorded hash", "sha256:aa", closed("bd-1", ""), StatusAttested},
+		{"no current hash", "", closed("bd-1", "sha256:bb"), StatusAttested},
+		{"different issue", "", closed("bd-2", ""), StatusMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := []Claim{{IssueID: "bd-1", Role: RoleCloser, Actor: "alice", IssueHash: tt.issueHash}}
+			report := Check(claims, dids, []comments.IndexerRecord{tt.record}, false)
+			c := report.Claims[0]
+			if c.Status != tt.want {
+				t.Errorf("status %s, want %s", c.Status, tt.want)
+			}
+			if c.Verified != (tt.want != StatusMismatch) || c.Evidence == "" {
+				t.Errorf("verified = %v, evidence = %q", c.Verified, c.Evidence)
+			}
+		})
+	}
+}
+
+func TestMatchingActionPrefersClosestRecord(t *testing.T) {
+	closed := func(rkey, issueID, hash string) comments.IndexerRecord {
+		r := record(attest.ActionCollection, "did:plc:alice", "bd-1", "close")
+		r.URI = "at://did:plc:alice/" + attest.ActionCollection + "/" + rkey
+		r.Value["issueId"], r.Value["issueHash"] = issueID, hash
+		return r
+	}
+	c := Claim{IssueID: "bd-1", Role: RoleCloser, IssueHash: "sha256:aa"}
+
+	uri, status := matchingAction([]comments.IndexerRecord{closed("1", "bd-2", "sha256:aa"), closed("2", "bd-1", "sha256:bb")}, c)
+	if status != StatusModified || !strings.HasSuffix(uri, "/2") {
+		t.Errorf("got %s %s, want the modified close", status, uri)
+	}
+	uri, status = matchingAction([]comments.IndexerRecord{closed("1", "bd-1", "sha256:bb"), closed("2", "bd-1", "sha256:aa")}, c)
+	if status != StatusAttested || !strings.HasSuffix(uri, "/2") {
+		t.Errorf("got %s %s, want the matching close", status, uri)
+	}
+}